@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	ncldr_orgs_repository "nocalendar/internal/app/orgs/repository"
+	"nocalendar/internal/config"
+	ncldr_db "nocalendar/internal/db"
+	ncldr_logger "nocalendar/internal/logger"
+	"nocalendar/internal/model"
+	"time"
+)
+
+// create_org registers organization and creates its documents:
+//
+//	go run ./cmd/create_org -id acme -name "Acme Inc." -require-2fa
+func main() {
+	org := &model.Org{}
+	flag.StringVar(&org.Id, "id", "", "id of organization, it is sent in Organization header")
+	flag.StringVar(&org.Name, "name", "", "display name of organization")
+	flag.BoolVar(&org.Require2fa, "require-2fa", false, "users without second factor get restricted sessions")
+	flag.BoolVar(&org.OpenRegistration, "open-registration", false, "anyone may register in organization")
+	cfg := config.MustLoad()
+	logger := ncldr_logger.NewLogger(cfg.Log)
+
+	if !model.IsValidOrgId(org.Id) {
+		logger.Fatalf("incorrect organization id %q: use 2-32 lowercase letters, digits and dashes", org.Id)
+	}
+	if org.Name == "" {
+		org.Name = org.Id
+	}
+	org.CreatedAt = time.Now().Unix()
+
+	db := ncldr_db.NewDatabase(cfg.Mongo, logger)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	err := ncldr_orgs_repository.NewOrgsRepository(db, logger).InsertOrg(ctx, org)
+	if err != nil {
+		logger.Fatalf("organization not created: %s", err.Error())
+	}
+
+	err = db.ForOrg(org.Id).InitDocuments(ctx)
+	if err != nil {
+		logger.Fatalf("documents of organization not created: %s", err.Error())
+	}
+	logger.Infof("organization %s created", org.Id)
+}
@@ -1,40 +1,228 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	ncldr_admin_delivery "nocalendar/internal/app/admin/delivery"
+	ncldr_admin_usecase "nocalendar/internal/app/admin/usecase"
 	ncldr_auth_delivery "nocalendar/internal/app/auth/delivery"
 	ncldr_auth_repository "nocalendar/internal/app/auth/repository"
 	ncldr_auth_usecase "nocalendar/internal/app/auth/usecase"
+	ncldr_calendars_delivery "nocalendar/internal/app/calendars/delivery"
+	ncldr_calendars_repository "nocalendar/internal/app/calendars/repository"
+	ncldr_calendars_usecase "nocalendar/internal/app/calendars/usecase"
+	ncldr_changes_delivery "nocalendar/internal/app/changes/delivery"
+	ncldr_changes_repository "nocalendar/internal/app/changes/repository"
+	ncldr_changes_usecase "nocalendar/internal/app/changes/usecase"
+	"nocalendar/internal/app/errors"
 	ncldr_event_delivery "nocalendar/internal/app/events/delivery"
 	ncldr_event_repository "nocalendar/internal/app/events/repository"
 	ncldr_event_usecase "nocalendar/internal/app/events/usecase"
+	ncldr_groups_delivery "nocalendar/internal/app/groups/delivery"
+	ncldr_groups_repository "nocalendar/internal/app/groups/repository"
+	ncldr_groups_usecase "nocalendar/internal/app/groups/usecase"
+	ncldr_health_delivery "nocalendar/internal/app/health/delivery"
+	"nocalendar/internal/app/jobs"
 	"nocalendar/internal/app/middleware"
+	ncldr_orgs_repository "nocalendar/internal/app/orgs/repository"
+	ncldr_profile_delivery "nocalendar/internal/app/profile/delivery"
+	ncldr_profile_usecase "nocalendar/internal/app/profile/usecase"
+	ncldr_sso_delivery "nocalendar/internal/app/sso/delivery"
+	ncldr_sso_repository "nocalendar/internal/app/sso/repository"
+	ncldr_sso_usecase "nocalendar/internal/app/sso/usecase"
+	"nocalendar/internal/app/stream"
+	ncldr_stream_broker "nocalendar/internal/app/stream/broker"
+	ncldr_stream_delivery "nocalendar/internal/app/stream/delivery"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/config"
 	ncldr_db "nocalendar/internal/db"
 	ncldr_logger "nocalendar/internal/logger"
+	ncldr_mailer "nocalendar/internal/mailer"
+	"nocalendar/internal/metrics"
+	"nocalendar/internal/model"
+	"nocalendar/internal/ratelimit"
+	"nocalendar/internal/server"
+	"nocalendar/internal/tracing"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+const (
+	MONGO_DISCONNECT_TIMEOUT = 5 * time.Second
+	TRACING_FLUSH_TIMEOUT    = 5 * time.Second
+)
+
 func main() {
-	logger := ncldr_logger.NewLogger()
-	db := ncldr_db.NewDatabase(logger)
+	cfg := config.MustLoad()
+	logger := ncldr_logger.NewLogger(cfg.Log)
+	if cfg.Auth.TokenSecret == "" {
+		logger.Fatalln("token secret is not set: use TOKEN_SECRET, -token-secret or auth.token_secret")
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Fatalf("cannot init tracing: %s", err.Error())
+	}
+	db := ncldr_db.NewDatabase(cfg.Mongo, logger)
 
 	r := mux.NewRouter()
+	r.Use(middleware.RequestMiddleware)
+	r.Use(middleware.TracingMiddleware)
+	if cfg.Log.AccessLog {
+		r.Use(middleware.NewAccessLogMiddleware(cfg.Server.ClientIpHeader, logger).Log)
+	}
+	r.Use(middleware.MetricsMiddleware)
+	// mux does not run middlewares for unknown routes, request id is added here
+	r.NotFoundHandler = middleware.RequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errors.Write(w, r, errors.RouteNotFound)
+	}))
+	r.MethodNotAllowedHandler = middleware.RequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errors.Write(w, r, errors.MethodNotAllowed)
+	}))
 	api := r.PathPrefix("/api").Subrouter()
 	api.Use(middleware.ContentTypeMiddleware)
 
-	ar := ncldr_auth_repository.NewAuthRepository(db, logger)
-	au := ncldr_auth_usecase.NewAuthUsecase(ar, logger)
-	ad := ncldr_auth_delivery.NewAuthDelivery(au, logger)
+	ipHeader := cfg.Server.ClientIpHeader
+	limiter := ratelimit.NewTokenBucket(cfg.RateLimit.Rps, cfg.RateLimit.Burst)
+	rlm := middleware.NewRateLimitMiddleware(limiter, ipHeader, logger)
+	api.Use(rlm.Limit)
+	loginGuard := ratelimit.NewLoginGuard(
+		ratelimit.NewLockout(cfg.RateLimit.LoginMaxFailuresPerIp, time.Minute, time.Hour, time.Hour),
+		ratelimit.NewLockout(cfg.RateLimit.LoginMaxFailures, 30*time.Second, 15*time.Minute, time.Hour),
+		ipHeader,
+	)
+
+	mailer := ncldr_mailer.NewMailer(cfg.Smtp, logger)
+	providers, err := ncldr_sso_usecase.LoadProviders(cfg.Auth.OidcProviders)
+	if err != nil {
+		logger.Fatalf("cannot load oidc providers: %s", err.Error())
+	}
+
+	// every organization gets own repositories over its documents
+	build := func(org *model.Org, orgDb *ncldr_db.Database, broker stream.Broker) *tenant.Services {
+		ar := ncldr_auth_repository.NewAuthRepository(orgDb, logger)
+		au := ncldr_auth_usecase.NewAuthUsecase(ar, org, cfg.Auth, mailer, logger)
+
+		ssr := ncldr_sso_repository.NewSsoRepository(orgDb, logger)
+		ssu := ncldr_sso_usecase.NewSsoUsecase(org.Id, ssr, ar, au, providers, logger)
+
+		cr := ncldr_changes_repository.NewChangesRepository(orgDb, logger)
+		cu := ncldr_changes_usecase.NewChangesUsecase(cr, logger)
+
+		gr := ncldr_groups_repository.NewGroupsRepository(orgDb, logger)
+		clr := ncldr_calendars_repository.NewCalendarsRepository(orgDb, logger)
+		clu := ncldr_calendars_usecase.NewCalendarsUsecase(clr, ar, gr, logger)
+
+		er := ncldr_event_repository.NewEventsRepository(orgDb, logger)
+		eu := ncldr_event_usecase.NewEventsUsecase(er, ar, clr, cr, gr, broker, logger)
+		gu := ncldr_groups_usecase.NewGroupsUsecase(gr, ar, eu, logger)
+
+		pu := ncldr_profile_usecase.NewProfileUsecase(au, eu, clu, gu, ssu, logger)
+		adu := ncldr_admin_usecase.NewAdminUsecase(au, eu, clu, gu, jobs.NewRunner(er, logger), logger)
+		return &tenant.Services{
+			Org:       org,
+			Auth:      au,
+			Sso:       ssu,
+			Events:    eu,
+			Calendars: clu,
+			Groups:    gu,
+			Changes:   cu,
+			Profile:   pu,
+			Admin:     adu,
+			Broker:    broker,
+		}
+	}
+	newBroker := func() stream.Broker {
+		return ncldr_stream_broker.NewLocalBroker(logger)
+	}
+	orr := ncldr_orgs_repository.NewOrgsRepository(db, logger)
+	tenants := tenant.NewRegistry(orr, db, build, newBroker, logger)
+	tm := middleware.NewTenantMiddleware(tenants, logger)
+	api.Use(tm.Tenant)
 
-	er := ncldr_event_repository.NewEventsRepository(db, logger)
-	eu := ncldr_event_usecase.NewEventsUsecase(er, logger)
-	ed := ncldr_event_delivery.NewEventsDelivery(eu, au, logger)
+	ad := ncldr_auth_delivery.NewAuthDelivery(loginGuard, logger)
+	ssd := ncldr_sso_delivery.NewSsoDelivery(tenants, logger)
+	sd := ncldr_stream_delivery.NewStreamDelivery(logger)
+	cd := ncldr_changes_delivery.NewChangesDelivery(logger)
+	cld := ncldr_calendars_delivery.NewCalendarsDelivery(logger)
+	ed := ncldr_event_delivery.NewEventsDelivery(logger)
+	gd := ncldr_groups_delivery.NewGroupsDelivery(logger)
+	pd := ncldr_profile_delivery.NewProfileDelivery(logger)
+	add := ncldr_admin_delivery.NewAdminDelivery(tenants, logger)
 
 	ad.Routing(api)
+	ssd.Routing(api)
 	ed.Routing(api)
+	sd.Routing(api)
+	cd.Routing(api)
+	cld.Routing(api)
+	gd.Routing(api)
+	pd.Routing(api)
+	add.Routing(api)
+
+	hd := ncldr_health_delivery.NewHealthDelivery(db, logger)
+	hd.Routing(r)
+
+	if cfg.Metrics.Enabled {
+		metrics.Registry.MustRegister(metrics.NewSessionsCollector(tenants.ActiveSessions, logger))
+		r.Handle("/metrics", metrics.Handler(cfg.Metrics.Token)).Methods(http.MethodGet)
+	}
+
+	srv := server.NewServer(cfg.Server, r)
+	// streams never become idle by themselves, shutdown would wait for them until timeout
+	srv.RegisterOnShutdown(tenants.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Infof("start serving %s", cfg.Server.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	failed := false
+	select {
+	case err = <-serveErr:
+		logger.Errorf("http serve error: %s", err.Error())
+		failed = true
+	case <-ctx.Done():
+		// second signal kills process at once
+		stop()
+		logger.Infof("shutting down, draining in-flight requests for up to %s", cfg.Server.ShutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Errorf("requests not drained: %s", err.Error())
+		failed = true
+	}
+
+	limiter.Stop()
+	loginGuard.Stop()
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), TRACING_FLUSH_TIMEOUT)
+	defer cancelFlush()
+	err = shutdownTracing(flushCtx)
+	if err != nil {
+		logger.Errorf("spans not exported: %s", err.Error())
+		failed = true
+	}
+
+	disconnectCtx, cancelDisconnect := context.WithTimeout(context.Background(), MONGO_DISCONNECT_TIMEOUT)
+	defer cancelDisconnect()
+	err = db.Close(disconnectCtx)
+	if err != nil {
+		logger.Errorf("cannot disconnect from mongo: %s", err.Error())
+		failed = true
+	}
 
-	logger.Infoln("start serving ::8000")
-	err := http.ListenAndServe(":8000", r)
-	logger.Errorf("http serve error: %s", err.Error())
+	if failed {
+		os.Exit(1)
+	}
+	logger.Infoln("server stopped")
 }
@@ -1,51 +1,60 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"nocalendar/internal/app/errors"
-	"nocalendar/internal/app/events"
 	ncldr_event_repository "nocalendar/internal/app/events/repository"
+	"nocalendar/internal/app/jobs"
+	ncldr_orgs_repository "nocalendar/internal/app/orgs/repository"
+	"nocalendar/internal/config"
 	ncldr_db "nocalendar/internal/db"
 	ncldr_logger "nocalendar/internal/logger"
+	"nocalendar/internal/metrics"
+	"nocalendar/internal/model"
+
+	"github.com/sirupsen/logrus"
 )
 
-func removeUnusedEvents(er events.EventsRepository, member string, arr_events []string) bool {
-	all_removed := true
-	for _, event_id := range arr_events {
-		_, _, err := er.GetEvent(event_id)
-		if err == errors.EventNotFound {
-			err = er.RemoveEventIdFromMember(member, event_id)
-			if err != nil {
-				fmt.Printf("Not removed event id: %s\nError: %s\n\n", event_id, err.Error())
-				all_removed = false
-			}
-		}
+func pushMetrics(cfg *config.Config, logger *logrus.Logger) {
+	if cfg.Metrics.PushgatewayUrl == "" {
+		return
+	}
+	err := metrics.PushJobs(cfg.Metrics.PushgatewayUrl, model.JOB_CLEAN_REMOVED_EVENTS)
+	if err != nil {
+		logger.Warnf("metrics not pushed: %s", err.Error())
 	}
-	return all_removed
 }
 
-func removeAllUnusedEvents(er events.EventsRepository) {
-	members, err := er.GetAllMembers()
+func main() {
+	cfg := config.MustLoad()
+	logger := ncldr_logger.NewLogger(cfg.Log)
+	db := ncldr_db.NewDatabase(cfg.Mongo, logger)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	// deferred calls run on panic too
+	defer pushMetrics(cfg, logger)
+
+	orgs, err := ncldr_orgs_repository.NewOrgsRepository(db, logger).GetOrgs(ctx)
 	if err != nil {
 		fmt.Println(err.Error())
 		panic(1)
 	}
 
 	all_removed := true
-	for member, arr_events := range members {
-		all_removed = all_removed && removeUnusedEvents(er, member, arr_events)
+	for _, org := range orgs {
+		er := ncldr_event_repository.NewEventsRepository(db.ForOrg(org.Id), logger)
+		result, err := jobs.NewRunner(er, logger).CleanRemovedEvents(ctx)
+		if err != nil {
+			fmt.Println(err.Error())
+			panic(1)
+		}
+		for _, event_id := range result.Failed {
+			fmt.Printf("Not removed event id: %s\nOrganization: %s\n\n", event_id, org.Id)
+		}
+		all_removed = all_removed && len(result.Failed) == 0
 	}
 
 	if !all_removed {
 		panic(2)
 	}
 }
-
-func main() {
-	logger := ncldr_logger.NewLogger()
-	db := ncldr_db.NewDatabase(logger)
-
-	er := ncldr_event_repository.NewEventsRepository(db, logger)
-
-	removeAllUnusedEvents(er)
-}
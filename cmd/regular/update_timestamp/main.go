@@ -1,76 +1,54 @@
 package main
 
 import (
-	"nocalendar/internal/app/events"
+	"context"
 	ncldr_event_repository "nocalendar/internal/app/events/repository"
+	"nocalendar/internal/app/jobs"
+	ncldr_orgs_repository "nocalendar/internal/app/orgs/repository"
+	"nocalendar/internal/config"
 	ncldr_db "nocalendar/internal/db"
 	ncldr_logger "nocalendar/internal/logger"
+	"nocalendar/internal/metrics"
 	"nocalendar/internal/model"
 	"time"
-)
 
-var (
-	logger           = ncldr_logger.NewLogger()
-	badEventIds      = make([]string, 0)
-	currentTimestamp = time.Now().Unix()
+	"github.com/sirupsen/logrus"
 )
 
-func updateTimestamp(er events.EventsRepository, event_id string) {
-	ievent, mode, err := er.GetEvent(event_id)
-	if err != nil {
-		badEventIds = append(badEventIds, event_id)
+func pushMetrics(cfg *config.Config, logger *logrus.Logger) {
+	if cfg.Metrics.PushgatewayUrl == "" {
 		return
 	}
-
-	sup_ev_id := ""
-	switch mode {
-	case model.REGULAR_EVENT:
-		sup_ev_id = ievent.(model.RegularEvent).SingleEventId
-	case model.SINGLE_EVENT:
-		sup_ev_id = ievent.(model.SingleEvent).RegularEventId
-	}
-	event := model.ConvertInterfaceToEvent(ievent, mode)
-
-	if event.Timestamp < currentTimestamp {
-		switch mode {
-		case model.REGULAR_EVENT:
-			event.Timestamp += event.Delta * model.DAYS_IN_SECONDS
-			err = er.InsertRegularEvent(event.ToRegular(sup_ev_id), mode)
-			if err != nil {
-				badEventIds = append(badEventIds, event_id)
-			}
-		case model.SINGLE_EVENT:
-			err = er.RemoveEvent(event.Id)
-			if err != nil {
-				badEventIds = append(badEventIds, event_id)
-			}
-			e, _, err := er.GetEvent(sup_ev_id)
-			if err != nil {
-				badEventIds = append(badEventIds, event_id)
-			}
-			ev := e.(model.RegularEvent)
-			ev.SingleEventId = ""
-			err = er.InsertRegularEvent(&ev, mode)
-			if err != nil {
-				badEventIds = append(badEventIds, event_id)
-			}
-		}
+	err := metrics.PushJobs(cfg.Metrics.PushgatewayUrl, model.JOB_UPDATE_TIMESTAMP)
+	if err != nil {
+		logger.Warnf("metrics not pushed: %s", err.Error())
 	}
 }
 
-func updateAllTimestamps(er events.EventsRepository) {
-	event_ids, err := er.GetAllEventIds()
+func main() {
+	cfg := config.MustLoad()
+	logger := ncldr_logger.NewLogger(cfg.Log)
+	db := ncldr_db.NewDatabase(cfg.Mongo, logger)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	// Fatalln exits without deferred calls, but with exit handlers
+	logrus.RegisterExitHandler(func() { pushMetrics(cfg, logger) })
+	defer pushMetrics(cfg, logger)
+	currentTimestamp := time.Now().Unix()
+
+	orgs, err := ncldr_orgs_repository.NewOrgsRepository(db, logger).GetOrgs(ctx)
 	if err != nil {
 		logger.Fatalln(err.Error())
 	}
 
-	for _, event_id := range event_ids {
-		// skip initialized event id
-		if event_id == "nocalender_regular_event_init" || event_id == "nocalender_single_event_init" {
-			continue
+	badEventIds := make([]string, 0)
+	for _, org := range orgs {
+		er := ncldr_event_repository.NewEventsRepository(db.ForOrg(org.Id), logger)
+		result, err := jobs.NewRunner(er, logger).UpdateTimestamps(ctx, currentTimestamp)
+		if err != nil {
+			logger.Fatalln(err.Error())
 		}
-
-		updateTimestamp(er, event_id)
+		badEventIds = append(badEventIds, result.Failed...)
 	}
 
 	if len(badEventIds) > 0 {
@@ -78,11 +56,3 @@ func updateAllTimestamps(er events.EventsRepository) {
 		logger.Fatalln("not all events was updated")
 	}
 }
-
-func main() {
-	db := ncldr_db.NewDatabase(logger)
-
-	er := ncldr_event_repository.NewEventsRepository(db, logger)
-
-	updateAllTimestamps(er)
-}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	ncldr_auth_repository "nocalendar/internal/app/auth/repository"
+	ncldr_orgs_repository "nocalendar/internal/app/orgs/repository"
+	"nocalendar/internal/config"
+	ncldr_db "nocalendar/internal/db"
+	ncldr_logger "nocalendar/internal/logger"
+	"nocalendar/internal/model"
+)
+
+// set_role gives role to user, it is the way to appoint first administrator:
+//
+//	go run ./cmd/set_role -org acme -login alice -role org-admin
+func main() {
+	var orgId, login, role string
+	flag.StringVar(&orgId, "org", model.DEFAULT_ORG, "id of organization of user")
+	flag.StringVar(&login, "login", "", "login of user")
+	flag.StringVar(&role, "role", model.USER_ROLE_ORG_ADMIN, "one of user, org-admin, super-admin")
+	cfg := config.MustLoad()
+	logger := ncldr_logger.NewLogger(cfg.Log)
+
+	if !model.IsValidUserRole(role) {
+		logger.Fatalf("incorrect role %q", role)
+	}
+
+	db := ncldr_db.NewDatabase(cfg.Mongo, logger)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+	_, err := ncldr_orgs_repository.NewOrgsRepository(db, logger).GetOrg(ctx, orgId)
+	if err != nil {
+		logger.Fatalf("organization %s not found: %s", orgId, err.Error())
+	}
+
+	ar := ncldr_auth_repository.NewAuthRepository(db.ForOrg(orgId), logger)
+	_, err = ar.GetUser(ctx, login)
+	if err != nil {
+		logger.Fatalf("user %s not found: %s", login, err.Error())
+	}
+
+	err = ar.SetRole(ctx, login, role)
+	if err != nil {
+		logger.Fatalf("role not set: %s", err.Error())
+	}
+	logger.Infof("user %s of organization %s is %s now", login, orgId, role)
+}
@@ -0,0 +1,235 @@
+package delivery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"nocalendar/internal/app/admin"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+	"nocalendar/internal/validation"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type AdminDelivery struct {
+	tenants *tenant.Registry
+	logger  *logrus.Logger
+}
+
+func NewAdminDelivery(tenants *tenant.Registry, logger *logrus.Logger) *AdminDelivery {
+	return &AdminDelivery{
+		tenants: tenants,
+		logger:  logger,
+	}
+}
+
+func (ad *AdminDelivery) adminUsecase(r *http.Request) admin.AdminUsecase {
+	return tenant.FromContext(r.Context()).Admin
+}
+
+func (ad *AdminDelivery) Routing(r *mux.Router) {
+	adm := r.PathPrefix("/admin").Subrouter()
+	am := middleware.NewAuthMiddleware(ad.logger)
+	tm := middleware.NewTenantMiddleware(ad.tenants, ad.logger)
+	adm.Use(am.TokenChecking, am.SessionOnly, am.RequireRole(model.USER_ROLE_ORG_ADMIN), tm.TargetTenant)
+
+	adm.HandleFunc("/users", ad.GetUsers).Methods(http.MethodGet, http.MethodOptions)
+	adm.HandleFunc("/users/{login}/suspend", ad.Suspend).Methods(http.MethodPost, http.MethodOptions)
+	adm.HandleFunc("/users/{login}/unsuspend", ad.Unsuspend).Methods(http.MethodPost, http.MethodOptions)
+	adm.HandleFunc("/users/{login}/role", ad.SetRole).Methods(http.MethodPut, http.MethodOptions)
+	adm.HandleFunc("/users/{login}/sessions", ad.ForceLogout).Methods(http.MethodDelete, http.MethodOptions)
+	adm.HandleFunc("/users/{login}/reassign", ad.ReassignUser).Methods(http.MethodPost, http.MethodOptions)
+
+	adm.HandleFunc("/settings", ad.UpdateSettings).Methods(http.MethodPut, http.MethodOptions)
+	adm.HandleFunc("/events/{event_id:[\\w]+}", ad.GetEvent).Methods(http.MethodGet, http.MethodOptions)
+	adm.HandleFunc("/jobs/{job}", ad.RunJob).Methods(http.MethodPost, http.MethodOptions)
+}
+
+func (ad *AdminDelivery) GetUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, limit := 0, 0
+	var err error
+	if value := query.Get(model.OffsetCgi); value != "" {
+		offset, err = strconv.Atoi(value)
+	}
+	if value := query.Get(model.LimitCgi); err == nil && value != "" {
+		limit, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[GetUsers] cannot parse cgies: %s", err.Error())
+		errors.Write(w, r, errors.BadPagination)
+		return
+	}
+
+	users, err := ad.adminUsecase(r).GetUsers(r.Context(), offset, limit)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[GetUsers] users not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(users.ToAnswer()))
+}
+
+func (ad *AdminDelivery) setSuspended(w http.ResponseWriter, r *http.Request, suspended bool) {
+	login := mux.Vars(r)["login"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := ad.adminUsecase(r).SetSuspended(r.Context(), usr, login, suspended)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[setSuspended] user %s not changed: %s", login, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AdminDelivery) Suspend(w http.ResponseWriter, r *http.Request) {
+	ad.setSuspended(w, r, true)
+}
+
+func (ad *AdminDelivery) Unsuspend(w http.ResponseWriter, r *http.Request) {
+	ad.setSuspended(w, r, false)
+}
+
+func (ad *AdminDelivery) SetRole(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	update := &model.RoleUpdate{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, update)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[SetRole] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadRole)
+		return
+	}
+
+	err = ad.adminUsecase(r).SetRole(r.Context(), usr, login, update.Role)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[SetRole] role of %s not changed: %s", login, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AdminDelivery) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := ad.adminUsecase(r).ForceLogout(r.Context(), usr, login)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ForceLogout] sessions of %s not removed: %s", login, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AdminDelivery) ReassignUser(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	request := &model.ReassignRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, request)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ReassignUser] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadTransfer)
+		return
+	}
+
+	err = ad.adminUsecase(r).ReassignUser(r.Context(), usr, login, request.TransferTo)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ReassignUser] events of %s not reassigned: %s", login, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+// UpdateSettings changes settings of organization of request or of target_org
+func (ad *AdminDelivery) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	org := tenant.FromContext(r.Context()).Org
+
+	settings := &model.OrgSettings{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, settings)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[UpdateSettings] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
+		return
+	}
+
+	v := validation.NewValidator()
+	v.Check(settings.Require2fa != nil, "require_2fa", "is required")
+	if err := v.Err(); err != nil {
+		errors.Write(w, r, err)
+		return
+	}
+
+	err = ad.tenants.UpdateSettings(r.Context(), org.Id, settings)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[UpdateSettings] settings of %s not changed: %s", org.Id, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	ad.logger.WithContext(r.Context()).Infof("[UpdateSettings] %s sets require_2fa of %s to %t", usr.Login, org.Id, *settings.Require2fa)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AdminDelivery) GetEvent(w http.ResponseWriter, r *http.Request) {
+	eventId := mux.Vars(r)["event_id"]
+
+	event, err := ad.adminUsecase(r).GetEvent(r.Context(), eventId)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[GetEvent] event not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(event.ToAnswer()))
+}
+
+func (ad *AdminDelivery) RunJob(w http.ResponseWriter, r *http.Request) {
+	job := mux.Vars(r)["job"]
+
+	result, err := ad.adminUsecase(r).RunJob(r.Context(), job)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[RunJob] job %s not run: %s", job, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(result.ToAnswer()))
+}
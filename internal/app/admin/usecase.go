@@ -0,0 +1,17 @@
+package admin
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type AdminUsecase interface {
+	GetUsers(ctx context.Context, offset, limit int) (*model.JsonAdminUsers, error)
+	SetRole(ctx context.Context, admin *model.User, login, role string) error
+	SetSuspended(ctx context.Context, admin *model.User, login string, suspended bool) error
+	ForceLogout(ctx context.Context, admin *model.User, login string) error
+	ReassignUser(ctx context.Context, admin *model.User, login, transferTo string) error
+
+	GetEvent(ctx context.Context, eventId string) (*model.Event, error)
+	RunJob(ctx context.Context, job string) (*model.JobResult, error)
+}
@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/admin"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/jobs"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AdminUsecase has no own storage, it manages data of other domains on behalf of
+// administrators. Role of administrator is checked by AuthMiddleware.RequireRole
+type AdminUsecase struct {
+	authUsecase      auth.AuthUsecase
+	eventsUsecase    events.EventsUsecase
+	calendarsUsecase calendars.CalendarsUsecase
+	groupsUsecase    groups.GroupsUsecase
+	jobs             *jobs.Runner
+	logger           *logrus.Logger
+}
+
+func NewAdminUsecase(authUsecase auth.AuthUsecase, eventsUsecase events.EventsUsecase, calendarsUsecase calendars.CalendarsUsecase,
+	groupsUsecase groups.GroupsUsecase, jobs *jobs.Runner, logger *logrus.Logger) admin.AdminUsecase {
+	return &AdminUsecase{
+		authUsecase:      authUsecase,
+		eventsUsecase:    eventsUsecase,
+		calendarsUsecase: calendarsUsecase,
+		groupsUsecase:    groupsUsecase,
+		jobs:             jobs,
+		logger:           logger,
+	}
+}
+
+// checkManaged returns user if admin may manage them. Administrators cannot manage
+// themselves and users with the same or higher role, super administrators manage everyone
+func (au *AdminUsecase) checkManaged(ctx context.Context, admin *model.User, login string) (*model.User, error) {
+	usr, err := au.authUsecase.GetProfile(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr.Login == admin.Login {
+		return nil, errors.CannotManageUser
+	}
+	if admin.UserRole() != model.USER_ROLE_SUPER_ADMIN && model.HasUserRole(usr.UserRole(), admin.UserRole()) {
+		return nil, errors.CannotManageUser
+	}
+	return usr, nil
+}
+
+func (au *AdminUsecase) GetUsers(ctx context.Context, offset, limit int) (*model.JsonAdminUsers, error) {
+	ctx, span := tracing.Start(ctx, "admin.GetUsers")
+	defer span.End()
+
+	return au.authUsecase.GetUsers(ctx, offset, limit)
+}
+
+// SetRole gives role not higher than role of admin
+func (au *AdminUsecase) SetRole(ctx context.Context, admin *model.User, login, role string) error {
+	ctx, span := tracing.Start(ctx, "admin.SetRole")
+	defer span.End()
+
+	if !model.IsValidUserRole(role) {
+		return errors.BadRole
+	}
+	if !model.HasUserRole(admin.UserRole(), role) {
+		return errors.HasNoRights
+	}
+
+	_, err := au.checkManaged(ctx, admin, login)
+	if err != nil {
+		return err
+	}
+
+	au.logger.WithContext(ctx).Infof("[SetRole] %s gives role %s to %s", admin.Login, role, login)
+	return au.authUsecase.SetRole(ctx, login, role)
+}
+
+func (au *AdminUsecase) SetSuspended(ctx context.Context, admin *model.User, login string, suspended bool) error {
+	ctx, span := tracing.Start(ctx, "admin.SetSuspended")
+	defer span.End()
+
+	_, err := au.checkManaged(ctx, admin, login)
+	if err != nil {
+		return err
+	}
+
+	au.logger.WithContext(ctx).Infof("[SetSuspended] %s sets suspended of %s to %t", admin.Login, login, suspended)
+	return au.authUsecase.SetSuspended(ctx, login, suspended)
+}
+
+func (au *AdminUsecase) ForceLogout(ctx context.Context, admin *model.User, login string) error {
+	ctx, span := tracing.Start(ctx, "admin.ForceLogout")
+	defer span.End()
+
+	_, err := au.checkManaged(ctx, admin, login)
+	if err != nil {
+		return err
+	}
+
+	au.logger.WithContext(ctx).Infof("[ForceLogout] %s ends sessions of %s", admin.Login, login)
+	return au.authUsecase.RemoveSessions(ctx, login)
+}
+
+// ReassignUser gives events, calendars and groups of departed user to transferTo and
+// removes user from events and groups of others. User itself is kept, it may be suspended separately
+func (au *AdminUsecase) ReassignUser(ctx context.Context, admin *model.User, login, transferTo string) error {
+	ctx, span := tracing.Start(ctx, "admin.ReassignUser")
+	defer span.End()
+
+	_, err := au.checkManaged(ctx, admin, login)
+	if err != nil {
+		return err
+	}
+
+	if transferTo == "" || transferTo == login {
+		return errors.BadTransfer
+	}
+	_, err = au.authUsecase.GetProfile(ctx, transferTo)
+	if err == errors.UserNotFound {
+		return errors.BadTransfer
+	}
+	if err != nil {
+		return err
+	}
+
+	err = au.eventsUsecase.RemoveMember(ctx, login, transferTo)
+	if err != nil {
+		return err
+	}
+
+	err = au.calendarsUsecase.RemoveOwner(ctx, login, transferTo)
+	if err != nil {
+		return err
+	}
+
+	au.logger.WithContext(ctx).Infof("[ReassignUser] %s gives events of %s to %s", admin.Login, login, transferTo)
+	return au.groupsUsecase.RemoveUser(ctx, login, transferTo)
+}
+
+func (au *AdminUsecase) GetEvent(ctx context.Context, eventId string) (*model.Event, error) {
+	ctx, span := tracing.Start(ctx, "admin.GetEvent")
+	defer span.End()
+
+	return au.eventsUsecase.GetAnyEvent(ctx, eventId)
+}
+
+func (au *AdminUsecase) RunJob(ctx context.Context, job string) (*model.JobResult, error) {
+	ctx, span := tracing.Start(ctx, "admin.RunJob")
+	defer span.End()
+
+	return au.jobs.Run(ctx, job)
+}
@@ -2,31 +2,78 @@ package delivery
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"nocalendar/internal/app/auth"
 	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/tenant"
 	"nocalendar/internal/model"
+	"nocalendar/internal/ratelimit"
+	"nocalendar/internal/validation"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
 type AuthDelivery struct {
-	authUsecase auth.AuthUsecase
-	logger      *logrus.Logger
+	loginGuard *ratelimit.LoginGuard
+	logger     *logrus.Logger
 }
 
-func NewAuthDelivery(authDelivery auth.AuthUsecase, logger *logrus.Logger) *AuthDelivery {
+func NewAuthDelivery(loginGuard *ratelimit.LoginGuard, logger *logrus.Logger) *AuthDelivery {
 	return &AuthDelivery{
-		authUsecase: authDelivery,
-		logger:      logger,
+		loginGuard: loginGuard,
+		logger:     logger,
 	}
 }
 
+func (ad *AuthDelivery) authUsecase(r *http.Request) auth.AuthUsecase {
+	return tenant.FromContext(r.Context()).Auth
+}
+
+// guardKey separates failures of the same login in different organizations
+func guardKey(r *http.Request, login string) string {
+	return fmt.Sprintf("%s/%s", tenant.FromContext(r.Context()).Org.Id, login)
+}
+
 func (ad *AuthDelivery) Routing(r *mux.Router) {
 	r.HandleFunc("/auth", ad.Authorize).Methods(http.MethodPost, http.MethodOptions)
 	r.HandleFunc("/register", ad.Register).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/token/refresh", ad.RefreshToken).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/email/verify", ad.VerifyEmail).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/password/forgot", ad.ForgotPassword).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/password/reset", ad.ResetPassword).Methods(http.MethodPost, http.MethodOptions)
+
+	am := middleware.NewAuthMiddleware(ad.logger)
+	r.HandleFunc("/auth/2fa", ad.AuthorizeSecondFactor).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/logout", am.RestrictedTokenChecking(am.SessionOnly(http.HandlerFunc(ad.Logout)))).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/email/verify/resend", am.TokenChecking(am.SessionOnly(http.HandlerFunc(ad.ResendVerification)))).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/password/change", am.TokenChecking(am.SessionOnly(http.HandlerFunc(ad.ChangePassword)))).Methods(http.MethodPost, http.MethodOptions)
+
+	ss := r.PathPrefix("/sessions").Subrouter()
+	ss.Use(am.TokenChecking, am.SessionOnly)
+	ss.HandleFunc("", ad.GetSessions).Methods(http.MethodGet, http.MethodOptions)
+	ss.HandleFunc("/{session_id:[\\w]+}", ad.RemoveSession).Methods(http.MethodDelete, http.MethodOptions)
+
+	tf := r.PathPrefix("/2fa").Subrouter()
+	tf.Use(am.RestrictedTokenChecking, am.SessionOnly)
+	tf.HandleFunc("/enroll", ad.EnrollTotp).Methods(http.MethodPost, http.MethodOptions)
+	tf.HandleFunc("/confirm", ad.ConfirmTotp).Methods(http.MethodPost, http.MethodOptions)
+	tf.HandleFunc("/disable", ad.DisableTotp).Methods(http.MethodPost, http.MethodOptions)
+	tf.HandleFunc("/recovery-codes", ad.RegenerateRecoveryCodes).Methods(http.MethodPost, http.MethodOptions)
+
+	ks := r.PathPrefix("/keys").Subrouter()
+	ks.Use(am.TokenChecking, am.SessionOnly)
+	ks.HandleFunc("", ad.GetApiKeys).Methods(http.MethodGet, http.MethodOptions)
+	ks.HandleFunc("", ad.CreateApiKey).Methods(http.MethodPost, http.MethodOptions)
+	ks.HandleFunc("/{key_id:[\\w]+}", ad.RemoveApiKey).Methods(http.MethodDelete, http.MethodOptions)
+}
+
+func setTokenHeaders(w http.ResponseWriter, tokens *model.Tokens) {
+	w.Header().Set("Authorize", tokens.AccessToken)
+	w.Header().Set("Refresh-Token", tokens.RefreshToken)
 }
 
 func (ad *AuthDelivery) Authorize(w http.ResponseWriter, r *http.Request) {
@@ -34,37 +81,61 @@ func (ad *AuthDelivery) Authorize(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	buf, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		ad.logger.Warnf("[Authorize] cannot convert body to bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ad.logger.WithContext(r.Context()).Warnf("[Authorize] cannot convert body to bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
 	err = json.Unmarshal(buf, &authModel)
 	if err != nil {
-		ad.logger.Warnf("[Authorize] cannot convert body to bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ad.logger.WithContext(r.Context()).Warnf("[Authorize] cannot convert body to bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
-	usr, err := ad.authUsecase.GetUser(authModel)
+	if wait := ad.loginGuard.Locked(r, guardKey(r, authModel.Login)); wait > 0 {
+		ad.logger.WithContext(r.Context()).Warnf("[Authorize] login %s is locked out", authModel.Login)
+		middleware.SetRetryAfter(w, wait)
+		errors.Write(w, r, errors.TooManyRequests)
+		return
+	}
+
+	usr, err := ad.authUsecase(r).GetUser(r.Context(), authModel)
 	if err != nil {
-		ad.logger.Warnf("[Authorize] user not authorized: %s", err.Error())
-		switch err {
-		case errors.BadPassword:
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		case errors.UserNotFound:
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
+		ad.logger.WithContext(r.Context()).Warnf("[Authorize] user not authorized: %s", err.Error())
+		if err == errors.BadCredentials {
+			ad.loginGuard.Fail(r, guardKey(r, authModel.Login))
 		}
+		errors.Write(w, r, err)
 		return
 	}
 
-	w.Header().Add("Authorize", usr.Token)
+	if usr.TotpEnabled {
+		challenge, err := ad.authUsecase(r).CreateMfaChallenge(usr.Login)
+		if err != nil {
+			ad.logger.WithContext(r.Context()).Warnf("[Authorize] mfa token not created: %s", err.Error())
+			errors.Write(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(model.ToBytes(challenge.ToAnswer()))
+		return
+	}
+	// failures are reset only when login completes, otherwise every correct password
+	// would reset failed one-time codes too
+	ad.loginGuard.Success(guardKey(r, authModel.Login))
+
+	tokens, err := ad.authUsecase(r).CreateSession(r.Context(), usr.Login, r.UserAgent())
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[Authorize] session not created: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	setTokenHeaders(w, tokens)
 	w.WriteHeader(http.StatusOK)
-	w.Write(model.ToBytes(usr.WithoutPassword()))
+	w.Write(model.ToBytes(usr.Profile()))
 }
 
 func (ad *AuthDelivery) Register(w http.ResponseWriter, r *http.Request) {
@@ -72,31 +143,417 @@ func (ad *AuthDelivery) Register(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	buf, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		ad.logger.Warnf("[Authorize] cannot convert body to bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ad.logger.WithContext(r.Context()).Warnf("[Register] cannot convert body to bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
 	err = json.Unmarshal(buf, &usrModel)
 	if err != nil {
-		ad.logger.Warnf("[Authorize] cannot convert body to bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ad.logger.WithContext(r.Context()).Warnf("[Register] cannot unmarshal bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
+		return
+	}
+
+	tokens, err := ad.authUsecase(r).CreateUser(r.Context(), usrModel, r.UserAgent())
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[Register] user not registered: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	setTokenHeaders(w, tokens)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (ad *AuthDelivery) Logout(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	session := r.Context().Value(middleware.ContextSessionKey).(*model.Session)
+
+	err := ad.authUsecase(r).RemoveSession(r.Context(), usr.Login, session.Id)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[Logout] session not removed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) GetSessions(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	session := r.Context().Value(middleware.ContextSessionKey).(*model.Session)
+
+	sessions, err := ad.authUsecase(r).GetSessions(r.Context(), usr.Login, session.Id)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[GetSessions] sessions not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(sessions.ToAnswer()))
+}
+
+func (ad *AuthDelivery) RemoveSession(w http.ResponseWriter, r *http.Request) {
+	sessionId := mux.Vars(r)["session_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := ad.authUsecase(r).RemoveSession(r.Context(), usr.Login, sessionId)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[RemoveSession] session not removed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	refreshModel := &model.RefreshRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, refreshModel)
+	}
+	if err != nil || refreshModel.RefreshToken == "" {
+		ad.logger.WithContext(r.Context()).Warnln("[RefreshToken] cannot read refresh token")
+		errors.Write(w, r, errors.SessionNotFound.WithStatus(http.StatusBadRequest))
+		return
+	}
+
+	tokens, err := ad.authUsecase(r).RefreshSession(r.Context(), refreshModel.RefreshToken)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[RefreshToken] session not refreshed: %s", err.Error())
+		if err == errors.SessionNotFound {
+			errors.Write(w, r, errors.SessionNotFound.WithStatus(http.StatusUnauthorized))
+			return
+		}
+		errors.Write(w, r, err)
+		return
+	}
+
+	setTokenHeaders(w, tokens)
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(tokens.ToAnswer()))
+}
+
+func (ad *AuthDelivery) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	tokenModel := &model.TokenRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, tokenModel)
+	}
+	if err != nil || tokenModel.Token == "" {
+		ad.logger.WithContext(r.Context()).Warnln("[VerifyEmail] cannot read token")
+		errors.Write(w, r, errors.BadUserToken)
+		return
+	}
+
+	err = ad.authUsecase(r).VerifyEmail(r.Context(), tokenModel.Token)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[VerifyEmail] email not verified: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := ad.authUsecase(r).SendVerification(r.Context(), usr.Login)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ResendVerification] letter not sent: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	forgotModel := &model.ForgotPasswordRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, forgotModel)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ForgotPassword] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
+		return
+	}
+	v := validation.NewValidator()
+	v.Check(forgotModel.Email != "", "email", "must not be empty")
+	if err = v.Err(); err != nil {
+		ad.logger.WithContext(r.Context()).Warnln("[ForgotPassword] email is empty")
+		errors.Write(w, r, err)
+		return
+	}
+
+	err = ad.authUsecase(r).ForgotPassword(r.Context(), forgotModel.Email)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ForgotPassword] reset not started: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	resetModel := &model.ResetPasswordRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, resetModel)
+	}
+	if err != nil || resetModel.Token == "" {
+		ad.logger.WithContext(r.Context()).Warnln("[ResetPassword] cannot read token")
+		errors.Write(w, r, errors.BadUserToken)
+		return
+	}
+
+	err = ad.authUsecase(r).ResetPassword(r.Context(), resetModel.Token, resetModel.Password)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ResetPassword] password not reset: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
-	token, err := ad.authUsecase.CreateUser(usrModel)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	session := r.Context().Value(middleware.ContextSessionKey).(*model.Session)
+
+	changeModel := &model.ChangePasswordRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, changeModel)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ChangePassword] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
+		return
+	}
+
+	err = ad.authUsecase(r).ChangePassword(r.Context(), usr.Login, session.Id, changeModel.OldPassword, changeModel.NewPassword)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ChangePassword] password not changed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	keyModel := &model.ApiKeyRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, keyModel)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[CreateApiKey] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadApiKey)
+		return
+	}
+
+	created, err := ad.authUsecase(r).CreateApiKey(r.Context(), usr.Login, keyModel)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[CreateApiKey] api key not created: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(created.ToAnswer()))
+}
+
+func (ad *AuthDelivery) GetApiKeys(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	keys, err := ad.authUsecase(r).GetApiKeys(r.Context(), usr.Login)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[GetApiKeys] api keys not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(keys.ToAnswer()))
+}
+
+func (ad *AuthDelivery) RemoveApiKey(w http.ResponseWriter, r *http.Request) {
+	keyId := mux.Vars(r)["key_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := ad.authUsecase(r).RemoveApiKey(r.Context(), usr.Login, keyId)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[RemoveApiKey] api key not removed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) AuthorizeSecondFactor(w http.ResponseWriter, r *http.Request) {
+	factorModel := &model.SecondFactorRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, factorModel)
+	}
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[AuthorizeSecondFactor] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadMfaToken.WithStatus(http.StatusBadRequest))
+		return
+	}
+
+	login, err := ad.authUsecase(r).ParseMfaToken(factorModel.MfaToken)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[AuthorizeSecondFactor] incorrect mfa token: %s", err.Error())
+		errors.Write(w, r, errors.BadMfaToken)
+		return
+	}
+
+	if wait := ad.loginGuard.Locked(r, guardKey(r, login)); wait > 0 {
+		ad.logger.WithContext(r.Context()).Warnf("[AuthorizeSecondFactor] login %s is locked out", login)
+		middleware.SetRetryAfter(w, wait)
+		errors.Write(w, r, errors.TooManyRequests)
+		return
+	}
+
+	usr, err := ad.authUsecase(r).CheckSecondFactor(r.Context(), login, factorModel)
 	if err != nil {
-		ad.logger.Warnf("[Register] user not registered: %s", err.Error())
+		ad.logger.WithContext(r.Context()).Warnf("[AuthorizeSecondFactor] user not authorized: %s", err.Error())
 		switch err {
-		case errors.LoginAlreadyExists, errors.EmailAlreadyExists:
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(errors.ErrorToBytes(err)))
+		case errors.BadTotpCode:
+			ad.loginGuard.Fail(r, guardKey(r, login))
+			errors.Write(w, r, errors.BadTotpCode.WithStatus(http.StatusUnauthorized))
+		case errors.BadMfaToken, errors.UserNotFound:
+			errors.Write(w, r, errors.BadMfaToken)
 		default:
-			w.WriteHeader(http.StatusInternalServerError)
+			errors.Write(w, r, err)
 		}
 		return
 	}
+	ad.loginGuard.Success(guardKey(r, login))
+
+	tokens, err := ad.authUsecase(r).CreateSession(r.Context(), usr.Login, r.UserAgent())
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[AuthorizeSecondFactor] session not created: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	setTokenHeaders(w, tokens)
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(usr.Profile()))
+}
+
+func (ad *AuthDelivery) EnrollTotp(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	enrollment, err := ad.authUsecase(r).EnrollTotp(r.Context(), usr.Login)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[EnrollTotp] totp not enrolled: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(enrollment.ToAnswer()))
+}
+
+func (ad *AuthDelivery) readTotpRequest(r *http.Request) (*model.TotpRequest, error) {
+	totpModel := &model.TotpRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, totpModel)
+	if err != nil {
+		return nil, err
+	}
+	return totpModel, nil
+}
+
+func (ad *AuthDelivery) ConfirmTotp(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	totpModel, err := ad.readTotpRequest(r)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ConfirmTotp] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadTotpCode)
+		return
+	}
+
+	codes, err := ad.authUsecase(r).ConfirmTotp(r.Context(), usr.Login, totpModel.Code)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[ConfirmTotp] totp not confirmed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(codes.ToAnswer()))
+}
+
+func (ad *AuthDelivery) DisableTotp(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	totpModel, err := ad.readTotpRequest(r)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[DisableTotp] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadTotpCode)
+		return
+	}
+
+	err = ad.authUsecase(r).DisableTotp(r.Context(), usr.Login, totpModel)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[DisableTotp] totp not disabled: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (ad *AuthDelivery) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	totpModel, err := ad.readTotpRequest(r)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[RegenerateRecoveryCodes] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadTotpCode)
+		return
+	}
+
+	codes, err := ad.authUsecase(r).RegenerateRecoveryCodes(r.Context(), usr.Login, totpModel.Code)
+	if err != nil {
+		ad.logger.WithContext(r.Context()).Warnf("[RegenerateRecoveryCodes] codes not generated: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
 
-	w.Header().Add("Authorize", token)
 	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(codes.ToAnswer()))
 }
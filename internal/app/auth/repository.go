@@ -1,12 +1,43 @@
 package auth
 
 import (
+	"context"
 	"nocalendar/internal/model"
 )
 
 type AuthRepository interface {
-	Insert(usr *model.User) (*model.User, error)
-	CheckUser(usr *model.User) (bool, error)
-	GetUser(login string) (*model.User, error)
-	GetLoginByToken(token string) (string, error)
+	Insert(ctx context.Context, usr *model.User) (*model.User, error)
+	CheckUser(ctx context.Context, usr *model.User) (bool, error)
+	GetUser(ctx context.Context, login string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetDirectoryUsers(ctx context.Context) ([]*model.User, error)
+	GetUsers(ctx context.Context) ([]*model.User, error)
+	RemoveUser(ctx context.Context, login string) error
+	UpdatePassword(ctx context.Context, login, password string) error
+	SetEmailVerified(ctx context.Context, login string) error
+	SetRole(ctx context.Context, login, role string) error
+	SetSuspended(ctx context.Context, login string, suspended bool) error
+	SetTotp(ctx context.Context, login, secret string, enabled bool) error
+	UseTotpStep(ctx context.Context, login string, step int64) error
+	SetRecoveryCodes(ctx context.Context, login string, hashes []string) error
+	UseRecoveryCode(ctx context.Context, login, hash string) error
+
+	InsertUserToken(ctx context.Context, tokenHash string, token *model.UserToken) error
+	PopUserToken(ctx context.Context, tokenHash string) (*model.UserToken, error)
+	RemoveUserTokensBefore(ctx context.Context, timestamp int64) error
+
+	InsertSession(ctx context.Context, session *model.Session) error
+	GetSession(ctx context.Context, sessionId string) (*model.Session, error)
+	GetSessionsByLogin(ctx context.Context, login string) ([]*model.Session, error)
+	CountSessions(ctx context.Context, usedAfter, createdAfter int64) (int, error)
+	RotateSession(ctx context.Context, session *model.Session, prevGeneration int64) error
+	RemoveSession(ctx context.Context, sessionId string) error
+	RemoveSessionsByLogin(ctx context.Context, login, exceptSessionId string) error
+
+	InsertApiKey(ctx context.Context, key *model.ApiKey) error
+	GetApiKey(ctx context.Context, keyId string) (*model.ApiKey, error)
+	GetApiKeysByLogin(ctx context.Context, login string) ([]*model.ApiKey, error)
+	TouchApiKey(ctx context.Context, keyId string, lastUsed int64) error
+	RemoveApiKey(ctx context.Context, keyId string) error
+	RemoveApiKeysByLogin(ctx context.Context, login string) error
 }
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"nocalendar/internal/app/auth"
 	"nocalendar/internal/app/errors"
@@ -25,28 +26,28 @@ func NewAuthRepository(mongo *db.Database, logger *logrus.Logger) auth.AuthRepos
 	}
 }
 
-func (ar *AuthRepository) userToBson(usr *model.User) (*bson.M, error) {
+func (ar *AuthRepository) userToBson(ctx context.Context, usr *model.User) (*bson.M, error) {
 	data, err := bson.Marshal(usr)
 	if err != nil {
-		ar.logger.Warnf("[requestToBson] cannot marshal request: %s", err.Error())
-		return nil, errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[userToBson] cannot marshal request: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
 	}
 
 	doc := &bson.M{}
 	err = bson.Unmarshal(data, doc)
 	if err != nil {
-		ar.logger.Warnf("[requestToBson] cannot unmarshal: %s", err.Error())
-		return nil, errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[userToBson] cannot unmarshal: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
 	}
 	return doc, nil
 }
 
-func (ar *AuthRepository) insertUser(usr *model.User) (*model.User, error) {
+func (ar *AuthRepository) insertUser(ctx context.Context, usr *model.User) (*model.User, error) {
 	filter := bson.M{
-		"_id": "json/users",
+		"_id": ar.mongo.Doc("json/users"),
 	}
 
-	doc, err := ar.userToBson(usr)
+	doc, err := ar.userToBson(ctx, usr)
 	if err != nil {
 		return nil, err
 	}
@@ -57,44 +58,29 @@ func (ar *AuthRepository) insertUser(usr *model.User) (*model.User, error) {
 		},
 	}
 
-	_, err = ar.mongo.Conn.UpdateOne(ar.mongo.Ctx, filter, body)
+	_, err = ar.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		ar.logger.Warnf("[insertUser] UpdateOne: %s", err.Error())
-		return usr, errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[insertUser] UpdateOne: %s", err.Error())
+		return usr, db.StorageError(ctx, err)
 	}
 	return usr, nil
 }
 
-func (ar *AuthRepository) insertToken(login, token string) error {
-	filter := bson.M{
-		"_id": "json/tokens",
-	}
-
-	body := bson.M{
-		"$set": bson.M{
-			fmt.Sprintf("tokens.%s", token): login,
-		},
-	}
+func (ar *AuthRepository) Insert(ctx context.Context, usr *model.User) (*model.User, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "Insert")
+	defer end()
 
-	_, err := ar.mongo.Conn.UpdateOne(ar.mongo.Ctx, filter, body)
-	if err != nil {
-		ar.logger.Warnf("[insertToken] UpdateOne: %s", err.Error())
-		return errors.InternalError
-	}
-	return nil
+	return ar.insertUser(ctx, usr)
 }
 
-func (ar *AuthRepository) Insert(usr *model.User) (*model.User, error) {
-	usr, err := ar.insertUser(usr)
-	if err != nil {
-		return nil, err
+func (ar *AuthRepository) existEmail(ctx context.Context, email string) (bool, error) {
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": ar.mongo.Doc("json/users"),
+		},
 	}
-	err = ar.insertToken(usr.Login, usr.Token)
-	return usr, err
-}
 
-func (ar *AuthRepository) existEmail(email string) (bool, error) {
-	step1 := bson.M{
+	step2 := bson.M{
 		"$project": bson.M{
 			"users": bson.M{
 				"$objectToArray": "$users",
@@ -102,13 +88,13 @@ func (ar *AuthRepository) existEmail(email string) (bool, error) {
 		},
 	}
 
-	step2 := bson.M{
+	step3 := bson.M{
 		"$match": bson.M{
 			"users.v.email": email,
 		},
 	}
 
-	step3 := bson.M{
+	step4 := bson.M{
 		"$project": bson.M{
 			"users": bson.M{
 				"$arrayToObject": "$users",
@@ -116,24 +102,24 @@ func (ar *AuthRepository) existEmail(email string) (bool, error) {
 		},
 	}
 
-	pipeline := []bson.M{step1, step2, step3}
-	cursor, err := ar.mongo.Conn.Aggregate(ar.mongo.Ctx, pipeline)
+	pipeline := []bson.M{step1, step2, step3, step4}
+	cursor, err := ar.mongo.Conn.Aggregate(ctx, pipeline)
 	if err != nil {
-		ar.logger.Warnf("[checkEmail] Aggregate: %s", err.Error())
-		return false, errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[existEmail] Aggregate: %s", err.Error())
+		return false, db.StorageError(ctx, err)
 	}
-	defer cursor.Close(ar.mongo.Ctx)
+	defer cursor.Close(ctx)
 
 	doc := make([]*bson.M, 0)
-	err = cursor.All(ar.mongo.Ctx, &doc)
+	err = cursor.All(ctx, &doc)
 	if err != nil {
-		ar.logger.Warnf("[checkEmail] cursor.All: %s", err.Error())
-		return false, errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[existEmail] cursor.All: %s", err.Error())
+		return false, db.StorageError(ctx, err)
 	}
 
 	if err := cursor.Err(); err != nil {
-		ar.logger.Warnf("[checkEmail] cursor.Err: %s", err.Error())
-		return false, errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[existEmail] cursor.Err: %s", err.Error())
+		return false, db.StorageError(ctx, err)
 	}
 
 	if len(doc) == 0 {
@@ -142,18 +128,21 @@ func (ar *AuthRepository) existEmail(email string) (bool, error) {
 	return true, nil
 }
 
-func (ar *AuthRepository) CheckUser(usr *model.User) (bool, error) {
-	_, err := ar.GetUser(usr.Login)
+func (ar *AuthRepository) CheckUser(ctx context.Context, usr *model.User) (bool, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "CheckUser")
+	defer end()
+
+	_, err := ar.GetUser(ctx, usr.Login)
 	switch err {
 	case nil:
 		return false, errors.LoginAlreadyExists
 	case errors.UserNotFound:
 		break
 	default:
-		return false, errors.InternalError
+		return false, db.StorageError(ctx, err)
 	}
 
-	exist, err := ar.existEmail(usr.Email)
+	exist, err := ar.existEmail(ctx, usr.Email)
 	if err != nil {
 		return false, err
 	}
@@ -165,40 +154,783 @@ func (ar *AuthRepository) CheckUser(usr *model.User) (bool, error) {
 	return true, nil
 }
 
-func (ar *AuthRepository) GetUser(login string) (*model.User, error) {
+func (ar *AuthRepository) GetUser(ctx context.Context, login string) (*model.User, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetUser")
+	defer end()
+
 	doc := &model.JsonUser{}
 	opts := options.FindOne()
 	opts.SetProjection(bson.M{fmt.Sprintf("users.%s", login): 1})
-	err := ar.mongo.Conn.FindOne(ar.mongo.Ctx, bson.M{"_id": "json/users"}, opts).Decode(doc)
+	err := ar.mongo.Conn.FindOne(ctx, bson.M{"_id": ar.mongo.Doc("json/users")}, opts).Decode(doc)
 	switch err {
 	case nil:
-		if len(doc.Users) == 0 {
+		usr, ok := doc.Users[login]
+		if !ok {
 			return nil, errors.UserNotFound
 		}
-		usr := doc.Users[login]
 		return &usr, err
 	case mongo.ErrNoDocuments:
 		return nil, errors.UserNotFound
 	default:
-		return nil, errors.InternalError
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (ar *AuthRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetUserByEmail")
+	defer end()
+
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": ar.mongo.Doc("json/users"),
+		},
+	}
+
+	step2 := bson.M{
+		"$project": bson.M{
+			"users": bson.M{
+				"$objectToArray": "$users",
+			},
+		},
+	}
+
+	step3 := bson.M{
+		"$unwind": "$users",
+	}
+
+	step4 := bson.M{
+		"$match": bson.M{
+			"users.v.email": email,
+		},
+	}
+
+	step5 := bson.M{
+		"$replaceRoot": bson.M{
+			"newRoot": "$users.v",
+		},
+	}
+
+	pipeline := []bson.M{step1, step2, step3, step4, step5}
+	cursor, err := ar.mongo.Conn.Aggregate(ctx, pipeline)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[GetUserByEmail] Aggregate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	users := make([]*model.User, 0)
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[GetUserByEmail] All: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+
+	if len(users) == 0 {
+		return nil, errors.UserNotFound
+	}
+	return users[0], nil
+}
+
+// findUsers returns users matching filter on fields of user, e.g. users.v.hidden
+func (ar *AuthRepository) findUsers(ctx context.Context, method string, match bson.M) ([]*model.User, error) {
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": ar.mongo.Doc("json/users"),
+		},
+	}
+
+	step2 := bson.M{
+		"$project": bson.M{
+			"users": bson.M{
+				"$objectToArray": "$users",
+			},
+		},
+	}
+
+	step3 := bson.M{
+		"$unwind": "$users",
+	}
+
+	match["users.k"] = bson.M{"$ne": "nocalender_user_init"}
+	step4 := bson.M{
+		"$match": match,
+	}
+
+	step5 := bson.M{
+		"$replaceRoot": bson.M{
+			"newRoot": "$users.v",
+		},
+	}
+
+	pipeline := []bson.M{step1, step2, step3, step4, step5}
+	cursor, err := ar.mongo.Conn.Aggregate(ctx, pipeline)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[%s] Aggregate: %s", method, err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	users := make([]*model.User, 0)
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[%s] All: %s", method, err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	return users, nil
+}
+
+// GetDirectoryUsers returns all users who did not hide themselves from directory
+func (ar *AuthRepository) GetDirectoryUsers(ctx context.Context) ([]*model.User, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetDirectoryUsers")
+	defer end()
+
+	return ar.findUsers(ctx, "GetDirectoryUsers", bson.M{"users.v.hidden": bson.M{"$ne": true}})
+}
+
+func (ar *AuthRepository) GetUsers(ctx context.Context) ([]*model.User, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetUsers")
+	defer end()
+
+	return ar.findUsers(ctx, "GetUsers", bson.M{})
+}
+
+func (ar *AuthRepository) RemoveUser(ctx context.Context, login string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RemoveUser")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/users"),
+	}
+
+	body := bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("users.%s", login): "",
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveUser] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) updateUserField(ctx context.Context, field string, value interface{}) error {
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/users"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			field: value,
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[updateUserField] UpdateOne %s: %s", field, err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) UpdatePassword(ctx context.Context, login, password string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "UpdatePassword")
+	defer end()
+
+	return ar.updateUserField(ctx, fmt.Sprintf("users.%s.password", login), password)
+}
+
+func (ar *AuthRepository) SetEmailVerified(ctx context.Context, login string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "SetEmailVerified")
+	defer end()
+
+	return ar.updateUserField(ctx, fmt.Sprintf("users.%s.email_verified", login), true)
+}
+
+func (ar *AuthRepository) SetRole(ctx context.Context, login, role string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "SetRole")
+	defer end()
+
+	return ar.updateUserField(ctx, fmt.Sprintf("users.%s.role", login), role)
+}
+
+func (ar *AuthRepository) SetSuspended(ctx context.Context, login string, suspended bool) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "SetSuspended")
+	defer end()
+
+	return ar.updateUserField(ctx, fmt.Sprintf("users.%s.suspended", login), suspended)
+}
+
+// SetTotp stores new secret, enabled secret is stored only after user confirmed it
+func (ar *AuthRepository) SetTotp(ctx context.Context, login, secret string, enabled bool) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "SetTotp")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/users"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("users.%s.totp_secret", login):    secret,
+			fmt.Sprintf("users.%s.totp_enabled", login):   enabled,
+			fmt.Sprintf("users.%s.totp_last_step", login): int64(0),
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[SetTotp] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+// UseTotpStep remembers step of used code only if no newer code was used concurrently
+func (ar *AuthRepository) UseTotpStep(ctx context.Context, login string, step int64) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "UseTotpStep")
+	defer end()
+
+	key := fmt.Sprintf("users.%s.totp_last_step", login)
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/users"),
+	}
+	filter[key] = bson.M{"$lt": step}
+
+	body := bson.M{
+		"$set": bson.M{
+			key: step,
+		},
+	}
+
+	res, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[UseTotpStep] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	if res.MatchedCount == 0 {
+		return errors.BadTotpCode
+	}
+	return nil
+}
+
+func (ar *AuthRepository) SetRecoveryCodes(ctx context.Context, login string, hashes []string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "SetRecoveryCodes")
+	defer end()
+
+	return ar.updateUserField(ctx, fmt.Sprintf("users.%s.recovery_codes", login), hashes)
+}
+
+// UseRecoveryCode removes code, it fails if code was not found or was used concurrently
+func (ar *AuthRepository) UseRecoveryCode(ctx context.Context, login, hash string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "UseRecoveryCode")
+	defer end()
+
+	key := fmt.Sprintf("users.%s.recovery_codes", login)
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/users"),
+	}
+	filter[key] = hash
+
+	body := bson.M{
+		"$pull": bson.M{
+			key: hash,
+		},
+	}
+
+	res, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[UseRecoveryCode] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	if res.ModifiedCount == 0 {
+		return errors.BadTotpCode
+	}
+	return nil
+}
+
+func (ar *AuthRepository) InsertUserToken(ctx context.Context, tokenHash string, token *model.UserToken) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "InsertUserToken")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/user_tokens"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("user_tokens.%s", tokenHash): token,
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[InsertUserToken] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+// PopUserToken atomically returns and removes token, so each token can be used only once
+func (ar *AuthRepository) PopUserToken(ctx context.Context, tokenHash string) (*model.UserToken, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "PopUserToken")
+	defer end()
+
+	key := fmt.Sprintf("user_tokens.%s", tokenHash)
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/user_tokens"),
+	}
+	filter[key] = bson.M{"$exists": true}
+
+	body := bson.M{
+		"$unset": bson.M{
+			key: "",
+		},
+	}
+
+	opts := options.FindOneAndUpdate()
+	opts.SetProjection(bson.M{key: 1})
+	opts.SetReturnDocument(options.Before)
+
+	doc := &model.BsonUserTokens{}
+	err := ar.mongo.Conn.FindOneAndUpdate(ctx, filter, body, opts).Decode(doc)
+	switch err {
+	case nil:
+		token, ok := doc.Tokens[tokenHash]
+		if !ok {
+			return nil, errors.BadUserToken
+		}
+		return token, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.BadUserToken
+	default:
+		ar.logger.WithContext(ctx).Warnf("[PopUserToken] FindOneAndUpdate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (ar *AuthRepository) RemoveUserTokensBefore(ctx context.Context, timestamp int64) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RemoveUserTokensBefore")
+	defer end()
+
+	doc := &model.BsonUserTokens{}
+	err := ar.mongo.Conn.FindOne(ctx, bson.M{"_id": ar.mongo.Doc("json/user_tokens")}).Decode(doc)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveUserTokensBefore] FindOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	unset := bson.M{}
+	for tokenHash, token := range doc.Tokens {
+		if token.ExpiresAt < timestamp {
+			unset[fmt.Sprintf("user_tokens.%s", tokenHash)] = ""
+		}
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+
+	_, err = ar.mongo.Conn.UpdateOne(ctx, bson.M{"_id": ar.mongo.Doc("json/user_tokens")}, bson.M{"$unset": unset})
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveUserTokensBefore] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) InsertSession(ctx context.Context, session *model.Session) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "InsertSession")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/sessions"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("sessions.%s", session.Id): session,
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[InsertSession] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) GetSession(ctx context.Context, sessionId string) (*model.Session, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetSession")
+	defer end()
+
+	doc := &model.BsonSessions{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("sessions.%s", sessionId): 1})
+	err := ar.mongo.Conn.FindOne(ctx, bson.M{"_id": ar.mongo.Doc("json/sessions")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		session, ok := doc.Sessions[sessionId]
+		if !ok {
+			return nil, errors.SessionNotFound
+		}
+		return session, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.SessionNotFound
+	default:
+		ar.logger.WithContext(ctx).Warnf("[GetSession] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
 	}
 }
 
-func (ar *AuthRepository) GetLoginByToken(token string) (string, error) {
-	doc := &model.JsonTokens{}
+func (ar *AuthRepository) GetSessionsByLogin(ctx context.Context, login string) ([]*model.Session, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetSessionsByLogin")
+	defer end()
+
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": ar.mongo.Doc("json/sessions"),
+		},
+	}
+
+	step2 := bson.M{
+		"$project": bson.M{
+			"sessions": bson.M{
+				"$objectToArray": "$sessions",
+			},
+		},
+	}
+
+	step3 := bson.M{
+		"$unwind": "$sessions",
+	}
+
+	step4 := bson.M{
+		"$match": bson.M{
+			"sessions.v.login": login,
+		},
+	}
+
+	step5 := bson.M{
+		"$replaceRoot": bson.M{
+			"newRoot": "$sessions.v",
+		},
+	}
+
+	pipeline := []bson.M{step1, step2, step3, step4, step5}
+	cursor, err := ar.mongo.Conn.Aggregate(ctx, pipeline)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[GetSessionsByLogin] Aggregate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := make([]*model.Session, 0)
+	err = cursor.All(ctx, &sessions)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[GetSessionsByLogin] All: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	return sessions, nil
+}
+
+// CountSessions counts sessions used since usedAfter and created since createdAfter
+func (ar *AuthRepository) CountSessions(ctx context.Context, usedAfter, createdAfter int64) (int, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "CountSessions")
+	defer end()
+
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": ar.mongo.Doc("json/sessions"),
+		},
+	}
+
+	step2 := bson.M{
+		"$project": bson.M{
+			"sessions": bson.M{
+				"$objectToArray": "$sessions",
+			},
+		},
+	}
+
+	step3 := bson.M{
+		"$unwind": "$sessions",
+	}
+
+	step4 := bson.M{
+		"$match": bson.M{
+			"sessions.v.last_used":  bson.M{"$gte": usedAfter},
+			"sessions.v.created_at": bson.M{"$gte": createdAfter},
+		},
+	}
+
+	step5 := bson.M{
+		"$count": "count",
+	}
+
+	pipeline := []bson.M{step1, step2, step3, step4, step5}
+	cursor, err := ar.mongo.Conn.Aggregate(ctx, pipeline)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[CountSessions] Aggregate: %s", err.Error())
+		return 0, db.StorageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	// $count returns nothing instead of zero
+	result := make([]struct {
+		Count int `bson:"count"`
+	}, 0)
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[CountSessions] All: %s", err.Error())
+		return 0, db.StorageError(ctx, err)
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Count, nil
+}
+
+// RotateSession stores session only if nobody has rotated it since prevGeneration was read
+func (ar *AuthRepository) RotateSession(ctx context.Context, session *model.Session, prevGeneration int64) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RotateSession")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/sessions"),
+	}
+	filter[fmt.Sprintf("sessions.%s.generation", session.Id)] = prevGeneration
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("sessions.%s", session.Id): session,
+		},
+	}
+
+	res, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RotateSession] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	if res.MatchedCount == 0 {
+		return errors.RefreshReused
+	}
+	return nil
+}
+
+func (ar *AuthRepository) RemoveSession(ctx context.Context, sessionId string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RemoveSession")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/sessions"),
+	}
+
+	body := bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("sessions.%s", sessionId): "",
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveSession] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) RemoveSessionsByLogin(ctx context.Context, login, exceptSessionId string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RemoveSessionsByLogin")
+	defer end()
+
+	sessions, err := ar.GetSessionsByLogin(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	unset := bson.M{}
+	for _, session := range sessions {
+		if session.Id != exceptSessionId {
+			unset[fmt.Sprintf("sessions.%s", session.Id)] = ""
+		}
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+
+	_, err = ar.mongo.Conn.UpdateOne(ctx, bson.M{"_id": ar.mongo.Doc("json/sessions")}, bson.M{"$unset": unset})
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveSessionsByLogin] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) InsertApiKey(ctx context.Context, key *model.ApiKey) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "InsertApiKey")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/api_keys"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("api_keys.%s", key.Id): key,
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[InsertApiKey] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) GetApiKey(ctx context.Context, keyId string) (*model.ApiKey, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetApiKey")
+	defer end()
+
+	doc := &model.BsonApiKeys{}
 	opts := options.FindOne()
-	opts.SetProjection(bson.M{fmt.Sprintf("tokens.%s", token): 1})
-	err := ar.mongo.Conn.FindOne(ar.mongo.Ctx, bson.M{"_id": "json/tokens"}, opts).Decode(doc)
+	opts.SetProjection(bson.M{fmt.Sprintf("api_keys.%s", keyId): 1})
+	err := ar.mongo.Conn.FindOne(ctx, bson.M{"_id": ar.mongo.Doc("json/api_keys")}, opts).Decode(doc)
 	switch err {
 	case nil:
-		if len(doc.Tokens) == 0 {
-			return "", errors.UserNotFound
+		key, ok := doc.ApiKeys[keyId]
+		if !ok {
+			return nil, errors.ApiKeyNotFound
 		}
-		login := doc.Tokens[token]
-		return login, err
+		return key, nil
 	case mongo.ErrNoDocuments:
-		return "", errors.UserNotFound
+		return nil, errors.ApiKeyNotFound
 	default:
-		return "", errors.InternalError
+		ar.logger.WithContext(ctx).Warnf("[GetApiKey] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (ar *AuthRepository) GetApiKeysByLogin(ctx context.Context, login string) ([]*model.ApiKey, error) {
+	ctx, end := ar.mongo.Call(ctx, "auth", "GetApiKeysByLogin")
+	defer end()
+
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": ar.mongo.Doc("json/api_keys"),
+		},
+	}
+
+	step2 := bson.M{
+		"$project": bson.M{
+			"api_keys": bson.M{
+				"$objectToArray": "$api_keys",
+			},
+		},
+	}
+
+	step3 := bson.M{
+		"$unwind": "$api_keys",
+	}
+
+	step4 := bson.M{
+		"$match": bson.M{
+			"api_keys.v.login": login,
+		},
+	}
+
+	step5 := bson.M{
+		"$replaceRoot": bson.M{
+			"newRoot": "$api_keys.v",
+		},
+	}
+
+	pipeline := []bson.M{step1, step2, step3, step4, step5}
+	cursor, err := ar.mongo.Conn.Aggregate(ctx, pipeline)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[GetApiKeysByLogin] Aggregate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	keys := make([]*model.ApiKey, 0)
+	err = cursor.All(ctx, &keys)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[GetApiKeysByLogin] All: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	return keys, nil
+}
+
+func (ar *AuthRepository) TouchApiKey(ctx context.Context, keyId string, lastUsed int64) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "TouchApiKey")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/api_keys"),
+	}
+	filter[fmt.Sprintf("api_keys.%s", keyId)] = bson.M{"$exists": true}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("api_keys.%s.last_used", keyId): lastUsed,
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[TouchApiKey] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
+	return nil
+}
+
+func (ar *AuthRepository) RemoveApiKey(ctx context.Context, keyId string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RemoveApiKey")
+	defer end()
+
+	filter := bson.M{
+		"_id": ar.mongo.Doc("json/api_keys"),
+	}
+
+	body := bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("api_keys.%s", keyId): "",
+		},
+	}
+
+	_, err := ar.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveApiKey] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (ar *AuthRepository) RemoveApiKeysByLogin(ctx context.Context, login string) error {
+	ctx, end := ar.mongo.Call(ctx, "auth", "RemoveApiKeysByLogin")
+	defer end()
+
+	keys, err := ar.GetApiKeysByLogin(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	unset := bson.M{}
+	for _, key := range keys {
+		unset[fmt.Sprintf("api_keys.%s", key.Id)] = ""
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+
+	_, err = ar.mongo.Conn.UpdateOne(ctx, bson.M{"_id": ar.mongo.Doc("json/api_keys")}, bson.M{"$unset": unset})
+	if err != nil {
+		ar.logger.WithContext(ctx).Warnf("[RemoveApiKeysByLogin] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
 }
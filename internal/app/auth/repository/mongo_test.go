@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/db/dbtest"
+	"nocalendar/internal/model"
+	"testing"
+)
+
+func TestUsersAreIsolatedByOrg(t *testing.T) {
+	mongo := dbtest.NewDatabase(t)
+	logger := dbtest.Logger()
+	ctx := context.Background()
+	acme := NewAuthRepository(dbtest.NewOrgDatabase(t, mongo, "acme"), logger)
+	globex := NewAuthRepository(dbtest.NewOrgDatabase(t, mongo, "globex"), logger)
+
+	alice := &model.User{Login: "alice", Email: "shared@example.com", Password: "hash"}
+	if _, err := acme.Insert(ctx, alice); err != nil {
+		t.Fatalf("Insert: %s", err.Error())
+	}
+
+	// login and email are unique only inside organization
+	valid, err := globex.CheckUser(ctx, &model.User{Login: "alice", Email: "shared@example.com"})
+	if err != nil || !valid {
+		t.Fatalf("CheckUser in other org = %v, %v, want true, nil", valid, err)
+	}
+	valid, err = acme.CheckUser(ctx, &model.User{Login: "alice2", Email: "shared@example.com"})
+	if err != errors.EmailAlreadyExists || valid {
+		t.Fatalf("CheckUser in same org = %v, %v, want false, %v", valid, err, errors.EmailAlreadyExists)
+	}
+	valid, err = acme.CheckUser(ctx, &model.User{Login: "alice", Email: "other@example.com"})
+	if err != errors.LoginAlreadyExists || valid {
+		t.Fatalf("CheckUser in same org = %v, %v, want false, %v", valid, err, errors.LoginAlreadyExists)
+	}
+
+	if _, err := globex.GetUser(ctx, "alice"); err != errors.UserNotFound {
+		t.Errorf("GetUser in other org = %v, want %v", err, errors.UserNotFound)
+	}
+	if _, err := globex.GetUserByEmail(ctx, "shared@example.com"); err != errors.UserNotFound {
+		t.Errorf("GetUserByEmail in other org = %v, want %v", err, errors.UserNotFound)
+	}
+	users, err := globex.GetUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetUsers: %s", err.Error())
+	}
+	for _, usr := range users {
+		if usr.Login == "alice" {
+			t.Errorf("GetUsers in other org returned alice")
+		}
+	}
+
+	// the same login in other organization is other user
+	bob := &model.User{Login: "alice", Email: "shared@example.com", Password: "other hash"}
+	if _, err := globex.Insert(ctx, bob); err != nil {
+		t.Fatalf("Insert in other org: %s", err.Error())
+	}
+	usr, err := acme.GetUser(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUser: %s", err.Error())
+	}
+	if usr.Password != "hash" {
+		t.Errorf("user of other org replaced user of acme")
+	}
+}
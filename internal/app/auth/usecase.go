@@ -1,9 +1,46 @@
 package auth
 
-import "nocalendar/internal/model"
+import (
+	"context"
+	"nocalendar/internal/model"
+)
 
 type AuthUsecase interface {
-	GetUser(usr *model.Auth) (*model.User, error)
-	GetUserByToken(token string) (*model.User, error)
-	CreateUser(usr *model.User) (string, error)
+	GetUser(ctx context.Context, usr *model.Auth) (*model.User, error)
+	GetProfile(ctx context.Context, login string) (*model.User, error)
+	UpdateProfile(ctx context.Context, login string, update *model.ProfileUpdate) (*model.User, error)
+	RemoveUser(ctx context.Context, login string) error
+	SearchUsers(ctx context.Context, query string, offset, limit int) (*model.JsonUsers, error)
+	CheckAccessToken(token string) (*model.User, *model.Session, error)
+	CheckApiKey(ctx context.Context, key string) (*model.User, *model.ApiKey, error)
+	CreateUser(ctx context.Context, usr *model.User, device string) (*model.Tokens, error)
+
+	CreateSession(ctx context.Context, login, device string) (*model.Tokens, error)
+	RefreshSession(ctx context.Context, refreshToken string) (*model.Tokens, error)
+	GetSessions(ctx context.Context, login, currentSessionId string) (*model.JsonSessions, error)
+	CountActiveSessions(ctx context.Context) (int, error)
+	RemoveSession(ctx context.Context, login, sessionId string) error
+
+	CreateMfaChallenge(login string) (*model.MfaChallenge, error)
+	ParseMfaToken(token string) (string, error)
+	CheckSecondFactor(ctx context.Context, login string, request *model.SecondFactorRequest) (*model.User, error)
+	EnrollTotp(ctx context.Context, login string) (*model.TotpEnrollment, error)
+	ConfirmTotp(ctx context.Context, login, code string) (*model.RecoveryCodes, error)
+	DisableTotp(ctx context.Context, login string, request *model.TotpRequest) error
+	RegenerateRecoveryCodes(ctx context.Context, login, code string) (*model.RecoveryCodes, error)
+
+	CreateApiKey(ctx context.Context, login string, request *model.ApiKeyRequest) (*model.CreatedApiKey, error)
+	GetApiKeys(ctx context.Context, login string) (*model.JsonApiKeys, error)
+	RemoveApiKey(ctx context.Context, login, keyId string) error
+
+	SendVerification(ctx context.Context, login string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ChangePassword(ctx context.Context, login, sessionId, oldPassword, newPassword string) error
+
+	GetUsers(ctx context.Context, offset, limit int) (*model.JsonAdminUsers, error)
+	SetRole(ctx context.Context, login, role string) error
+	SetSuspended(ctx context.Context, login string, suspended bool) error
+	RemoveSessions(ctx context.Context, login string) error
 }
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"sort"
+)
+
+// GetUsers returns page of all users of organization ordered by login, hidden and
+// suspended ones included
+func (au *AuthUsecase) GetUsers(ctx context.Context, offset, limit int) (*model.JsonAdminUsers, error) {
+	ctx, span := tracing.Start(ctx, "auth.GetUsers")
+	defer span.End()
+
+	if offset < 0 || limit < 0 {
+		return nil, errors.BadPagination
+	}
+	if limit == 0 {
+		limit = model.DEFAULT_SEARCH_LIMIT
+	}
+	if limit > model.MAX_SEARCH_LIMIT {
+		limit = model.MAX_SEARCH_LIMIT
+	}
+
+	users, err := au.repo.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Login < users[j].Login
+	})
+
+	result := &model.JsonAdminUsers{
+		Users: make([]*model.AdminUser, 0),
+		Total: len(users),
+	}
+	for i := offset; i < len(users) && i < offset+limit; i++ {
+		result.Users = append(result.Users, users[i].ForAdmin())
+	}
+	return result, nil
+}
+
+func (au *AuthUsecase) SetRole(ctx context.Context, login, role string) error {
+	ctx, span := tracing.Start(ctx, "auth.SetRole")
+	defer span.End()
+
+	if !model.IsValidUserRole(role) {
+		return errors.BadRole
+	}
+
+	_, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+	return au.repo.SetRole(ctx, login, role)
+}
+
+// SetSuspended blocks or unblocks login of user. Suspension also ends all sessions,
+// api keys are kept but rejected while user is suspended
+func (au *AuthUsecase) SetSuspended(ctx context.Context, login string, suspended bool) error {
+	ctx, span := tracing.Start(ctx, "auth.SetSuspended")
+	defer span.End()
+
+	_, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	err = au.repo.SetSuspended(ctx, login, suspended)
+	if err != nil {
+		return err
+	}
+	if !suspended {
+		return nil
+	}
+	return au.repo.RemoveSessionsByLogin(ctx, login, "")
+}
+
+// RemoveSessions ends all sessions of user, access tokens already issued expire on their own
+func (au *AuthUsecase) RemoveSessions(ctx context.Context, login string) error {
+	ctx, span := tracing.Start(ctx, "auth.RemoveSessions")
+	defer span.End()
+
+	_, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+	return au.repo.RemoveSessionsByLogin(ctx, login, "")
+}
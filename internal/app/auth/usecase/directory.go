@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/util"
+	"sort"
+	"strings"
+)
+
+type scoredUser struct {
+	usr   *model.User
+	score int
+}
+
+// SearchUsers looks for query in login, name, surname and email of visible users.
+// Best matches go first, users with equal score are ordered by login
+func (au *AuthUsecase) SearchUsers(ctx context.Context, query string, offset, limit int) (*model.JsonUsers, error) {
+	ctx, span := tracing.Start(ctx, "auth.SearchUsers")
+	defer span.End()
+
+	query = strings.TrimSpace(query)
+	if query == "" || len(query) > model.MAX_SEARCH_QUERY_LENGTH || offset < 0 || limit < 0 {
+		return nil, errors.BadSearchQuery
+	}
+	if limit == 0 {
+		limit = model.DEFAULT_SEARCH_LIMIT
+	}
+	if limit > model.MAX_SEARCH_LIMIT {
+		limit = model.MAX_SEARCH_LIMIT
+	}
+
+	users, err := au.repo.GetDirectoryUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]scoredUser, 0)
+	for _, usr := range users {
+		score := bestScore(query, usr.Login, usr.Name, usr.Surname, usr.Email, usr.Name+" "+usr.Surname)
+		if score == util.NoMatch {
+			continue
+		}
+		found = append(found, scoredUser{usr: usr, score: score})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score < found[j].score
+		}
+		return found[i].usr.Login < found[j].usr.Login
+	})
+
+	result := &model.JsonUsers{
+		Users: make([]*model.UserWithoutPassword, 0),
+		Total: len(found),
+	}
+	for i := offset; i < len(found) && i < offset+limit; i++ {
+		result.Users = append(result.Users, found[i].usr.WithoutPassword())
+	}
+	return result, nil
+}
+
+func bestScore(query string, values ...string) int {
+	best := util.NoMatch
+	for _, value := range values {
+		score := util.MatchScore(query, value)
+		if score != util.NoMatch && (best == util.NoMatch || score < best) {
+			best = score
+		}
+	}
+	return best
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/validation"
+	"strings"
+)
+
+func (au *AuthUsecase) GetProfile(ctx context.Context, login string) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "auth.GetProfile")
+	defer span.End()
+
+	return au.repo.GetUser(ctx, login)
+}
+
+// UpdateProfile changes name, surname, email and directory visibility. New email has to be verified again
+func (au *AuthUsecase) UpdateProfile(ctx context.Context, login string, update *model.ProfileUpdate) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "auth.UpdateProfile")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		usr.Name = *update.Name
+	}
+	if update.Surname != nil {
+		usr.Surname = *update.Surname
+	}
+	if update.Hidden != nil {
+		usr.Hidden = *update.Hidden
+	}
+
+	v := validation.NewValidator()
+	v.Length("name", usr.Name, 0, model.MAX_NAME_LENGTH)
+	v.Length("surname", usr.Surname, 0, model.MAX_NAME_LENGTH)
+	err = v.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	emailChanged := false
+	if update.Email != nil && *update.Email != usr.Email {
+		email := strings.TrimSpace(*update.Email)
+		if !strings.Contains(email, "@") {
+			return nil, errors.BadProfile
+		}
+
+		_, err = au.repo.GetUserByEmail(ctx, email)
+		switch err {
+		case nil:
+			return nil, errors.EmailAlreadyExists
+		case errors.UserNotFound:
+			break
+		default:
+			return nil, err
+		}
+
+		usr.Email = email
+		usr.EmailVerified = false
+		emailChanged = true
+	}
+
+	usr, err = au.repo.Insert(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		err = au.sendVerification(ctx, usr)
+		if err != nil {
+			au.logger.WithContext(ctx).Warnf("[UpdateProfile] verification not sent to %s: %s", login, err.Error())
+		}
+	}
+	return usr, nil
+}
+
+// RemoveUser removes user with all sessions and api keys
+func (au *AuthUsecase) RemoveUser(ctx context.Context, login string) error {
+	ctx, span := tracing.Start(ctx, "auth.RemoveUser")
+	defer span.End()
+
+	err := au.repo.RemoveSessionsByLogin(ctx, login, "")
+	if err != nil {
+		return err
+	}
+
+	err = au.repo.RemoveApiKeysByLogin(ctx, login)
+	if err != nil {
+		return err
+	}
+	return au.repo.RemoveUser(ctx, login)
+}
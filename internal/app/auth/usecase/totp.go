@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/totp"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/util"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// isRestricted reports whether session of user must be limited to enrollment of second factor
+func (au *AuthUsecase) isRestricted(usr *model.User) bool {
+	return au.require2fa && !usr.TotpEnabled
+}
+
+// CreateMfaChallenge returns short-lived token which proves that password was correct
+func (au *AuthUsecase) CreateMfaChallenge(login string) (*model.MfaChallenge, error) {
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		Issuer:    au.org.Id,
+		Subject:   login,
+		Audience:  jwt.ClaimStrings{model.MFA_AUDIENCE},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(model.MFA_TOKEN_TTL) * time.Second)),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(au.secret)
+	if err != nil {
+		au.logger.Warnf("[CreateMfaChallenge] cannot sign mfa token: %s", err.Error())
+		return nil, errors.InternalError
+	}
+	return &model.MfaChallenge{MfaToken: token}, nil
+}
+
+func (au *AuthUsecase) ParseMfaToken(token string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.BadMfaToken
+		}
+		return au.secret, nil
+	})
+	if err != nil || claims.Subject == "" || claims.Issuer != au.org.Id || !claims.VerifyAudience(model.MFA_AUDIENCE, true) {
+		return "", errors.BadMfaToken
+	}
+	return claims.Subject, nil
+}
+
+// checkTotp validates code and marks it as used
+func (au *AuthUsecase) checkTotp(ctx context.Context, usr *model.User, code string) error {
+	step, ok := totp.Validate(usr.TotpSecret, code, time.Now(), usr.TotpLastStep)
+	if !ok {
+		return errors.BadTotpCode
+	}
+	return au.repo.UseTotpStep(ctx, usr.Login, step)
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// CheckSecondFactor accepts either one-time code or recovery code, recovery code is removed after use
+func (au *AuthUsecase) CheckSecondFactor(ctx context.Context, login string, request *model.SecondFactorRequest) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "auth.CheckSecondFactor")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if !usr.TotpEnabled {
+		return nil, errors.BadMfaToken
+	}
+
+	if request.RecoveryCode != "" {
+		err = au.repo.UseRecoveryCode(ctx, login, util.HashToken(normalizeRecoveryCode(request.RecoveryCode)))
+	} else {
+		err = au.checkTotp(ctx, usr, request.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+// EnrollTotp generates new secret, it is not used until user confirms it with code
+func (au *AuthUsecase) EnrollTotp(ctx context.Context, login string) (*model.TotpEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "auth.EnrollTotp")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if usr.TotpEnabled {
+		return nil, errors.TotpAlreadyEnabled
+	}
+
+	secret := totp.GenerateSecret()
+	err = au.repo.SetTotp(ctx, login, secret, false)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TotpEnrollment{
+		Secret: secret,
+		Uri:    totp.ProvisioningUri(model.TOTP_ISSUER, login, secret),
+	}, nil
+}
+
+func (au *AuthUsecase) generateRecoveryCodes(ctx context.Context, login string) (*model.RecoveryCodes, error) {
+	codes := make([]string, 0, model.NUMBER_OF_RECOVERY_CODES)
+	hashes := make([]string, 0, model.NUMBER_OF_RECOVERY_CODES)
+	half := model.LENGTH_OF_RECOVERY_CODE / 2
+	for i := 0; i < model.NUMBER_OF_RECOVERY_CODES; i++ {
+		code := strings.ToLower(util.GenerateSecureString(model.LENGTH_OF_RECOVERY_CODE))
+		codes = append(codes, code[:half]+"-"+code[half:])
+		hashes = append(hashes, util.HashToken(code))
+	}
+
+	err := au.repo.SetRecoveryCodes(ctx, login, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return &model.RecoveryCodes{Codes: codes}, nil
+}
+
+// ConfirmTotp enables second factor and returns recovery codes, they are shown only once
+func (au *AuthUsecase) ConfirmTotp(ctx context.Context, login, code string) (*model.RecoveryCodes, error) {
+	ctx, span := tracing.Start(ctx, "auth.ConfirmTotp")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if usr.TotpEnabled {
+		return nil, errors.TotpAlreadyEnabled
+	}
+	if usr.TotpSecret == "" {
+		return nil, errors.TotpNotEnabled
+	}
+
+	step, ok := totp.Validate(usr.TotpSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, errors.BadTotpCode
+	}
+
+	err = au.repo.SetTotp(ctx, login, usr.TotpSecret, true)
+	if err != nil {
+		return nil, err
+	}
+	err = au.repo.UseTotpStep(ctx, login, step)
+	if err != nil {
+		return nil, err
+	}
+	return au.generateRecoveryCodes(ctx, login)
+}
+
+func (au *AuthUsecase) DisableTotp(ctx context.Context, login string, request *model.TotpRequest) error {
+	ctx, span := tracing.Start(ctx, "auth.DisableTotp")
+	defer span.End()
+
+	if au.require2fa {
+		return errors.TotpRequired
+	}
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+	if !usr.TotpEnabled {
+		return errors.TotpNotEnabled
+	}
+
+	err = checkPassword(request.Password, usr.Password)
+	if err != nil {
+		return err
+	}
+	err = au.checkTotp(ctx, usr, request.Code)
+	if err != nil {
+		return err
+	}
+
+	err = au.repo.SetTotp(ctx, login, "", false)
+	if err != nil {
+		return err
+	}
+	return au.repo.SetRecoveryCodes(ctx, login, []string{})
+}
+
+func (au *AuthUsecase) RegenerateRecoveryCodes(ctx context.Context, login, code string) (*model.RecoveryCodes, error) {
+	ctx, span := tracing.Start(ctx, "auth.RegenerateRecoveryCodes")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if !usr.TotpEnabled {
+		return nil, errors.TotpNotEnabled
+	}
+
+	err = au.checkTotp(ctx, usr, code)
+	if err != nil {
+		return nil, err
+	}
+	return au.generateRecoveryCodes(ctx, login)
+}
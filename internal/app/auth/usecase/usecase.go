@@ -1,42 +1,131 @@
 package usecase
 
 import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/mail"
 	"nocalendar/internal/app/auth"
 	"nocalendar/internal/app/errors"
+	"nocalendar/internal/config"
+	"nocalendar/internal/mailer"
 	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
 	"nocalendar/internal/util"
+	"nocalendar/internal/validation"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthUsecase struct {
-	repo   auth.AuthRepository
-	logger *logrus.Logger
+	repo       auth.AuthRepository
+	org        *model.Org
+	secret     []byte // key for signing access tokens
+	mailer     mailer.Mailer
+	appUrl     string // links in letters lead to web client
+	require2fa bool   // users without second factor get restricted sessions
+	bcryptCost int
+	dummyHash  []byte // compared with password of unknown user, so response time does not reveal logins
+	logger     *logrus.Logger
 }
 
-func NewAuthUsecase(repo auth.AuthRepository, logger *logrus.Logger) auth.AuthUsecase {
+// NewAuthUsecase serves users of org. Second factor is required if org or config demands it
+func NewAuthUsecase(repo auth.AuthRepository, org *model.Org, cfg config.AuthConfig, mailer mailer.Mailer,
+	logger *logrus.Logger) auth.AuthUsecase {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("nocalendar dummy password"), cfg.BcryptCost)
+	if err != nil {
+		logger.Fatalf("[NewAuthUsecase] cannot hash dummy password: %s", err.Error())
+	}
+
 	return &AuthUsecase{
-		repo:   repo,
-		logger: logger,
+		repo:       repo,
+		org:        org,
+		secret:     []byte(cfg.TokenSecret),
+		mailer:     mailer,
+		appUrl:     cfg.AppUrl,
+		require2fa: cfg.Require2fa || org.Require2fa,
+		bcryptCost: cfg.BcryptCost,
+		dummyHash:  dummyHash,
+		logger:     logger,
 	}
 }
 
-func (au *AuthUsecase) CreateUser(usr *model.User) (string, error) {
-	valid, err := au.repo.CheckUser(usr)
-	if err != nil || !valid {
-		return "", err
+func (au *AuthUsecase) CreateUser(ctx context.Context, usr *model.User, device string) (*model.Tokens, error) {
+	ctx, span := tracing.Start(ctx, "auth.CreateUser")
+	defer span.End()
+
+	if !au.org.OpenRegistration {
+		return nil, errors.RegistrationClosed
+	}
+	// members of events may reference groups
+	if _, ok := model.GroupIdOf(usr.Login); ok {
+		return nil, errors.BadLogin
+	}
+
+	usr.Email = strings.TrimSpace(usr.Email)
+	err := validateRegistration(usr)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := au.repo.CheckUser(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.LoginAlreadyExists
 	}
 
-	hash_, err := bcrypt.GenerateFromPassword([]byte(usr.Password), 4)
+	hash_, err := bcrypt.GenerateFromPassword([]byte(usr.Password), au.bcryptCost)
 	if err != nil {
-		return "", errors.InternalError
+		return nil, errors.InternalError
 	}
 	usr.Password = string(hash_)
-	usr.Token = util.GenerateRandomString(32)
 
-	usr, err = au.repo.Insert(usr)
-	return usr.Token, err
+	usr.EmailVerified = false
+	usr, err = au.repo.Insert(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	// user can request the letter again, so registration does not fail
+	err = au.sendVerification(ctx, usr)
+	if err != nil {
+		au.logger.WithContext(ctx).Warnf("[CreateUser] verification not sent to %s: %s", usr.Login, err.Error())
+	}
+	return au.CreateSession(ctx, usr.Login, device)
+}
+
+// logins are keys of mongo documents, so dots and dollars are not allowed
+var loginRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+func validateRegistration(usr *model.User) error {
+	v := validation.NewValidator()
+	v.Check(loginRegexp.MatchString(usr.Login), "login", "must be 3 to 32 latin letters, digits, _ or -")
+	v.Length("email", usr.Email, 1, model.MAX_EMAIL_LENGTH)
+	address, err := mail.ParseAddress(usr.Email)
+	v.Check(err == nil && address.Address == usr.Email, "email", "must be email address")
+	validatePassword(v, "password", usr.Login, usr.Password)
+	v.Length("name", usr.Name, 0, model.MAX_NAME_LENGTH)
+	v.Length("surname", usr.Surname, 0, model.MAX_NAME_LENGTH)
+	return v.Err()
+}
+
+// validatePassword checks password of registration, change and reset. Bcrypt ignores bytes
+// after MAX_PASSWORD_LENGTH, so longer passwords are rejected. Empty login skips login check
+func validatePassword(v *validation.Validator, field, login, password string) {
+	v.Check(len(password) >= model.MIN_PASSWORD_LENGTH, field,
+		fmt.Sprintf("must be at least %d characters", model.MIN_PASSWORD_LENGTH))
+	v.Check(len(password) <= model.MAX_PASSWORD_LENGTH, field,
+		fmt.Sprintf("must be at most %d bytes", model.MAX_PASSWORD_LENGTH))
+	v.Check(login == "" || !strings.Contains(strings.ToLower(password), strings.ToLower(login)),
+		field, "must not contain login")
 }
 
 func checkPassword(raw string, hash string) error {
@@ -47,26 +136,546 @@ func checkPassword(raw string, hash string) error {
 	return nil
 }
 
-func (au *AuthUsecase) GetUser(ausr *model.Auth) (*model.User, error) {
-	usr, err := au.repo.GetUser(ausr.Login)
-	if err != nil {
+// GetUser checks credentials. Unknown login and wrong password give the same error
+func (au *AuthUsecase) GetUser(ctx context.Context, ausr *model.Auth) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "auth.GetUser")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, ausr.Login)
+	switch err {
+	case nil:
+		break
+	case errors.UserNotFound:
+		checkPassword(ausr.Password, string(au.dummyHash))
+		return nil, errors.BadCredentials
+	default:
 		return nil, err
 	}
 
+	// users created by identity provider have no password
+	if usr.Password == "" {
+		checkPassword(ausr.Password, string(au.dummyHash))
+		return nil, errors.BadCredentials
+	}
+
 	err = checkPassword(ausr.Password, usr.Password)
 	if err != nil {
-		return nil, err
+		return nil, errors.BadCredentials
 	}
 
+	// suspension is reported only to those who know the password
+	if usr.Suspended {
+		return nil, errors.UserSuspended
+	}
 	return usr, nil
 }
 
-func (au *AuthUsecase) GetUserByToken(token string) (*model.User, error) {
-	login, err := au.repo.GetLoginByToken(token)
+// issueTokens returns new access token and refresh token in form <session id>.<generation>.<secret>
+func (au *AuthUsecase) issueTokens(session *model.Session, secret string) (*model.Tokens, error) {
+	now := time.Now()
+	claims := &model.AccessClaims{
+		SessionId:  session.Id,
+		Org:        au.org.Id,
+		Restricted: session.Restricted,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   session.Login,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(model.ACCESS_TOKEN_TTL) * time.Second)),
+		},
+	}
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(au.secret)
+	if err != nil {
+		au.logger.Warnf("[issueTokens] cannot sign access token: %s", err.Error())
+		return nil, errors.InternalError
+	}
+
+	return &model.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: fmt.Sprintf("%s.%d.%s", session.Id, session.Generation, secret),
+		ExpiresIn:    model.ACCESS_TOKEN_TTL,
+	}, nil
+}
+
+// CreateSession starts new session of user on device
+func (au *AuthUsecase) CreateSession(ctx context.Context, login, device string) (*model.Tokens, error) {
+	ctx, span := tracing.Start(ctx, "auth.CreateSession")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Suspended {
+		return nil, errors.UserSuspended
+	}
+	restricted := au.isRestricted(usr)
+
+	now := time.Now().Unix()
+	secret := util.GenerateSecureString(model.LENGTH_OF_SESSION_SECRET)
+	session := &model.Session{
+		Id:        util.GenerateSecureString(model.LENGTH_OF_SESSION_ID),
+		Login:     login,
+		TokenHash: util.HashToken(secret),
+		Device:    device,
+		CreatedAt: now,
+		LastUsed:  now,
+
+		Restricted: restricted,
+	}
+
+	err = au.repo.InsertSession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	return au.issueTokens(session, secret)
+}
+
+func isExpired(session *model.Session, now int64) bool {
+	return now-session.LastUsed > model.SESSION_IDLE_TIMEOUT || now-session.CreatedAt > model.SESSION_ABSOLUTE_TIMEOUT
+}
+
+// RefreshSession rotates refresh token. Presenting token of previous generation means
+// that it was stolen, so the whole session is revoked
+func (au *AuthUsecase) RefreshSession(ctx context.Context, refreshToken string) (*model.Tokens, error) {
+	ctx, span := tracing.Start(ctx, "auth.RefreshSession")
+	defer span.End()
+
+	parts := strings.SplitN(refreshToken, ".", 3)
+	if len(parts) != 3 {
+		return nil, errors.SessionNotFound
+	}
+	generation, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, errors.SessionNotFound
+	}
+
+	session, err := au.repo.GetSession(ctx, parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if isExpired(session, now) {
+		au.revokeSession(ctx, session.Id)
+		return nil, errors.SessionExpired
+	}
+
+	if generation < session.Generation {
+		au.logger.WithContext(ctx).Warnf("[RefreshSession] reuse of refresh token of session %s", session.Id)
+		au.revokeSession(ctx, session.Id)
+		return nil, errors.RefreshReused
+	}
+
+	if generation != session.Generation || session.TokenHash != util.HashToken(parts[2]) {
+		return nil, errors.SessionNotFound
+	}
+
+	usr, err := au.repo.GetUser(ctx, session.Login)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Suspended {
+		au.revokeSession(ctx, session.Id)
+		return nil, errors.UserSuspended
+	}
+	session.Restricted = au.isRestricted(usr)
+
+	secret := util.GenerateSecureString(model.LENGTH_OF_SESSION_SECRET)
+	session.TokenHash = util.HashToken(secret)
+	session.Generation++
+	session.LastUsed = now
+	err = au.repo.RotateSession(ctx, session, generation)
+	if err == errors.RefreshReused {
+		// concurrent refresh with the same token
+		au.logger.WithContext(ctx).Warnf("[RefreshSession] concurrent reuse of refresh token of session %s", session.Id)
+		au.revokeSession(ctx, session.Id)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return au.issueTokens(session, secret)
+}
+
+func (au *AuthUsecase) revokeSession(ctx context.Context, sessionId string) {
+	err := au.repo.RemoveSession(ctx, sessionId)
+	if err != nil {
+		au.logger.WithContext(ctx).Warnf("[revokeSession] session %s not removed: %s", sessionId, err.Error())
+	}
+}
+
+// CheckAccessToken verifies signature and expiration of access token without storage lookup,
+// so returned user and session have only login and id filled
+func (au *AuthUsecase) CheckAccessToken(token string) (*model.User, *model.Session, error) {
+	claims := &model.AccessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.BadAccessToken
+		}
+		return au.secret, nil
+	})
+	// tokens of other kinds have no session, tokens of other organizations are not accepted
+	if err != nil || claims.Subject == "" || claims.SessionId == "" || claims.Org != au.org.Id {
+		return nil, nil, errors.BadAccessToken
+	}
+
+	usr := &model.User{Login: claims.Subject}
+	session := &model.Session{Id: claims.SessionId, Login: claims.Subject, Restricted: claims.Restricted}
+	return usr, session, nil
+}
+
+// CheckApiKey finds key by its id and compares hash of secret part
+func (au *AuthUsecase) CheckApiKey(ctx context.Context, key string) (*model.User, *model.ApiKey, error) {
+	ctx, span := tracing.Start(ctx, "auth.CheckApiKey")
+	defer span.End()
+
+	parts := strings.SplitN(strings.TrimPrefix(key, model.API_KEY_PREFIX), "_", 2)
+	if len(parts) != 2 {
+		return nil, nil, errors.ApiKeyNotFound
+	}
+
+	apiKey, err := au.repo.GetApiKey(ctx, parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(util.HashToken(parts[1]))) != 1 {
+		return nil, nil, errors.ApiKeyNotFound
+	}
+
+	now := time.Now().Unix()
+	if apiKey.ExpiresAt != 0 && apiKey.ExpiresAt < now {
+		return nil, nil, errors.ApiKeyNotFound
+	}
+
+	usr, err := au.repo.GetUser(ctx, apiKey.Login)
+	if err != nil {
+		return nil, nil, err
+	}
+	if usr.Suspended {
+		return nil, nil, errors.UserSuspended
+	}
+
+	if now-apiKey.LastUsed >= model.API_KEY_LAST_USED_DELAY {
+		err = au.repo.TouchApiKey(ctx, apiKey.Id, now)
+		if err != nil {
+			au.logger.WithContext(ctx).Warnf("[CheckApiKey] last usage of %s not stored: %s", apiKey.Id, err.Error())
+		}
+		apiKey.LastUsed = now
+	}
+
+	return usr, apiKey, nil
+}
+
+func (au *AuthUsecase) CreateApiKey(ctx context.Context, login string, request *model.ApiKeyRequest) (*model.CreatedApiKey, error) {
+	ctx, span := tracing.Start(ctx, "auth.CreateApiKey")
+	defer span.End()
+
+	now := time.Now().Unix()
+	if request.Name == "" || len(request.Scopes) == 0 || (request.ExpiresAt != 0 && request.ExpiresAt <= now) {
+		return nil, errors.BadApiKey
+	}
+
+	scopes := make([]string, 0, len(request.Scopes))
+	seen := make(map[string]bool, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !model.IsValidScope(scope) {
+			return nil, errors.BadApiKey
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	secret := util.GenerateSecureString(model.LENGTH_OF_API_KEY)
+	apiKey := &model.ApiKey{
+		Id:        util.GenerateSecureString(model.LENGTH_OF_API_KEY_ID),
+		Login:     login,
+		Name:      request.Name,
+		Scopes:    scopes,
+		KeyHash:   util.HashToken(secret),
+		CreatedAt: now,
+		ExpiresAt: request.ExpiresAt,
+	}
+
+	err := au.repo.InsertApiKey(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &model.CreatedApiKey{
+		ApiKey: apiKey,
+		Key:    fmt.Sprintf("%s%s_%s", model.API_KEY_PREFIX, apiKey.Id, secret),
+	}, nil
+}
+
+func (au *AuthUsecase) GetApiKeys(ctx context.Context, login string) (*model.JsonApiKeys, error) {
+	ctx, span := tracing.Start(ctx, "auth.GetApiKeys")
+	defer span.End()
+
+	keys, err := au.repo.GetApiKeysByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	return &model.JsonApiKeys{ApiKeys: keys}, nil
+}
+
+func (au *AuthUsecase) RemoveApiKey(ctx context.Context, login, keyId string) error {
+	ctx, span := tracing.Start(ctx, "auth.RemoveApiKey")
+	defer span.End()
+
+	apiKey, err := au.repo.GetApiKey(ctx, keyId)
+	if err != nil {
+		return err
+	}
+
+	// do not reveal keys of other users
+	if apiKey.Login != login {
+		return errors.ApiKeyNotFound
+	}
+	return au.repo.RemoveApiKey(ctx, keyId)
+}
+
+// CountActiveSessions counts sessions of all users which are not expired yet
+func (au *AuthUsecase) CountActiveSessions(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "auth.CountActiveSessions")
+	defer span.End()
+
+	now := time.Now().Unix()
+	return au.repo.CountSessions(ctx, now-model.SESSION_IDLE_TIMEOUT, now-model.SESSION_ABSOLUTE_TIMEOUT)
+}
+
+func (au *AuthUsecase) GetSessions(ctx context.Context, login, currentSessionId string) (*model.JsonSessions, error) {
+	ctx, span := tracing.Start(ctx, "auth.GetSessions")
+	defer span.End()
+
+	sessions, err := au.repo.GetSessionsByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	answer := &model.JsonSessions{Sessions: make([]*model.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		if isExpired(session, now) {
+			continue
+		}
+		session.Current = session.Id == currentSessionId
+		answer.Sessions = append(answer.Sessions, session)
+	}
+	return answer, nil
+}
+
+func (au *AuthUsecase) RemoveSession(ctx context.Context, login, sessionId string) error {
+	ctx, span := tracing.Start(ctx, "auth.RemoveSession")
+	defer span.End()
+
+	session, err := au.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+
+	// do not reveal sessions of other users
+	if session.Login != login {
+		return errors.SessionNotFound
+	}
+	return au.repo.RemoveSession(ctx, sessionId)
+}
+
+// issueUserToken stores hash of new one-time token and returns the token itself
+func (au *AuthUsecase) issueUserToken(ctx context.Context, purpose string, usr *model.User, ttl int64) (string, error) {
+	now := time.Now().Unix()
+	err := au.repo.RemoveUserTokensBefore(ctx, now)
+	if err != nil {
+		au.logger.WithContext(ctx).Warnf("[issueUserToken] expired tokens not removed: %s", err.Error())
+	}
+
+	token := util.GenerateSecureString(model.LENGTH_OF_USER_TOKEN)
+	err = au.repo.InsertUserToken(ctx, util.HashToken(token), &model.UserToken{
+		Purpose:   purpose,
+		Login:     usr.Login,
+		Email:     usr.Email,
+		ExpiresAt: now + ttl,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useUserToken consumes token and returns its owner if token is still valid for purpose
+func (au *AuthUsecase) useUserToken(ctx context.Context, purpose, token string) (*model.User, error) {
+	userToken, err := au.repo.PopUserToken(ctx, util.HashToken(token))
 	if err != nil {
 		return nil, err
 	}
+	if userToken.Purpose != purpose || userToken.ExpiresAt < time.Now().Unix() {
+		return nil, errors.BadUserToken
+	}
+
+	usr, err := au.repo.GetUser(ctx, userToken.Login)
+	if err == errors.UserNotFound {
+		return nil, errors.BadUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// email was changed after token was sent
+	if usr.Email != userToken.Email {
+		return nil, errors.BadUserToken
+	}
+	return usr, nil
+}
+
+func (au *AuthUsecase) link(page, token string) string {
+	if au.appUrl == "" {
+		return token
+	}
+	link := fmt.Sprintf("%s/%s?token=%s", strings.TrimRight(au.appUrl, "/"), page, token)
+	if au.org.Id != model.DEFAULT_ORG {
+		link = fmt.Sprintf("%s&%s=%s", link, model.OrgCgi, au.org.Id)
+	}
+	return link
+}
+
+func (au *AuthUsecase) sendVerification(ctx context.Context, usr *model.User) error {
+	token, err := au.issueUserToken(ctx, model.PURPOSE_VERIFY_EMAIL, usr, model.VERIFY_EMAIL_TOKEN_TTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы подтвердить почту в НеКалендаре, перейдите по ссылке:\n%s\n",
+		usr.Login, au.link("verify-email", token))
+	err = au.mailer.Send(usr.Email, "Подтверждение почты", body)
+	if err != nil {
+		au.logger.WithContext(ctx).Warnf("[sendVerification] letter not sent to %s: %s", usr.Login, err.Error())
+		return errors.InternalError
+	}
+	return nil
+}
+
+func (au *AuthUsecase) SendVerification(ctx context.Context, login string) error {
+	ctx, span := tracing.Start(ctx, "auth.SendVerification")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+	if usr.EmailVerified {
+		return errors.EmailAlreadyVerified
+	}
+
+	return au.sendVerification(ctx, usr)
+}
+
+func (au *AuthUsecase) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "auth.VerifyEmail")
+	defer span.End()
+
+	usr, err := au.useUserToken(ctx, model.PURPOSE_VERIFY_EMAIL, token)
+	if err != nil {
+		return err
+	}
+	return au.repo.SetEmailVerified(ctx, usr.Login)
+}
+
+// ForgotPassword sends reset token if user with email exists. Absence of user is not reported
+// to caller, so the handler cannot be used to find out registered emails
+func (au *AuthUsecase) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "auth.ForgotPassword")
+	defer span.End()
+
+	usr, err := au.repo.GetUserByEmail(ctx, email)
+	if err == errors.UserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := au.issueUserToken(ctx, model.PURPOSE_RESET_PASSWORD, usr, model.RESET_PASSWORD_TTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль в НеКалендаре, перейдите по ссылке:\n%s\n\n"+
+		"Ссылка действует один час. Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+		usr.Login, au.link("reset-password", token))
+	err = au.mailer.Send(usr.Email, "Сброс пароля", body)
+	if err != nil {
+		au.logger.WithContext(ctx).Warnf("[ForgotPassword] letter not sent to %s: %s", usr.Login, err.Error())
+		return errors.InternalError
+	}
+	return nil
+}
+
+// setPassword stores hash of password after checking it, field names password in request
+func (au *AuthUsecase) setPassword(ctx context.Context, login, field, password string) error {
+	v := validation.NewValidator()
+	validatePassword(v, field, login, password)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	hash_, err := bcrypt.GenerateFromPassword([]byte(password), au.bcryptCost)
+	if err != nil {
+		return errors.InternalError
+	}
+	return au.repo.UpdatePassword(ctx, login, string(hash_))
+}
 
-	usr, err := au.repo.GetUser(login)
-	return usr, err
+// ResetPassword sets new password and closes all sessions of user
+func (au *AuthUsecase) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := tracing.Start(ctx, "auth.ResetPassword")
+	defer span.End()
+
+	// token is consumed on use, so rules known without login are checked before
+	v := validation.NewValidator()
+	validatePassword(v, "password", "", password)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	usr, err := au.useUserToken(ctx, model.PURPOSE_RESET_PASSWORD, token)
+	if err != nil {
+		return err
+	}
+
+	err = au.setPassword(ctx, usr.Login, "password", password)
+	if err != nil {
+		return err
+	}
+
+	// letter was received, so email is confirmed too
+	if !usr.EmailVerified {
+		err = au.repo.SetEmailVerified(ctx, usr.Login)
+		if err != nil {
+			return err
+		}
+	}
+	return au.repo.RemoveSessionsByLogin(ctx, usr.Login, "")
+}
+
+// ChangePassword sets new password and closes all sessions of user except current one
+func (au *AuthUsecase) ChangePassword(ctx context.Context, login, sessionId, oldPassword, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "auth.ChangePassword")
+	defer span.End()
+
+	usr, err := au.repo.GetUser(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	err = checkPassword(oldPassword, usr.Password)
+	if err != nil {
+		return err
+	}
+
+	err = au.setPassword(ctx, login, "new_password", newPassword)
+	if err != nil {
+		return err
+	}
+	return au.repo.RemoveSessionsByLogin(ctx, login, sessionId)
 }
@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/config"
+	"nocalendar/internal/model"
+	"nocalendar/internal/validation"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeRepo answers CheckUser with fixed result, other methods are not expected to be called
+type fakeRepo struct {
+	auth.AuthRepository
+	valid bool
+	err   error
+}
+
+func (fr *fakeRepo) CheckUser(ctx context.Context, usr *model.User) (bool, error) {
+	return fr.valid, fr.err
+}
+
+func newTestUsecase(repo auth.AuthRepository) auth.AuthUsecase {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	org := &model.Org{Id: model.DEFAULT_ORG, OpenRegistration: true}
+	cfg := config.AuthConfig{TokenSecret: "test secret", BcryptCost: bcrypt.MinCost}
+	return NewAuthUsecase(repo, org, cfg, nil, logger)
+}
+
+func validUser() *model.User {
+	return &model.User{
+		Login:    "alice",
+		Email:    "alice@example.com",
+		Password: "correct horse battery",
+		Name:     "Alice",
+		Surname:  "Liddell",
+	}
+}
+
+func TestValidateRegistration(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(usr *model.User)
+		field  string
+	}{
+		{"valid", func(usr *model.User) {}, ""},
+		{"short login", func(usr *model.User) { usr.Login = "al" }, "login"},
+		{"login with dot", func(usr *model.User) { usr.Login = "al.ice" }, "login"},
+		{"login with dollar", func(usr *model.User) { usr.Login = "$alice" }, "login"},
+		{"long login", func(usr *model.User) { usr.Login = strings.Repeat("a", 33) }, "login"},
+		{"empty email", func(usr *model.User) { usr.Email = "" }, "email"},
+		{"email without at", func(usr *model.User) { usr.Email = "alice.example.com" }, "email"},
+		{"email with name", func(usr *model.User) { usr.Email = "Alice <alice@example.com>" }, "email"},
+		{"short password", func(usr *model.User) { usr.Password = "short" }, "password"},
+		{"long password", func(usr *model.User) { usr.Password = strings.Repeat("p", model.MAX_PASSWORD_LENGTH+1) }, "password"},
+		{"password with login", func(usr *model.User) { usr.Password = "ALICE12345" }, "password"},
+		{"long name", func(usr *model.User) { usr.Name = strings.Repeat("n", model.MAX_NAME_LENGTH+1) }, "name"},
+		{"long surname", func(usr *model.User) { usr.Surname = strings.Repeat("s", model.MAX_NAME_LENGTH+1) }, "surname"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usr := validUser()
+			tt.modify(usr)
+			err := validateRegistration(usr)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("validateRegistration = %v, want nil", err)
+				}
+				return
+			}
+
+			verr, ok := err.(*validation.Error)
+			if !ok {
+				t.Fatalf("validateRegistration = %v, want validation error", err)
+			}
+			if _, ok := verr.Fields[tt.field]; !ok || len(verr.Fields) != 1 {
+				t.Errorf("invalid fields = %v, want only %s", verr.Fields, tt.field)
+			}
+		})
+	}
+}
+
+func TestCreateUserRejectsBadInputBeforeStorage(t *testing.T) {
+	au := newTestUsecase(&fakeRepo{err: errors.InternalError})
+	usr := validUser()
+	usr.Password = "short"
+
+	_, err := au.CreateUser(context.Background(), usr, "test")
+	if _, ok := err.(*validation.Error); !ok {
+		t.Fatalf("CreateUser = %v, want validation error", err)
+	}
+}
+
+func TestCreateUserReportsExistingUser(t *testing.T) {
+	for _, repoErr := range []error{nil, errors.LoginAlreadyExists, errors.EmailAlreadyExists} {
+		au := newTestUsecase(&fakeRepo{valid: false, err: repoErr})
+
+		tokens, err := au.CreateUser(context.Background(), validUser(), "test")
+		if tokens != nil {
+			t.Errorf("CreateUser returned tokens for existing user")
+		}
+		want := repoErr
+		if want == nil {
+			want = errors.LoginAlreadyExists
+		}
+		if err != want {
+			t.Errorf("CreateUser with CheckUser error %v = %v, want %v", repoErr, err, want)
+		}
+	}
+}
+
+// passwordRepo keeps password hash of one user
+type passwordRepo struct {
+	auth.AuthRepository
+	usr *model.User
+}
+
+func (pr *passwordRepo) GetUser(ctx context.Context, login string) (*model.User, error) {
+	return pr.usr, nil
+}
+
+func (pr *passwordRepo) UpdatePassword(ctx context.Context, login, hash string) error {
+	pr.usr.Password = hash
+	return nil
+}
+
+func (pr *passwordRepo) RemoveSessionsByLogin(ctx context.Context, login, exceptSessionId string) error {
+	return nil
+}
+
+func TestNewPasswordFollowsRegistrationRules(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	repo := &passwordRepo{usr: &model.User{Login: "alice", Password: string(hash)}}
+	au := newTestUsecase(repo)
+	long := strings.Repeat("p", model.MAX_PASSWORD_LENGTH+1)
+
+	for _, password := range []string{long, "short", "ALICE12345"} {
+		err := au.ChangePassword(context.Background(), "alice", "session", "old password", password)
+		verr, ok := err.(*validation.Error)
+		if !ok {
+			t.Fatalf("ChangePassword to %q = %v, want validation error", password, err)
+		}
+		if _, ok := verr.Fields["new_password"]; !ok {
+			t.Errorf("invalid fields = %v, want new_password", verr.Fields)
+		}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(repo.usr.Password), []byte("old password")) != nil {
+		t.Errorf("password changed by rejected request")
+	}
+
+	// rejected before token is consumed, repository has no tokens to pop
+	err := au.ResetPassword(context.Background(), "token", long)
+	if verr, ok := err.(*validation.Error); !ok || verr.Fields["password"] == "" {
+		t.Errorf("ResetPassword = %v, want validation error of password", err)
+	}
+}
+
+// usersRepo keeps one administrator with second factor
+type usersRepo struct {
+	auth.AuthRepository
+}
+
+func (ur *usersRepo) users() []*model.User {
+	return []*model.User{{Login: "alice", Name: "Alice", Email: "alice@example.com", Role: model.USER_ROLE_ORG_ADMIN, TotpEnabled: true}}
+}
+
+func (ur *usersRepo) GetDirectoryUsers(ctx context.Context) ([]*model.User, error) {
+	return ur.users(), nil
+}
+
+func (ur *usersRepo) GetUsers(ctx context.Context) ([]*model.User, error) {
+	return ur.users(), nil
+}
+
+// fieldsOf returns json fields of the only user in answer
+func fieldsOf(t *testing.T, answer interface{}) map[string]interface{} {
+	body := struct {
+		Users []map[string]interface{} `json:"users"`
+	}{}
+	if err := json.Unmarshal(model.ToBytes(answer), &body); err != nil || len(body.Users) != 1 {
+		t.Fatalf("answer %s = %v, want one user", model.ToBytes(answer), err)
+	}
+	return body.Users[0]
+}
+
+func TestSearchShowsOnlyPublicFields(t *testing.T) {
+	au := newTestUsecase(&usersRepo{})
+
+	found, err := au.SearchUsers(context.Background(), "alice", 0, 0)
+	if err != nil {
+		t.Fatalf("SearchUsers: %s", err.Error())
+	}
+	fields := fieldsOf(t, found.ToAnswer())
+	for _, field := range []string{"login", "name", "surname", "email"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("search result %v has no %s", fields, field)
+		}
+	}
+	if len(fields) != 4 {
+		t.Errorf("search result %v, want only login, name, surname and email", fields)
+	}
+
+	all, err := au.GetUsers(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatalf("GetUsers: %s", err.Error())
+	}
+	fields = fieldsOf(t, all.ToAnswer())
+	if fields["role"] != model.USER_ROLE_ORG_ADMIN || fields["totp_enabled"] != true || fields["suspended"] != false {
+		t.Errorf("admin listing %v, want role, totp_enabled and suspended", fields)
+	}
+}
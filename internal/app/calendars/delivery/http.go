@@ -0,0 +1,200 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type CalendarsDelivery struct {
+	logger *logrus.Logger
+}
+
+func NewCalendarsDelivery(logger *logrus.Logger) *CalendarsDelivery {
+	return &CalendarsDelivery{
+		logger: logger,
+	}
+}
+
+func (cd *CalendarsDelivery) calendarsUsecase(r *http.Request) calendars.CalendarsUsecase {
+	return tenant.FromContext(r.Context()).Calendars
+}
+
+func (cd *CalendarsDelivery) Routing(r *mux.Router) {
+	cl := r.PathPrefix("/calendars").Subrouter()
+	am := middleware.NewAuthMiddleware(cd.logger)
+	cl.Use(am.TokenChecking)
+
+	cl.Handle("", am.RequireScope(model.SCOPE_CALENDARS_READ, cd.GetCalendars)).Methods(http.MethodGet, http.MethodOptions)
+	cl.Handle("", am.RequireScope(model.SCOPE_CALENDARS_WRITE, cd.CreateCalendar)).Methods(http.MethodPost, http.MethodOptions)
+	cl.Handle("/one/{calendar_id:[\\w]+}", am.RequireScope(model.SCOPE_CALENDARS_READ, cd.GetCalendar)).Methods(http.MethodGet, http.MethodOptions)
+	cl.Handle("/edit", am.RequireScope(model.SCOPE_CALENDARS_WRITE, cd.EditCalendar)).Methods(http.MethodPost, http.MethodOptions)
+	cl.Handle("/remove/{calendar_id:[\\w]+}", am.RequireScope(model.SCOPE_CALENDARS_WRITE, cd.RemoveCalendar)).Methods(http.MethodDelete, http.MethodOptions)
+
+	cl.Handle("/share", am.RequireScope(model.SCOPE_CALENDARS_WRITE, cd.ShareCalendar)).Methods(http.MethodPost, http.MethodOptions)
+	cl.Handle("/subscribe/{calendar_id:[\\w]+}", am.RequireScope(model.SCOPE_CALENDARS_WRITE, cd.Subscribe)).Methods(http.MethodPost, http.MethodOptions)
+	cl.Handle("/unsubscribe/{calendar_id:[\\w]+}", am.RequireScope(model.SCOPE_CALENDARS_WRITE, cd.Unsubscribe)).Methods(http.MethodPost, http.MethodOptions)
+}
+
+func (cd *CalendarsDelivery) readCalendar(r *http.Request) (*model.Calendar, error) {
+	calendarModel := &model.Calendar{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(buf, calendarModel)
+	if err != nil {
+		return nil, err
+	}
+	return calendarModel, nil
+}
+
+func (cd *CalendarsDelivery) CreateCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarModel, err := cd.readCalendar(r)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[CreateCalendar] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadCalendar)
+		return
+	}
+
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	calendarId, err := cd.calendarsUsecase(r).CreateCalendar(r.Context(), calendarModel, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[CreateCalendar] calendar not created: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "ok", "calendar_id": "%s"}`, calendarId)))
+}
+
+func (cd *CalendarsDelivery) EditCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarModel, err := cd.readCalendar(r)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[EditCalendar] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadCalendar)
+		return
+	}
+
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	calendar, err := cd.calendarsUsecase(r).EditCalendar(r.Context(), calendarModel, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[EditCalendar] calendar not edited: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(calendar.ToAnswer()))
+}
+
+func (cd *CalendarsDelivery) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarId := mux.Vars(r)["calendar_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	calendar, err := cd.calendarsUsecase(r).GetCalendar(r.Context(), calendarId, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[GetCalendar] calendar not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(calendar.ToAnswer()))
+}
+
+func (cd *CalendarsDelivery) GetCalendars(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	cals, err := cd.calendarsUsecase(r).GetCalendars(r.Context(), usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[GetCalendars] calendars not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(cals.ToAnswer()))
+}
+
+func (cd *CalendarsDelivery) RemoveCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarId := mux.Vars(r)["calendar_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := cd.calendarsUsecase(r).RemoveCalendar(r.Context(), calendarId, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[RemoveCalendar] calendar not removed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "ok", "calendar_id": "%s"}`, calendarId)))
+}
+
+func (cd *CalendarsDelivery) ShareCalendar(w http.ResponseWriter, r *http.Request) {
+	shareModel := &model.Share{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, shareModel)
+	}
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[ShareCalendar] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadShare)
+		return
+	}
+
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	calendar, err := cd.calendarsUsecase(r).ShareCalendar(r.Context(), shareModel, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[ShareCalendar] calendar not shared: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(calendar.ToAnswer()))
+}
+
+func (cd *CalendarsDelivery) Subscribe(w http.ResponseWriter, r *http.Request) {
+	calendarId := mux.Vars(r)["calendar_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := cd.calendarsUsecase(r).Subscribe(r.Context(), calendarId, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[Subscribe] not subscribed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "ok", "calendar_id": "%s"}`, calendarId)))
+}
+
+func (cd *CalendarsDelivery) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	calendarId := mux.Vars(r)["calendar_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := cd.calendarsUsecase(r).Unsubscribe(r.Context(), calendarId, usr.Login)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[Unsubscribe] not unsubscribed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "ok", "calendar_id": "%s"}`, calendarId)))
+}
@@ -0,0 +1,21 @@
+package calendars
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type CalendarsRepository interface {
+	InsertCalendar(ctx context.Context, calendar *model.Calendar) error
+	GetCalendar(ctx context.Context, calendarId string) (*model.Calendar, error)
+	GetCalendarsByOwner(ctx context.Context, owner string) ([]*model.Calendar, error)
+	RemoveCalendar(ctx context.Context, calendarId string) error
+
+	AddEventToCalendar(ctx context.Context, calendarId, eventId string) error
+	RemoveEventFromCalendar(ctx context.Context, calendarId, eventId string) error
+	GetEventIdsByCalendar(ctx context.Context, calendarId string) ([]string, error)
+
+	AddSubscription(ctx context.Context, login, calendarId string) error
+	RemoveSubscription(ctx context.Context, login, calendarId string) error
+	GetSubscriptions(ctx context.Context, login string) ([]string, error)
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/db"
+	"nocalendar/internal/model"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CalendarsRepository struct {
+	mongo  *db.Database
+	logger *logrus.Logger
+}
+
+func NewCalendarsRepository(db *db.Database, logger *logrus.Logger) calendars.CalendarsRepository {
+	return &CalendarsRepository{
+		mongo:  db,
+		logger: logger,
+	}
+}
+
+func (cr *CalendarsRepository) InsertCalendar(ctx context.Context, calendar *model.Calendar) error {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "InsertCalendar")
+	defer end()
+
+	filter := bson.M{
+		"_id": cr.mongo.Doc("json/calendars"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("calendars.%s", calendar.Id): calendar,
+		},
+	}
+
+	_, err := cr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[InsertCalendar] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (cr *CalendarsRepository) GetCalendar(ctx context.Context, calendarId string) (*model.Calendar, error) {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "GetCalendar")
+	defer end()
+
+	doc := &model.BsonCalendars{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("calendars.%s", calendarId): 1})
+	err := cr.mongo.Conn.FindOne(ctx, bson.M{"_id": cr.mongo.Doc("json/calendars")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		calendar, ok := doc.Calendars[calendarId]
+		if !ok {
+			return nil, errors.CalendarNotFound
+		}
+		return calendar, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.CalendarNotFound
+	default:
+		cr.logger.WithContext(ctx).Warnf("[GetCalendar] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (cr *CalendarsRepository) GetCalendarsByOwner(ctx context.Context, owner string) ([]*model.Calendar, error) {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "GetCalendarsByOwner")
+	defer end()
+
+	step1 := bson.M{
+		"$match": bson.M{
+			"_id": cr.mongo.Doc("json/calendars"),
+		},
+	}
+
+	step2 := bson.M{
+		"$project": bson.M{
+			"calendars": bson.M{
+				"$objectToArray": "$calendars",
+			},
+		},
+	}
+
+	step3 := bson.M{
+		"$unwind": "$calendars",
+	}
+
+	step4 := bson.M{
+		"$match": bson.M{
+			"calendars.v.owner": owner,
+		},
+	}
+
+	step5 := bson.M{
+		"$replaceRoot": bson.M{
+			"newRoot": "$calendars.v",
+		},
+	}
+
+	pipeline := []bson.M{step1, step2, step3, step4, step5}
+	cursor, err := cr.mongo.Conn.Aggregate(ctx, pipeline)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[GetCalendarsByOwner] Aggregate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	calendars := make([]*model.Calendar, 0)
+	err = cursor.All(ctx, &calendars)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[GetCalendarsByOwner] All: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+	return calendars, nil
+}
+
+func (cr *CalendarsRepository) RemoveCalendar(ctx context.Context, calendarId string) error {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "RemoveCalendar")
+	defer end()
+
+	_, err := cr.mongo.Conn.UpdateOne(ctx, bson.M{"_id": cr.mongo.Doc("json/calendars")}, bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("calendars.%s", calendarId): "",
+		},
+	})
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[RemoveCalendar] UpdateOne calendars: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	_, err = cr.mongo.Conn.UpdateOne(ctx, bson.M{"_id": cr.mongo.Doc("json/calendar_events")}, bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("calendar_events.%s", calendarId): "",
+		},
+	})
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[RemoveCalendar] UpdateOne calendar_events: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (cr *CalendarsRepository) AddEventToCalendar(ctx context.Context, calendarId, eventId string) error {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "AddEventToCalendar")
+	defer end()
+
+	filter := bson.M{
+		"_id": cr.mongo.Doc("json/calendar_events"),
+	}
+
+	body := bson.M{
+		"$addToSet": bson.M{
+			fmt.Sprintf("calendar_events.%s", calendarId): eventId,
+		},
+	}
+
+	_, err := cr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[AddEventToCalendar] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (cr *CalendarsRepository) RemoveEventFromCalendar(ctx context.Context, calendarId, eventId string) error {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "RemoveEventFromCalendar")
+	defer end()
+
+	filter := bson.M{
+		"_id": cr.mongo.Doc("json/calendar_events"),
+	}
+
+	body := bson.M{
+		"$pull": bson.M{
+			fmt.Sprintf("calendar_events.%s", calendarId): eventId,
+		},
+	}
+
+	_, err := cr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[RemoveEventFromCalendar] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (cr *CalendarsRepository) GetEventIdsByCalendar(ctx context.Context, calendarId string) ([]string, error) {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "GetEventIdsByCalendar")
+	defer end()
+
+	doc := &model.BsonCalendarEvents{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("calendar_events.%s", calendarId): 1})
+	err := cr.mongo.Conn.FindOne(ctx, bson.M{"_id": cr.mongo.Doc("json/calendar_events")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		return doc.Events[calendarId], nil
+	case mongo.ErrNoDocuments:
+		return nil, nil
+	default:
+		cr.logger.WithContext(ctx).Warnf("[GetEventIdsByCalendar] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (cr *CalendarsRepository) AddSubscription(ctx context.Context, login, calendarId string) error {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "AddSubscription")
+	defer end()
+
+	filter := bson.M{
+		"_id": cr.mongo.Doc("json/subscriptions"),
+	}
+
+	body := bson.M{
+		"$addToSet": bson.M{
+			fmt.Sprintf("subscriptions.%s", login): calendarId,
+		},
+	}
+
+	_, err := cr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[AddSubscription] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (cr *CalendarsRepository) RemoveSubscription(ctx context.Context, login, calendarId string) error {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "RemoveSubscription")
+	defer end()
+
+	filter := bson.M{
+		"_id": cr.mongo.Doc("json/subscriptions"),
+	}
+
+	body := bson.M{
+		"$pull": bson.M{
+			fmt.Sprintf("subscriptions.%s", login): calendarId,
+		},
+	}
+
+	_, err := cr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[RemoveSubscription] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (cr *CalendarsRepository) GetSubscriptions(ctx context.Context, login string) ([]string, error) {
+	ctx, end := cr.mongo.Call(ctx, "calendars", "GetSubscriptions")
+	defer end()
+
+	doc := &model.BsonSubscriptions{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("subscriptions.%s", login): 1})
+	err := cr.mongo.Conn.FindOne(ctx, bson.M{"_id": cr.mongo.Doc("json/subscriptions")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		return doc.Subscriptions[login], nil
+	case mongo.ErrNoDocuments:
+		return nil, nil
+	default:
+		cr.logger.WithContext(ctx).Warnf("[GetSubscriptions] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
@@ -0,0 +1,19 @@
+package calendars
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type CalendarsUsecase interface {
+	CreateCalendar(ctx context.Context, calendar *model.Calendar, owner string) (string, error)
+	EditCalendar(ctx context.Context, calendar *model.Calendar, login string) (*model.Calendar, error)
+	GetCalendar(ctx context.Context, calendarId, login string) (*model.Calendar, error)
+	GetCalendars(ctx context.Context, login string) (*model.JsonCalendars, error)
+	RemoveCalendar(ctx context.Context, calendarId, login string) error
+
+	ShareCalendar(ctx context.Context, share *model.Share, login string) (*model.Calendar, error)
+	Subscribe(ctx context.Context, calendarId, login string) error
+	Unsubscribe(ctx context.Context, calendarId, login string) error
+	RemoveOwner(ctx context.Context, login, transferTo string) error
+}
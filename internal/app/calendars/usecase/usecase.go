@@ -0,0 +1,475 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/util"
+	"nocalendar/internal/validation"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+)
+
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type CalendarsUsecase struct {
+	repo       calendars.CalendarsRepository
+	authRepo   auth.AuthRepository
+	groupsRepo groups.GroupsRepository
+	logger     *logrus.Logger
+}
+
+func NewCalendarsUsecase(repo calendars.CalendarsRepository, authRepo auth.AuthRepository, groupsRepo groups.GroupsRepository,
+	logger *logrus.Logger) calendars.CalendarsUsecase {
+	return &CalendarsUsecase{
+		repo:       repo,
+		authRepo:   authRepo,
+		groupsRepo: groupsRepo,
+		logger:     logger,
+	}
+}
+
+// groupsOf returns ids of groups of login, roles granted to groups belong to their members
+func (cu *CalendarsUsecase) groupsOf(ctx context.Context, login string) ([]string, error) {
+	groups, err := cu.groupsRepo.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return model.GroupIdsOf(groups, login), nil
+}
+
+func (cu *CalendarsUsecase) roleOf(ctx context.Context, calendar *model.Calendar, login string) (string, error) {
+	if calendar.Owner == login {
+		return model.ROLE_MANAGE, nil
+	}
+	groupIds, err := cu.groupsOf(ctx, login)
+	if err != nil {
+		return model.ROLE_NONE, err
+	}
+	return calendar.RoleOf(login, groupIds), nil
+}
+
+// loginsOf returns users behind grantee of access list: the user itself or members of group.
+// Removed group has no members
+func (cu *CalendarsUsecase) loginsOf(ctx context.Context, grantee string) ([]string, error) {
+	groupId, ok := model.GroupIdOf(grantee)
+	if !ok {
+		return []string{grantee}, nil
+	}
+
+	group, err := cu.groupsRepo.GetGroup(ctx, groupId)
+	switch err {
+	case nil:
+		return group.Members, nil
+	case errors.GroupNotFound:
+		return []string{}, nil
+	default:
+		return nil, err
+	}
+}
+
+// removeSubscriptions unsubscribes users of grantees of removed calendar
+func (cu *CalendarsUsecase) removeSubscriptions(ctx context.Context, calendar *model.Calendar) error {
+	for grantee := range calendar.Acl {
+		logins, err := cu.loginsOf(ctx, grantee)
+		if err != nil {
+			return err
+		}
+		for _, login := range logins {
+			err = cu.repo.RemoveSubscription(ctx, login, calendar.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkCalendar(calendar *model.Calendar) error {
+	v := validation.NewValidator()
+	v.Length("title", calendar.Title, 1, model.MAX_TITLE_LENGTH)
+	v.Check(colorRegexp.MatchString(calendar.Color), "color", "must be a hex color like #4285f4")
+	v.Range("default_reminder", calendar.DefaultReminder, 0, model.MAX_REMINDER_MINUTES)
+	return v.Err()
+}
+
+func (cu *CalendarsUsecase) CreateCalendar(ctx context.Context, calendar *model.Calendar, owner string) (string, error) {
+	ctx, span := tracing.Start(ctx, "calendars.CreateCalendar")
+	defer span.End()
+
+	calendar.Id = util.GenerateRandomString(model.LENGTH_OF_CALENDAR_ID)
+	calendar.Owner = owner
+	calendar.Acl = nil
+	if calendar.Color == "" {
+		calendar.Color = model.DEFAULT_CALENDAR_COLOR
+	}
+
+	err := checkCalendar(calendar)
+	if err != nil {
+		return "", err
+	}
+
+	err = cu.repo.InsertCalendar(ctx, calendar)
+	if err != nil {
+		return "", err
+	}
+	return calendar.Id, nil
+}
+
+func (cu *CalendarsUsecase) EditCalendar(ctx context.Context, calendar *model.Calendar, login string) (*model.Calendar, error) {
+	ctx, span := tracing.Start(ctx, "calendars.EditCalendar")
+	defer span.End()
+
+	old, err := cu.repo.GetCalendar(ctx, calendar.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := cu.roleOf(ctx, old, login)
+	if err != nil {
+		return nil, err
+	}
+	if !model.HasRole(role, model.ROLE_MANAGE) {
+		return nil, errors.HasNoRights
+	}
+
+	if calendar.Title == "" {
+		calendar.Title = old.Title
+	}
+	if calendar.Color == "" {
+		calendar.Color = old.Color
+	}
+	calendar.Owner = old.Owner
+	// access is changed only through sharing
+	calendar.Acl = old.Acl
+
+	err = checkCalendar(calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cu.repo.InsertCalendar(ctx, calendar)
+	if err != nil {
+		return nil, err
+	}
+	return viewOf(calendar, role), nil
+}
+
+// viewOf fills role of user and hides access list from those who cannot manage calendar
+func viewOf(calendar *model.Calendar, role string) *model.Calendar {
+	view := *calendar
+	view.Role = role
+	if !model.HasRole(view.Role, model.ROLE_MANAGE) {
+		view.Acl = nil
+	}
+	return &view
+}
+
+func (cu *CalendarsUsecase) GetCalendar(ctx context.Context, calendarId, login string) (*model.Calendar, error) {
+	ctx, span := tracing.Start(ctx, "calendars.GetCalendar")
+	defer span.End()
+
+	calendar, err := cu.repo.GetCalendar(ctx, calendarId)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := cu.roleOf(ctx, calendar, login)
+	if err != nil {
+		return nil, err
+	}
+	if !model.HasRole(role, model.ROLE_FREEBUSY) {
+		return nil, errors.HasNoRights
+	}
+	return viewOf(calendar, role), nil
+}
+
+func (cu *CalendarsUsecase) GetCalendars(ctx context.Context, login string) (*model.JsonCalendars, error) {
+	ctx, span := tracing.Start(ctx, "calendars.GetCalendars")
+	defer span.End()
+
+	cals, err := cu.repo.GetCalendarsByOwner(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := cu.repo.GetSubscriptions(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIds, err := cu.groupsOf(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &model.JsonCalendars{Calendars: make([]*model.Calendar, 0, len(cals)+len(subscriptions))}
+	for _, calendar := range cals {
+		answer.Calendars = append(answer.Calendars, viewOf(calendar, model.ROLE_MANAGE))
+	}
+	for _, calendarId := range subscriptions {
+		calendar, err := cu.repo.GetCalendar(ctx, calendarId)
+		switch err {
+		case nil:
+		case errors.CalendarNotFound:
+			continue
+		default:
+			return nil, err
+		}
+
+		role := calendar.RoleOf(login, groupIds)
+		if calendar.Owner == login || !model.HasRole(role, model.ROLE_FREEBUSY) {
+			continue
+		}
+		answer.Calendars = append(answer.Calendars, viewOf(calendar, role))
+	}
+	return answer, nil
+}
+
+func (cu *CalendarsUsecase) RemoveCalendar(ctx context.Context, calendarId, login string) error {
+	ctx, span := tracing.Start(ctx, "calendars.RemoveCalendar")
+	defer span.End()
+
+	calendar, err := cu.repo.GetCalendar(ctx, calendarId)
+	if err != nil {
+		return err
+	}
+
+	// only owner may remove calendar, managers may only share it
+	if calendar.Owner != login {
+		return errors.HasNoRights
+	}
+
+	eventIds, err := cu.repo.GetEventIdsByCalendar(ctx, calendarId)
+	if err != nil {
+		return err
+	}
+	if len(eventIds) > 0 {
+		return errors.CalendarNotEmpty
+	}
+
+	err = cu.removeSubscriptions(ctx, calendar)
+	if err != nil {
+		return err
+	}
+	return cu.repo.RemoveCalendar(ctx, calendarId)
+}
+
+func (cu *CalendarsUsecase) ShareCalendar(ctx context.Context, share *model.Share, login string) (*model.Calendar, error) {
+	ctx, span := tracing.Start(ctx, "calendars.ShareCalendar")
+	defer span.End()
+
+	if share.Login == "" || (share.Role != model.ROLE_NONE && !model.IsValidRole(share.Role)) {
+		return nil, errors.BadShare
+	}
+
+	calendar, err := cu.repo.GetCalendar(ctx, share.CalendarId)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := cu.roleOf(ctx, calendar, login)
+	if err != nil {
+		return nil, err
+	}
+	if !model.HasRole(role, model.ROLE_MANAGE) {
+		return nil, errors.HasNoRights
+	}
+
+	if share.Login == calendar.Owner {
+		return nil, errors.BadShare
+	}
+
+	// access may be revoked from removed users and groups, but granted only to existing ones
+	groupId, isGroup := model.GroupIdOf(share.Login)
+	if share.Role != model.ROLE_NONE && isGroup {
+		_, err = cu.groupsRepo.GetGroup(ctx, groupId)
+		switch err {
+		case nil:
+		case errors.GroupNotFound:
+			v := validation.NewValidator()
+			v.Check(false, "login", fmt.Sprintf("unknown group %s", groupId))
+			return nil, v.Err()
+		default:
+			return nil, err
+		}
+	} else if share.Role != model.ROLE_NONE {
+		_, err = cu.authRepo.GetUser(ctx, share.Login)
+		switch err {
+		case nil:
+		case errors.UserNotFound:
+			v := validation.NewValidator()
+			v.UnknownLogin(share.Login)
+			return nil, v.Err()
+		default:
+			return nil, err
+		}
+	}
+
+	if calendar.Acl == nil {
+		calendar.Acl = make(map[string]string)
+	}
+	if share.Role == model.ROLE_NONE {
+		delete(calendar.Acl, share.Login)
+	} else {
+		calendar.Acl[share.Login] = share.Role
+	}
+
+	err = cu.repo.InsertCalendar(ctx, calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cu.updateSubscriptions(ctx, calendar, share)
+	if err != nil {
+		return nil, err
+	}
+	return viewOf(calendar, role), nil
+}
+
+// updateSubscriptions makes shared calendar appear in lists of users of grantee at once,
+// they may unsubscribe later. Users who lost access are unsubscribed, unless another
+// grant, e.g. of their group, still gives access
+func (cu *CalendarsUsecase) updateSubscriptions(ctx context.Context, calendar *model.Calendar, share *model.Share) error {
+	logins, err := cu.loginsOf(ctx, share.Login)
+	if err != nil {
+		return err
+	}
+
+	groups, err := cu.groupsRepo.GetGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, grantee := range logins {
+		if grantee == calendar.Owner {
+			continue
+		}
+		if share.Role != model.ROLE_NONE {
+			err = cu.repo.AddSubscription(ctx, grantee, calendar.Id)
+		} else if !model.HasRole(calendar.RoleOf(grantee, model.GroupIdsOf(groups, grantee)), model.ROLE_FREEBUSY) {
+			err = cu.repo.RemoveSubscription(ctx, grantee, calendar.Id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cu *CalendarsUsecase) Subscribe(ctx context.Context, calendarId, login string) error {
+	ctx, span := tracing.Start(ctx, "calendars.Subscribe")
+	defer span.End()
+
+	calendar, err := cu.repo.GetCalendar(ctx, calendarId)
+	if err != nil {
+		return err
+	}
+
+	role, err := cu.roleOf(ctx, calendar, login)
+	if err != nil {
+		return err
+	}
+	if calendar.Owner == login || !model.HasRole(role, model.ROLE_FREEBUSY) {
+		return errors.HasNoRights
+	}
+	return cu.repo.AddSubscription(ctx, login, calendarId)
+}
+
+func (cu *CalendarsUsecase) Unsubscribe(ctx context.Context, calendarId, login string) error {
+	ctx, span := tracing.Start(ctx, "calendars.Unsubscribe")
+	defer span.End()
+
+	return cu.repo.RemoveSubscription(ctx, login, calendarId)
+}
+
+// RemoveOwner handles calendars of deleted user: own calendars are given to transferTo
+// or removed if it is empty, access to shared calendars is revoked
+func (cu *CalendarsUsecase) RemoveOwner(ctx context.Context, login, transferTo string) error {
+	ctx, span := tracing.Start(ctx, "calendars.RemoveOwner")
+	defer span.End()
+
+	owned, err := cu.repo.GetCalendarsByOwner(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	for _, calendar := range owned {
+		if transferTo != "" {
+			calendar.Owner = transferTo
+			delete(calendar.Acl, transferTo)
+			err = cu.repo.InsertCalendar(ctx, calendar)
+			if err != nil {
+				return err
+			}
+			// owner sees own calendars without subscription
+			err = cu.repo.RemoveSubscription(ctx, transferTo, calendar.Id)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = cu.removeCalendar(ctx, calendar)
+		if err != nil {
+			return err
+		}
+	}
+
+	subscriptions, err := cu.repo.GetSubscriptions(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	for _, calendarId := range subscriptions {
+		calendar, err := cu.repo.GetCalendar(ctx, calendarId)
+		switch err {
+		case nil:
+			break
+		case errors.CalendarNotFound:
+			continue
+		default:
+			return err
+		}
+
+		if _, ok := calendar.Acl[login]; ok {
+			delete(calendar.Acl, login)
+			err = cu.repo.InsertCalendar(ctx, calendar)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = cu.repo.RemoveSubscription(ctx, login, calendarId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCalendar removes calendar even with events, they stay without calendar
+func (cu *CalendarsUsecase) removeCalendar(ctx context.Context, calendar *model.Calendar) error {
+	eventIds, err := cu.repo.GetEventIdsByCalendar(ctx, calendar.Id)
+	if err != nil {
+		return err
+	}
+	for _, eventId := range eventIds {
+		err = cu.repo.RemoveEventFromCalendar(ctx, calendar.Id, eventId)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cu.removeSubscriptions(ctx, calendar)
+	if err != nil {
+		return err
+	}
+	return cu.repo.RemoveCalendar(ctx, calendar.Id)
+}
@@ -0,0 +1,195 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/model"
+	"nocalendar/internal/validation"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeCalendars struct {
+	calendars.CalendarsRepository
+	calendars     map[string]*model.Calendar
+	subscriptions map[string][]string
+}
+
+func (fc *fakeCalendars) InsertCalendar(ctx context.Context, calendar *model.Calendar) error {
+	fc.calendars[calendar.Id] = calendar
+	return nil
+}
+
+func (fc *fakeCalendars) GetCalendar(ctx context.Context, calendarId string) (*model.Calendar, error) {
+	calendar, ok := fc.calendars[calendarId]
+	if !ok {
+		return nil, errors.CalendarNotFound
+	}
+	copied := *calendar
+	copied.Acl = make(map[string]string)
+	for grantee, role := range calendar.Acl {
+		copied.Acl[grantee] = role
+	}
+	return &copied, nil
+}
+
+func (fc *fakeCalendars) GetCalendarsByOwner(ctx context.Context, owner string) ([]*model.Calendar, error) {
+	owned := make([]*model.Calendar, 0)
+	for _, calendar := range fc.calendars {
+		if calendar.Owner == owner {
+			owned = append(owned, calendar)
+		}
+	}
+	return owned, nil
+}
+
+func (fc *fakeCalendars) AddSubscription(ctx context.Context, login, calendarId string) error {
+	fc.RemoveSubscription(ctx, login, calendarId)
+	fc.subscriptions[login] = append(fc.subscriptions[login], calendarId)
+	return nil
+}
+
+func (fc *fakeCalendars) RemoveSubscription(ctx context.Context, login, calendarId string) error {
+	kept := make([]string, 0)
+	for _, id := range fc.subscriptions[login] {
+		if id != calendarId {
+			kept = append(kept, id)
+		}
+	}
+	fc.subscriptions[login] = kept
+	return nil
+}
+
+func (fc *fakeCalendars) GetSubscriptions(ctx context.Context, login string) ([]string, error) {
+	return fc.subscriptions[login], nil
+}
+
+func (fc *fakeCalendars) subscribed(login, calendarId string) bool {
+	for _, id := range fc.subscriptions[login] {
+		if id == calendarId {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeUsers struct {
+	auth.AuthRepository
+}
+
+func (fu *fakeUsers) GetUser(ctx context.Context, login string) (*model.User, error) {
+	return &model.User{Login: login}, nil
+}
+
+type fakeGroups struct {
+	groups.GroupsRepository
+	groups map[string]*model.Group
+}
+
+func (fg *fakeGroups) GetGroup(ctx context.Context, groupId string) (*model.Group, error) {
+	group, ok := fg.groups[groupId]
+	if !ok {
+		return nil, errors.GroupNotFound
+	}
+	return group, nil
+}
+
+func (fg *fakeGroups) GetGroups(ctx context.Context) ([]*model.Group, error) {
+	groups := make([]*model.Group, 0, len(fg.groups))
+	for _, group := range fg.groups {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// newTestUsecase returns usecase with calendar "work" of alice and group "team" of bob and carol
+func newTestUsecase() (*CalendarsUsecase, *fakeCalendars) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	repo := &fakeCalendars{
+		calendars:     map[string]*model.Calendar{"work": {Id: "work", Title: "work", Owner: "alice"}},
+		subscriptions: make(map[string][]string),
+	}
+	groupsRepo := &fakeGroups{groups: map[string]*model.Group{
+		"team": {Id: "team", Owner: "alice", Members: []string{"bob", "carol"}},
+	}}
+	return NewCalendarsUsecase(repo, &fakeUsers{}, groupsRepo, logger).(*CalendarsUsecase), repo
+}
+
+func TestGroupMemberReadsSharedCalendar(t *testing.T) {
+	cu, repo := newTestUsecase()
+	ctx := context.Background()
+
+	_, err := cu.ShareCalendar(ctx, &model.Share{CalendarId: "work", Login: "group:team", Role: model.ROLE_READ}, "alice")
+	if err != nil {
+		t.Fatalf("ShareCalendar: %s", err.Error())
+	}
+	if !repo.subscribed("bob", "work") || !repo.subscribed("carol", "work") {
+		t.Errorf("subscriptions = %v, want members of group subscribed", repo.subscriptions)
+	}
+
+	calendar, err := cu.GetCalendar(ctx, "work", "bob")
+	if err != nil || calendar.Role != model.ROLE_READ || calendar.Acl != nil {
+		t.Fatalf("GetCalendar of group member = %+v, %v, want read role without access list", calendar, err)
+	}
+	list, err := cu.GetCalendars(ctx, "bob")
+	if err != nil || len(list.Calendars) != 1 || list.Calendars[0].Role != model.ROLE_READ {
+		t.Errorf("GetCalendars of group member = %+v, %v, want work with read role", list, err)
+	}
+
+	if _, err := cu.GetCalendar(ctx, "work", "dave"); err != errors.HasNoRights {
+		t.Errorf("GetCalendar of other user = %v, want %v", err, errors.HasNoRights)
+	}
+	if err := cu.Subscribe(ctx, "work", "dave"); err != errors.HasNoRights {
+		t.Errorf("Subscribe of other user = %v, want %v", err, errors.HasNoRights)
+	}
+	// read role of group does not let members share calendar
+	if _, err := cu.ShareCalendar(ctx, &model.Share{CalendarId: "work", Login: "dave", Role: model.ROLE_READ}, "bob"); err != errors.HasNoRights {
+		t.Errorf("ShareCalendar by group member = %v, want %v", err, errors.HasNoRights)
+	}
+}
+
+func TestGroupRoleIsCombinedWithOwnRole(t *testing.T) {
+	cu, repo := newTestUsecase()
+	ctx := context.Background()
+
+	for _, share := range []*model.Share{
+		{CalendarId: "work", Login: "group:team", Role: model.ROLE_FREEBUSY},
+		{CalendarId: "work", Login: "carol", Role: model.ROLE_WRITE},
+	} {
+		if _, err := cu.ShareCalendar(ctx, share, "alice"); err != nil {
+			t.Fatalf("ShareCalendar %+v: %s", share, err.Error())
+		}
+	}
+	if calendar, err := cu.GetCalendar(ctx, "work", "carol"); err != nil || calendar.Role != model.ROLE_WRITE {
+		t.Errorf("GetCalendar = %+v, %v, want the strongest role", calendar, err)
+	}
+
+	// member keeps access through own grant when group loses it
+	if _, err := cu.ShareCalendar(ctx, &model.Share{CalendarId: "work", Login: "group:team"}, "alice"); err != nil {
+		t.Fatalf("revoke from group: %s", err.Error())
+	}
+	if repo.subscribed("bob", "work") || !repo.subscribed("carol", "work") {
+		t.Errorf("subscriptions = %v, want only carol subscribed", repo.subscriptions)
+	}
+	if _, err := cu.GetCalendar(ctx, "work", "bob"); err != errors.HasNoRights {
+		t.Errorf("GetCalendar after revoke = %v, want %v", err, errors.HasNoRights)
+	}
+}
+
+func TestShareWithUnknownGroup(t *testing.T) {
+	cu, _ := newTestUsecase()
+
+	_, err := cu.ShareCalendar(context.Background(), &model.Share{CalendarId: "work", Login: "group:ghosts", Role: model.ROLE_READ}, "alice")
+	verr, ok := err.(*validation.Error)
+	if !ok {
+		t.Fatalf("ShareCalendar = %v, want validation error", err)
+	}
+	if _, ok := verr.Fields["login"]; !ok {
+		t.Errorf("invalid fields = %v, want login", verr.Fields)
+	}
+}
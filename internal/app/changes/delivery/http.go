@@ -0,0 +1,50 @@
+package delivery
+
+import (
+	"net/http"
+	"nocalendar/internal/app/changes"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ChangesDelivery struct {
+	logger *logrus.Logger
+}
+
+func NewChangesDelivery(logger *logrus.Logger) *ChangesDelivery {
+	return &ChangesDelivery{
+		logger: logger,
+	}
+}
+
+func (cd *ChangesDelivery) changesUsecase(r *http.Request) changes.ChangesUsecase {
+	return tenant.FromContext(r.Context()).Changes
+}
+
+func (cd *ChangesDelivery) Routing(r *mux.Router) {
+	sy := r.PathPrefix("/sync").Subrouter()
+	am := middleware.NewAuthMiddleware(cd.logger)
+	sy.Use(am.TokenChecking)
+
+	sy.Handle("", am.RequireScope(model.SCOPE_EVENTS_READ, cd.Sync)).Methods(http.MethodGet, http.MethodOptions)
+}
+
+func (cd *ChangesDelivery) Sync(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get(model.SinceCgi)
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	answer, err := cd.changesUsecase(r).Sync(r.Context(), usr.Login, token)
+	if err != nil {
+		cd.logger.WithContext(r.Context()).Warnf("[Sync] changes not collected: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(answer.ToAnswer()))
+}
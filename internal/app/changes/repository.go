@@ -0,0 +1,13 @@
+package changes
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type ChangesRepository interface {
+	InsertChange(ctx context.Context, change *model.Change) error
+	GetSeq(ctx context.Context) (int64, error)
+	// GetChangesSince returns stored changes with numbers greater than since in order of numbers
+	GetChangesSince(ctx context.Context, since int64) ([]*model.Change, error)
+}
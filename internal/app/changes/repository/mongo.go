@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/changes"
+	"nocalendar/internal/db"
+	"nocalendar/internal/model"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ChangesRepository struct {
+	mongo  *db.Database
+	logger *logrus.Logger
+}
+
+func NewChangesRepository(db *db.Database, logger *logrus.Logger) changes.ChangesRepository {
+	return &ChangesRepository{
+		mongo:  db,
+		logger: logger,
+	}
+}
+
+// InsertChange takes next number from counter of feed and stores change as a separate document.
+// Changes older than CHANGES_RETENTION numbers are removed
+func (cr *ChangesRepository) InsertChange(ctx context.Context, change *model.Change) error {
+	ctx, end := cr.mongo.Call(ctx, "changes", "InsertChange")
+	defer end()
+
+	feed := cr.mongo.Doc("json/changes")
+	body := bson.M{
+		"$inc": bson.M{
+			"seq": 1,
+		},
+		// array of changes was kept in counter before changes became separate documents
+		"$unset": bson.M{
+			"changes": "",
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
+	counter := &model.BsonChanges{}
+	err := cr.mongo.Conn.FindOneAndUpdate(ctx, bson.M{"_id": feed}, body, opts).Decode(counter)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[InsertChange] FindOneAndUpdate: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	change.Seq = counter.Seq
+	_, err = cr.mongo.Conn.InsertOne(ctx, &model.BsonChange{
+		Id:     cr.mongo.Doc(fmt.Sprintf("changes/%d", change.Seq)),
+		Feed:   feed,
+		Change: *change,
+	})
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[InsertChange] InsertOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	// change is stored, so failed cleanup is repeated by the next change
+	_, err = cr.mongo.Conn.DeleteMany(ctx, bson.M{
+		"feed": feed,
+		"seq":  bson.M{"$lte": change.Seq - model.CHANGES_RETENTION},
+	})
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[InsertChange] DeleteMany: %s", err.Error())
+	}
+	return nil
+}
+
+func (cr *ChangesRepository) GetSeq(ctx context.Context) (int64, error) {
+	ctx, end := cr.mongo.Call(ctx, "changes", "GetSeq")
+	defer end()
+
+	opts := options.FindOne().SetProjection(bson.M{"seq": 1})
+	counter := &model.BsonChanges{}
+	err := cr.mongo.Conn.FindOne(ctx, bson.M{"_id": cr.mongo.Doc("json/changes")}, opts).Decode(counter)
+	switch err {
+	case nil:
+		return counter.Seq, nil
+	case mongo.ErrNoDocuments:
+		return 0, nil
+	default:
+		cr.logger.WithContext(ctx).Warnf("[GetSeq] FindOne: %s", err.Error())
+		return 0, db.StorageError(ctx, err)
+	}
+}
+
+func (cr *ChangesRepository) GetChangesSince(ctx context.Context, since int64) ([]*model.Change, error) {
+	ctx, end := cr.mongo.Call(ctx, "changes", "GetChangesSince")
+	defer end()
+
+	filter := bson.M{
+		"feed": cr.mongo.Doc("json/changes"),
+		"seq":  bson.M{"$gt": since},
+	}
+	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(model.CHANGES_RETENTION)
+	cursor, err := cr.mongo.Conn.Find(ctx, filter, opts)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[GetChangesSince] Find: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+
+	docs := make([]*model.BsonChange, 0)
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		cr.logger.WithContext(ctx).Warnf("[GetChangesSince] All: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+
+	changes := make([]*model.Change, 0, len(docs))
+	for _, doc := range docs {
+		change := doc.Change
+		changes = append(changes, &change)
+	}
+	return changes, nil
+}
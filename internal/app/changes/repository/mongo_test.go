@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"nocalendar/internal/db/dbtest"
+	"nocalendar/internal/model"
+	"testing"
+)
+
+func TestChangesAreNumberedPerOrg(t *testing.T) {
+	mongo := dbtest.NewDatabase(t)
+	logger := dbtest.Logger()
+	ctx := context.Background()
+	acme := NewChangesRepository(dbtest.NewOrgDatabase(t, mongo, "acme"), logger)
+	globex := NewChangesRepository(dbtest.NewOrgDatabase(t, mongo, "globex"), logger)
+
+	for _, eventId := range []string{"first", "second", "third"} {
+		if err := acme.InsertChange(ctx, &model.Change{EventId: eventId, Op: model.CHANGE_CREATED, Members: []string{"alice"}}); err != nil {
+			t.Fatalf("InsertChange: %s", err.Error())
+		}
+	}
+	if err := globex.InsertChange(ctx, &model.Change{EventId: "other", Op: model.CHANGE_CREATED}); err != nil {
+		t.Fatalf("InsertChange in other org: %s", err.Error())
+	}
+
+	if seq, err := acme.GetSeq(ctx); err != nil || seq != 3 {
+		t.Errorf("GetSeq = %d, %v, want 3", seq, err)
+	}
+	if seq, err := globex.GetSeq(ctx); err != nil || seq != 1 {
+		t.Errorf("GetSeq in other org = %d, %v, want 1", seq, err)
+	}
+
+	changes, err := acme.GetChangesSince(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetChangesSince: %s", err.Error())
+	}
+	if len(changes) != 2 || changes[0].Seq != 2 || changes[0].EventId != "second" || changes[1].Seq != 3 || changes[1].EventId != "third" {
+		t.Errorf("GetChangesSince(1) = %+v, want second and third", changes)
+	}
+	if len(changes) > 0 && (len(changes[0].Members) != 1 || changes[0].Members[0] != "alice") {
+		t.Errorf("members of change = %v, want alice", changes[0].Members)
+	}
+}
@@ -0,0 +1,10 @@
+package changes
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type ChangesUsecase interface {
+	Sync(ctx context.Context, login string, token string) (*model.SyncAnswer, error)
+}
@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/changes"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ChangesUsecase struct {
+	repo   changes.ChangesRepository
+	logger *logrus.Logger
+}
+
+func NewChangesUsecase(repo changes.ChangesRepository, logger *logrus.Logger) changes.ChangesUsecase {
+	return &ChangesUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func contains(logins []string, login string) bool {
+	for _, l := range logins {
+		if l == login {
+			return true
+		}
+	}
+	return false
+}
+
+// applyChange folds change into state of event as the user sees it since last sync
+func applyChange(states map[string]string, change *model.Change, login string) {
+	prev, seen := states[change.EventId]
+	switch {
+	case change.Op == model.CHANGE_DELETED || contains(change.Removed, login):
+		if seen && prev == model.CHANGE_CREATED {
+			// client has never seen this event
+			delete(states, change.EventId)
+			return
+		}
+		states[change.EventId] = model.CHANGE_DELETED
+	case change.Op == model.CHANGE_CREATED:
+		states[change.EventId] = model.CHANGE_CREATED
+	default:
+		if seen && prev == model.CHANGE_CREATED {
+			return
+		}
+		states[change.EventId] = model.CHANGE_UPDATED
+	}
+}
+
+// contiguous returns changes which follow since without gaps. Number of change is taken before
+// change is stored, so gap may be a change which is being stored now. Gap is treated as lost
+// change, if it was pruned or later changes are already older than CHANGE_GAP_TIMEOUT
+func contiguous(changes []*model.Change, since, seq, now int64) ([]*model.Change, error) {
+	for i, change := range changes {
+		expected := since + int64(i) + 1
+		if change.Seq == expected {
+			continue
+		}
+		if expected <= seq-model.CHANGES_RETENTION || now-change.Timestamp > model.CHANGE_GAP_TIMEOUT {
+			return nil, errors.SyncTokenExpired
+		}
+		return changes[:i], nil
+	}
+	return changes, nil
+}
+
+func (cu *ChangesUsecase) Sync(ctx context.Context, login string, token string) (*model.SyncAnswer, error) {
+	ctx, span := tracing.Start(ctx, "changes.Sync")
+	defer span.End()
+
+	seq, err := cu.repo.GetSeq(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &model.SyncAnswer{
+		Token:   strconv.FormatInt(seq, 10),
+		Created: make([]string, 0),
+		Updated: make([]string, 0),
+		Deleted: make([]string, 0),
+	}
+	// without token client only gets the starting point for full resync
+	if token == "" {
+		return answer, nil
+	}
+
+	since, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || since < 0 || since > seq {
+		return nil, errors.BadSyncToken
+	}
+	if since < seq-model.CHANGES_RETENTION {
+		return nil, errors.SyncTokenExpired
+	}
+
+	stored, err := cu.repo.GetChangesSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := contiguous(stored, since, seq, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	// client continues from the last change it got, changes after gap are returned later
+	answer.Token = strconv.FormatInt(since, 10)
+	if len(changes) > 0 {
+		answer.Token = strconv.FormatInt(changes[len(changes)-1].Seq, 10)
+	}
+
+	states := make(map[string]string)
+	order := make([]string, 0)
+	for _, change := range changes {
+		if !contains(change.Members, login) && !contains(change.Removed, login) {
+			continue
+		}
+		if _, ok := states[change.EventId]; !ok {
+			order = append(order, change.EventId)
+		}
+		applyChange(states, change, login)
+	}
+
+	for _, eventId := range order {
+		switch states[eventId] {
+		case model.CHANGE_CREATED:
+			answer.Created = append(answer.Created, eventId)
+		case model.CHANGE_UPDATED:
+			answer.Updated = append(answer.Updated, eventId)
+		case model.CHANGE_DELETED:
+			answer.Deleted = append(answer.Deleted, eventId)
+		}
+	}
+	return answer, nil
+}
@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeChanges keeps stored changes, seq may be ahead of them like counter of repository
+type fakeChanges struct {
+	seq     int64
+	changes []*model.Change
+}
+
+func (fc *fakeChanges) InsertChange(ctx context.Context, change *model.Change) error {
+	fc.seq++
+	change.Seq = fc.seq
+	fc.changes = append(fc.changes, change)
+	return nil
+}
+
+func (fc *fakeChanges) GetSeq(ctx context.Context) (int64, error) {
+	return fc.seq, nil
+}
+
+func (fc *fakeChanges) GetChangesSince(ctx context.Context, since int64) ([]*model.Change, error) {
+	changes := make([]*model.Change, 0)
+	for _, change := range fc.changes {
+		if change.Seq > since {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func newTestUsecase(repo *fakeChanges) *ChangesUsecase {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return NewChangesUsecase(repo, logger).(*ChangesUsecase)
+}
+
+func change(seq int64, op, eventId string, age int64) *model.Change {
+	return &model.Change{
+		Seq:       seq,
+		Op:        op,
+		EventId:   eventId,
+		Members:   []string{"alice"},
+		Timestamp: time.Now().Unix() - age,
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name    string
+		seq     int64
+		changes []*model.Change
+		since   string
+		token   string
+		updated []string
+		created []string
+		err     error
+	}{
+		{"starting point", 2, []*model.Change{change(1, model.CHANGE_CREATED, "a", 0), change(2, model.CHANGE_UPDATED, "a", 0)},
+			"", "2", nil, nil, nil},
+		{"all changes", 2, []*model.Change{change(1, model.CHANGE_CREATED, "a", 0), change(2, model.CHANGE_UPDATED, "b", 0)},
+			"0", "2", []string{"b"}, []string{"a"}, nil},
+		{"changes after token", 2, []*model.Change{change(1, model.CHANGE_CREATED, "a", 0), change(2, model.CHANGE_UPDATED, "b", 0)},
+			"1", "2", []string{"b"}, nil, nil},
+		{"nothing new", 2, []*model.Change{change(1, model.CHANGE_CREATED, "a", 0), change(2, model.CHANGE_UPDATED, "b", 0)},
+			"2", "2", nil, nil, nil},
+		{"token ahead of feed", 2, nil, "3", "", nil, nil, errors.BadSyncToken},
+		{"bad token", 2, nil, "abc", "", nil, nil, errors.BadSyncToken},
+		{"change being stored", 3, []*model.Change{change(1, model.CHANGE_UPDATED, "a", 0), change(3, model.CHANGE_UPDATED, "c", 0)},
+			"0", "1", []string{"a"}, nil, nil},
+		{"last change being stored", 2, []*model.Change{change(1, model.CHANGE_UPDATED, "a", 0)},
+			"0", "1", []string{"a"}, nil, nil},
+		{"lost change", 3, []*model.Change{change(1, model.CHANGE_UPDATED, "a", 0), change(3, model.CHANGE_UPDATED, "c", model.CHANGE_GAP_TIMEOUT+1)},
+			"0", "", nil, nil, errors.SyncTokenExpired},
+		{"pruned changes", model.CHANGES_RETENTION + 2, []*model.Change{change(model.CHANGES_RETENTION+2, model.CHANGE_UPDATED, "a", 0)},
+			"1", "", nil, nil, errors.SyncTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cu := newTestUsecase(&fakeChanges{seq: tt.seq, changes: tt.changes})
+
+			answer, err := cu.Sync(context.Background(), "alice", tt.since)
+			if err != tt.err {
+				t.Fatalf("Sync = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if answer.Token != tt.token {
+				t.Errorf("token = %s, want %s", answer.Token, tt.token)
+			}
+			if tt.updated == nil {
+				tt.updated = []string{}
+			}
+			if tt.created == nil {
+				tt.created = []string{}
+			}
+			if !reflect.DeepEqual(answer.Updated, tt.updated) || !reflect.DeepEqual(answer.Created, tt.created) {
+				t.Errorf("Sync = created %v updated %v, want %v %v", answer.Created, answer.Updated, tt.created, tt.updated)
+			}
+		})
+	}
+}
+
+func TestSyncSkipsChangesOfOtherUsers(t *testing.T) {
+	repo := &fakeChanges{}
+	repo.InsertChange(context.Background(), &model.Change{Op: model.CHANGE_CREATED, EventId: "a", Members: []string{"bob"}, Timestamp: time.Now().Unix()})
+	repo.InsertChange(context.Background(), &model.Change{Op: model.CHANGE_UPDATED, EventId: "a", Members: []string{"bob"}, Removed: []string{"alice"}, Timestamp: time.Now().Unix()})
+	cu := newTestUsecase(repo)
+
+	answer, err := cu.Sync(context.Background(), "carol", "0")
+	if err != nil || len(answer.Created)+len(answer.Updated)+len(answer.Deleted) != 0 || answer.Token != "2" {
+		t.Errorf("Sync of other user = %+v, %v, want no changes and token 2", answer, err)
+	}
+
+	answer, err = cu.Sync(context.Background(), "alice", "0")
+	if err != nil || !reflect.DeepEqual(answer.Deleted, []string{"a"}) {
+		t.Errorf("Sync of removed user = %+v, %v, want deleted a", answer, err)
+	}
+}
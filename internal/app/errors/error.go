@@ -1,8 +1,12 @@
 package errors
 
-import "fmt"
+import "net/http"
 
+// Error is failure which client can tell apart by Code. Codes are stable, messages are
+// for people and may change. Status is http status of answer with the error
 type Error struct {
+	Code    string
+	Status  int
 	Message string
 }
 
@@ -10,26 +14,94 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
-func ErrorToBytes(err error) []byte {
-	return []byte(fmt.Sprintf(`{"message": "%s"}`, err.Error()))
+// WithStatus returns copy of error answered with other status. Handlers compare errors
+// by pointers, so copy must not leave writer
+func (e *Error) WithStatus(status int) *Error {
+	return &Error{
+		Code:    e.Code,
+		Status:  status,
+		Message: e.Message,
+	}
 }
 
 var (
-	UserNotFound       *Error = &Error{Message: "user not found"}
-	BadPassword        *Error = &Error{Message: "incorrect password"}
-	LoginAlreadyExists *Error = &Error{Message: "user with this login already exists"}
-	EmailAlreadyExists *Error = &Error{Message: "user with this email already exists"}
-	HasNoRights        *Error = &Error{Message: "user has no rights to access this resource"}
+	UserNotFound       *Error = &Error{Code: "user_not_found", Status: http.StatusNotFound, Message: "user not found"}
+	BadPassword        *Error = &Error{Code: "bad_password", Status: http.StatusBadRequest, Message: "incorrect password"}
+	BadCredentials     *Error = &Error{Code: "bad_credentials", Status: http.StatusUnauthorized, Message: "incorrect login or password"}
+	LoginAlreadyExists *Error = &Error{Code: "login_already_exists", Status: http.StatusConflict, Message: "user with this login already exists"}
+	EmailAlreadyExists *Error = &Error{Code: "email_already_exists", Status: http.StatusConflict, Message: "user with this email already exists"}
+	HasNoRights        *Error = &Error{Code: "has_no_rights", Status: http.StatusForbidden, Message: "user has no rights to access this resource"}
+	BadProfile         *Error = &Error{Code: "bad_profile", Status: http.StatusBadRequest, Message: "incorrect profile fields"}
+	BadTransfer        *Error = &Error{Code: "bad_transfer", Status: http.StatusBadRequest, Message: "incorrect user to transfer events to"}
+	BadSearchQuery     *Error = &Error{Code: "bad_search_query", Status: http.StatusBadRequest, Message: "incorrect search query"}
+	UserSuspended      *Error = &Error{Code: "user_suspended", Status: http.StatusForbidden, Message: "user is suspended"}
+	BadRole            *Error = &Error{Code: "bad_role", Status: http.StatusBadRequest, Message: "incorrect role"}
+	JobNotFound        *Error = &Error{Code: "job_not_found", Status: http.StatusNotFound, Message: "maintenance job not found"}
+	BadPagination      *Error = &Error{Code: "bad_pagination", Status: http.StatusBadRequest, Message: "incorrect offset or limit"}
+	CannotManageUser   *Error = &Error{Code: "cannot_manage_user", Status: http.StatusForbidden, Message: "user has the same or higher role"}
 
-	EventNotFound  *Error = &Error{Message: "event not found"}
-	EventNotEdited *Error = &Error{Message: "event not edited"}
+	OrgNotFound        *Error = &Error{Code: "org_not_found", Status: http.StatusNotFound, Message: "organization not found"}
+	BadOrg             *Error = &Error{Code: "bad_org", Status: http.StatusBadRequest, Message: "incorrect organization fields"}
+	OrgAlreadyExists   *Error = &Error{Code: "org_already_exists", Status: http.StatusConflict, Message: "organization already exists"}
+	RegistrationClosed *Error = &Error{Code: "registration_closed", Status: http.StatusForbidden, Message: "registration in this organization is closed"}
 
-	MemberNotFound *Error = &Error{Message: "user has not events"}
+	Unauthorized    *Error = &Error{Code: "unauthorized", Status: http.StatusUnauthorized, Message: "unauthorized"}
+	SessionNotFound *Error = &Error{Code: "session_not_found", Status: http.StatusNotFound, Message: "session not found"}
+	SessionExpired  *Error = &Error{Code: "session_expired", Status: http.StatusUnauthorized, Message: "session expired"}
+	RefreshReused   *Error = &Error{Code: "refresh_reused", Status: http.StatusUnauthorized, Message: "refresh token was already used, session revoked"}
+	BadAccessToken  *Error = &Error{Code: "bad_access_token", Status: http.StatusUnauthorized, Message: "incorrect access token"}
 
-	InviteNotFound      *Error = &Error{Message: "invite has not found"}
-	InviteAlreadyExists *Error = &Error{Message: "invite already exists"}
-	FoundManyInvites    *Error = &Error{Message: "more than one invite was found"}
-	BadInviteCgi        *Error = &Error{Message: "unsupported cgi param"}
+	SecondFactorRequired *Error = &Error{Code: "second_factor_required", Status: http.StatusUnauthorized, Message: "second factor required"}
+	BadMfaToken          *Error = &Error{Code: "bad_mfa_token", Status: http.StatusUnauthorized, Message: "incorrect or expired second factor token"}
+	BadTotpCode          *Error = &Error{Code: "bad_totp_code", Status: http.StatusBadRequest, Message: "incorrect one-time code"}
+	TotpAlreadyEnabled   *Error = &Error{Code: "totp_already_enabled", Status: http.StatusConflict, Message: "two-factor authentication is already enabled"}
+	TotpNotEnabled       *Error = &Error{Code: "totp_not_enabled", Status: http.StatusConflict, Message: "two-factor authentication is not enabled"}
+	TotpRequired         *Error = &Error{Code: "totp_required", Status: http.StatusForbidden, Message: "two-factor authentication must be enabled"}
 
-	InternalError *Error = &Error{Message: "something went wrong"}
+	ApiKeyNotFound *Error = &Error{Code: "api_key_not_found", Status: http.StatusNotFound, Message: "api key not found"}
+	BadApiKey      *Error = &Error{Code: "bad_api_key", Status: http.StatusBadRequest, Message: "incorrect api key fields"}
+	ScopeRequired  *Error = &Error{Code: "scope_required", Status: http.StatusForbidden, Message: "api key has no scope for this action"}
+	SessionOnly    *Error = &Error{Code: "session_only", Status: http.StatusForbidden, Message: "action is not allowed with api key"}
+
+	BadUserToken         *Error = &Error{Code: "bad_user_token", Status: http.StatusBadRequest, Message: "incorrect or expired token"}
+	EmailAlreadyVerified *Error = &Error{Code: "email_already_verified", Status: http.StatusConflict, Message: "email is already verified"}
+
+	ProviderNotFound *Error = &Error{Code: "provider_not_found", Status: http.StatusNotFound, Message: "identity provider not found"}
+	BadOidcState     *Error = &Error{Code: "bad_oidc_state", Status: http.StatusBadRequest, Message: "incorrect or expired login state"}
+	OidcRejected     *Error = &Error{Code: "oidc_rejected", Status: http.StatusUnauthorized, Message: "identity provider rejected login"}
+
+	EventNotFound  *Error = &Error{Code: "event_not_found", Status: http.StatusNotFound, Message: "event not found"}
+	EventNotEdited *Error = &Error{Code: "event_not_edited", Status: http.StatusBadRequest, Message: "event not edited"}
+	BadVisibility  *Error = &Error{Code: "bad_visibility", Status: http.StatusBadRequest, Message: "incorrect visibility"}
+
+	MemberNotFound *Error = &Error{Code: "member_not_found", Status: http.StatusNotFound, Message: "user has not events"}
+
+	InviteNotFound      *Error = &Error{Code: "invite_not_found", Status: http.StatusNotFound, Message: "invite has not found"}
+	InviteAlreadyExists *Error = &Error{Code: "invite_already_exists", Status: http.StatusConflict, Message: "invite already exists"}
+	FoundManyInvites    *Error = &Error{Code: "found_many_invites", Status: http.StatusInternalServerError, Message: "more than one invite was found"}
+	BadInviteCgi        *Error = &Error{Code: "bad_invite_cgi", Status: http.StatusBadRequest, Message: "unsupported cgi param"}
+
+	CalendarNotFound *Error = &Error{Code: "calendar_not_found", Status: http.StatusNotFound, Message: "calendar not found"}
+	CalendarNotEmpty *Error = &Error{Code: "calendar_not_empty", Status: http.StatusConflict, Message: "calendar has events"}
+	BadCalendar      *Error = &Error{Code: "bad_calendar", Status: http.StatusBadRequest, Message: "incorrect calendar fields"}
+	BadShare         *Error = &Error{Code: "bad_share", Status: http.StatusBadRequest, Message: "incorrect share fields"}
+
+	GroupNotFound *Error = &Error{Code: "group_not_found", Status: http.StatusNotFound, Message: "group not found"}
+	BadGroup      *Error = &Error{Code: "bad_group", Status: http.StatusBadRequest, Message: "incorrect group fields"}
+	BadLogin      *Error = &Error{Code: "bad_login", Status: http.StatusBadRequest, Message: "login cannot start with group:"}
+
+	BadSyncToken     *Error = &Error{Code: "bad_sync_token", Status: http.StatusBadRequest, Message: "incorrect sync token"}
+	SyncTokenExpired *Error = &Error{Code: "sync_token_expired", Status: http.StatusGone, Message: "sync token is too old, full resync required"}
+
+	MalformedBody    *Error = &Error{Code: "malformed_body", Status: http.StatusBadRequest, Message: "request body is not valid json"}
+	ValidationFailed *Error = &Error{Code: "validation_failed", Status: http.StatusUnprocessableEntity, Message: "validation failed"}
+	RouteNotFound    *Error = &Error{Code: "route_not_found", Status: http.StatusNotFound, Message: "route not found"}
+	MethodNotAllowed *Error = &Error{Code: "method_not_allowed", Status: http.StatusMethodNotAllowed, Message: "method not allowed"}
+	TooManyRequests  *Error = &Error{Code: "too_many_requests", Status: http.StatusTooManyRequests, Message: "too many requests, try again later"}
+
+	StorageUnavailable *Error = &Error{Code: "storage_unavailable", Status: http.StatusServiceUnavailable, Message: "storage is unavailable"}
+	QueryTimeout       *Error = &Error{Code: "query_timeout", Status: http.StatusGatewayTimeout, Message: "storage did not respond in time"}
+	RequestCanceled    *Error = &Error{Code: "request_canceled", Status: STATUS_CLIENT_CLOSED_REQUEST, Message: "request canceled by client"}
+
+	InternalError *Error = &Error{Code: "internal_error", Status: http.StatusInternalServerError, Message: "something went wrong"}
 )
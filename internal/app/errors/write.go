@@ -0,0 +1,93 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"nocalendar/internal/logger"
+)
+
+// STATUS_CLIENT_CLOSED_REQUEST is not sent to anybody, client is gone already,
+// but it marks such requests in logs
+const STATUS_CLIENT_CLOSED_REQUEST = 499
+
+const (
+	PROBLEM_CONTENT_TYPE = "application/problem+json"
+	PROBLEM_TYPE_PREFIX  = "urn:nocalendar:problem:"
+)
+
+type FieldProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is body of answer with error by RFC 7807. Message repeats title for clients
+// which read it before problems appeared
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	Message       string         `json:"message"`
+	RequestId     string         `json:"request_id,omitempty"`
+	Fields        []FieldProblem `json:"fields,omitempty"`
+	UnknownLogins []string       `json:"unknown_logins,omitempty"`
+}
+
+func NewProblem(err *Error) *Problem {
+	return &Problem{
+		Type:    PROBLEM_TYPE_PREFIX + err.Code,
+		Title:   err.Message,
+		Status:  err.Status,
+		Code:    err.Code,
+		Message: err.Message,
+	}
+}
+
+// Detailed is error which tells more than its code, e.g. problems of separate fields
+type Detailed interface {
+	error
+	Problem() *Problem
+}
+
+// Write answers err as problem. Errors of app are found in chain of wrapped errors too.
+// Any other error is answered with 500 without details, handler logs it itself
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *Error
+	var detailed Detailed
+	var problem *Problem
+	switch {
+	case stderrors.As(err, &appErr):
+		problem = NewProblem(appErr)
+	case stderrors.As(err, &detailed):
+		problem = detailed.Problem()
+	case stderrors.Is(err, context.Canceled):
+		problem = NewProblem(RequestCanceled)
+	default:
+		problem = NewProblem(InternalError)
+	}
+
+	if problem.Status == STATUS_CLIENT_CLOSED_REQUEST {
+		w.WriteHeader(problem.Status)
+		return
+	}
+
+	problem.Instance = r.URL.Path
+	if req := logger.RequestFromContext(r.Context()); req != nil {
+		problem.RequestId = req.Id
+	}
+	buf, _ := json.Marshal(problem)
+
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	w.WriteHeader(problem.Status)
+	w.Write(buf)
+}
+
+// IsStorageError reports errors which say nothing about request itself, handlers must not
+// turn them into 4xx
+func IsStorageError(err error) bool {
+	return stderrors.Is(err, QueryTimeout) || stderrors.Is(err, StorageUnavailable) || stderrors.Is(err, RequestCanceled)
+}
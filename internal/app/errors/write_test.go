@@ -0,0 +1,93 @@
+package errors_test
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/validation"
+	"testing"
+)
+
+func write(t *testing.T, err error) (*httptest.ResponseRecorder, *errors.Problem) {
+	w := httptest.NewRecorder()
+	errors.Write(w, httptest.NewRequest(http.MethodGet, "/api/test", nil), err)
+
+	problem := &errors.Problem{}
+	if w.Body.Len() > 0 {
+		if jsonErr := json.Unmarshal(w.Body.Bytes(), problem); jsonErr != nil {
+			t.Fatalf("cannot parse problem %s: %s", w.Body.String(), jsonErr.Error())
+		}
+	}
+	return w, problem
+}
+
+func invalidTitle() error {
+	v := validation.NewValidator()
+	v.Check(false, "title", "must not be empty")
+	return v.Err()
+}
+
+func TestWriteFindsWrappedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"app error", errors.CalendarNotFound, http.StatusNotFound, "calendar_not_found"},
+		{"wrapped app error", fmt.Errorf("get calendar: %w", errors.CalendarNotFound), http.StatusNotFound, "calendar_not_found"},
+		{"error with other status", errors.SessionNotFound.WithStatus(http.StatusUnauthorized), http.StatusUnauthorized, "session_not_found"},
+		{"wrapped storage error", fmt.Errorf("find user: %w", errors.QueryTimeout), http.StatusGatewayTimeout, "query_timeout"},
+		{"twice wrapped storage error", fmt.Errorf("a: %w", fmt.Errorf("b: %w", errors.StorageUnavailable)), http.StatusServiceUnavailable, "storage_unavailable"},
+		{"validation error", invalidTitle(), http.StatusUnprocessableEntity, "validation_failed"},
+		{"wrapped validation error", fmt.Errorf("create event: %w", invalidTitle()), http.StatusUnprocessableEntity, "validation_failed"},
+		{"other error", stderrors.New("boom"), http.StatusInternalServerError, "internal_error"},
+		{"wrapped other error", fmt.Errorf("x: %w", stderrors.New("boom")), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := write(t, tt.err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if problem.Code != tt.code || problem.Status != tt.status {
+				t.Errorf("problem = %+v, want code %s and status %d", problem, tt.code, tt.status)
+			}
+			if got := w.Header().Get("Content-Type"); got != errors.PROBLEM_CONTENT_TYPE {
+				t.Errorf("content type = %s, want %s", got, errors.PROBLEM_CONTENT_TYPE)
+			}
+			if problem.Instance != "/api/test" {
+				t.Errorf("instance = %s, want /api/test", problem.Instance)
+			}
+		})
+	}
+}
+
+func TestWriteKeepsFieldsOfWrappedValidationError(t *testing.T) {
+	_, problem := write(t, fmt.Errorf("create event: %w", invalidTitle()))
+	if len(problem.Fields) != 1 || problem.Fields[0].Field != "title" {
+		t.Errorf("fields = %+v, want problem of title", problem.Fields)
+	}
+}
+
+func TestWriteCanceledRequest(t *testing.T) {
+	for _, err := range []error{errors.RequestCanceled, fmt.Errorf("x: %w", errors.RequestCanceled), fmt.Errorf("x: %w", context.Canceled)} {
+		w, _ := write(t, err)
+		if w.Code != errors.STATUS_CLIENT_CLOSED_REQUEST || w.Body.Len() != 0 {
+			t.Errorf("Write(%v) = %d %q, want %d without body", err, w.Code, w.Body.String(), errors.STATUS_CLIENT_CLOSED_REQUEST)
+		}
+	}
+}
+
+func TestIsStorageError(t *testing.T) {
+	if !errors.IsStorageError(fmt.Errorf("x: %w", errors.QueryTimeout)) {
+		t.Errorf("wrapped query timeout is not storage error")
+	}
+	if errors.IsStorageError(fmt.Errorf("x: %w", errors.UserNotFound)) {
+		t.Errorf("user not found is storage error")
+	}
+}
@@ -6,11 +6,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"nocalendar/internal/app/auth"
 	"nocalendar/internal/app/errors"
 	"nocalendar/internal/app/events"
 	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/tenant"
 	"nocalendar/internal/model"
+	"nocalendar/internal/validation"
 	"strconv"
 	"time"
 
@@ -19,33 +20,33 @@ import (
 )
 
 type EventsDelivery struct {
-	eventUsecase events.EventsUsecase
-	authUsecase  auth.AuthUsecase
-	logger       *logrus.Logger
+	logger *logrus.Logger
 }
 
-func NewEventsDelivery(eventUsecase events.EventsUsecase, authUsecase auth.AuthUsecase, logger *logrus.Logger) *EventsDelivery {
+func NewEventsDelivery(logger *logrus.Logger) *EventsDelivery {
 	return &EventsDelivery{
-		eventUsecase: eventUsecase,
-		authUsecase:  authUsecase,
-		logger:       logger,
+		logger: logger,
 	}
 }
 
+func (ed *EventsDelivery) eventUsecase(r *http.Request) events.EventsUsecase {
+	return tenant.FromContext(r.Context()).Events
+}
+
 func (ed *EventsDelivery) Routing(r *mux.Router) {
 	ev := r.PathPrefix("/event").Subrouter()
-	am := middleware.NewAuthMiddleware(ed.authUsecase, ed.logger)
+	am := middleware.NewAuthMiddleware(ed.logger)
 	ev.Use(am.TokenChecking)
 
-	ev.HandleFunc("", ed.CreateEvent).Methods(http.MethodPost, http.MethodOptions)
-	ev.HandleFunc("/one/{event_id:[\\w]+}", ed.GetEvent).Methods(http.MethodGet, http.MethodOptions)
-	ev.HandleFunc("/edit", ed.EditEvent).Methods(http.MethodPost, http.MethodOptions)
-	ev.HandleFunc("/all", ed.GetAllEvents).Methods(http.MethodGet, http.MethodOptions)
-	ev.HandleFunc("/remove/{event_id:[\\w]+}", ed.RemoveEvent).Methods(http.MethodDelete, http.MethodOptions)
+	ev.Handle("", am.RequireScope(model.SCOPE_EVENTS_WRITE, ed.CreateEvent)).Methods(http.MethodPost, http.MethodOptions)
+	ev.Handle("/one/{event_id:[\\w]+}", am.RequireScope(model.SCOPE_EVENTS_READ, ed.GetEvent)).Methods(http.MethodGet, http.MethodOptions)
+	ev.Handle("/edit", am.RequireScope(model.SCOPE_EVENTS_WRITE, ed.EditEvent)).Methods(http.MethodPost, http.MethodOptions)
+	ev.Handle("/all", am.RequireScope(model.SCOPE_EVENTS_READ, ed.GetAllEvents)).Methods(http.MethodGet, http.MethodOptions)
+	ev.Handle("/remove/{event_id:[\\w]+}", am.RequireScope(model.SCOPE_EVENTS_WRITE, ed.RemoveEvent)).Methods(http.MethodDelete, http.MethodOptions)
 
-	ev.HandleFunc("/accept/{event_id:[\\w]+}", ed.AcceptInvite).Methods(http.MethodPost, http.MethodOptions)
-	ev.HandleFunc("/invites", ed.GetInvites).Methods(http.MethodGet, http.MethodOptions)
-	ev.HandleFunc("/reject/{event_id:[\\w]+}", ed.RejectInvite).Methods(http.MethodPost, http.MethodOptions)
+	ev.Handle("/accept/{event_id:[\\w]+}", am.RequireScope(model.SCOPE_INVITES_WRITE, ed.AcceptInvite)).Methods(http.MethodPost, http.MethodOptions)
+	ev.Handle("/invites", am.RequireScope(model.SCOPE_EVENTS_READ, ed.GetInvites)).Methods(http.MethodGet, http.MethodOptions)
+	ev.Handle("/reject/{event_id:[\\w]+}", am.RequireScope(model.SCOPE_INVITES_WRITE, ed.RejectInvite)).Methods(http.MethodPost, http.MethodOptions)
 }
 
 func (ed *EventsDelivery) CreateEvent(w http.ResponseWriter, r *http.Request) {
@@ -53,29 +54,23 @@ func (ed *EventsDelivery) CreateEvent(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	buf, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		ed.logger.Warnf("[CreateEvent] cannot convert body to bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ed.logger.WithContext(r.Context()).Warnf("[CreateEvent] cannot convert body to bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
 	err = json.Unmarshal(buf, &eventModel)
 	if err != nil {
-		ed.logger.Warnf("[CreateEvent] cannot unmarshal bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ed.logger.WithContext(r.Context()).Warnf("[CreateEvent] cannot unmarshal bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
-	eventId, err := ed.eventUsecase.CreateEvent(eventModel, usr.Login)
+	eventId, err := ed.eventUsecase(r).CreateEvent(r.Context(), eventModel, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[CreateEvent] user not registered: %s", err.Error())
-		switch err {
-		case errors.LoginAlreadyExists, errors.EmailAlreadyExists:
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		ed.logger.WithContext(r.Context()).Warnf("[CreateEvent] event not created: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -88,35 +83,23 @@ func (ed *EventsDelivery) EditEvent(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	buf, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		ed.logger.Warnf("[CreateEvent] cannot convert body to bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ed.logger.WithContext(r.Context()).Warnf("[EditEvent] cannot convert body to bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
 	err = json.Unmarshal(buf, &eventModel)
 	if err != nil {
-		ed.logger.Warnf("[CreateEvent] cannot unmarshal bytes: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ed.logger.WithContext(r.Context()).Warnf("[EditEvent] cannot unmarshal bytes: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
 		return
 	}
 
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
-	event, err := ed.eventUsecase.EditEvent(eventModel, usr.Login)
+	event, err := ed.eventUsecase(r).EditEvent(r.Context(), eventModel, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[EditEvent] event not edited: %s", err.Error())
-		switch err {
-		case errors.EventNotFound:
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		case errors.HasNoRights:
-			w.WriteHeader(http.StatusForbidden)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		case errors.EventNotEdited:
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		ed.logger.WithContext(r.Context()).Warnf("[EditEvent] event not edited: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -129,16 +112,10 @@ func (ed *EventsDelivery) GetEvent(w http.ResponseWriter, r *http.Request) {
 	eventId := vars["event_id"]
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
 
-	event, err := ed.eventUsecase.GetEvent(eventId, usr.Login)
+	event, err := ed.eventUsecase(r).GetEvent(r.Context(), eventId, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[GetEvent] event not found: %s", err.Error())
-		switch err {
-		case errors.EventNotFound:
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		ed.logger.WithContext(r.Context()).Warnf("[GetEvent] event not found: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -148,52 +125,50 @@ func (ed *EventsDelivery) GetEvent(w http.ResponseWriter, r *http.Request) {
 
 const DEFAULT_DAYS_INTERVAL = 30
 
-func getFromToCgies(cgies url.Values) (int64, int64) {
+func getFromToCgies(cgies url.Values) (int64, int64, error) {
 	fromStr := cgies.Get("from")
 	toStr := cgies.Get("to")
 	from := int64(0)
 	to := int64(0)
 	var err error
+	v := validation.NewValidator()
 
 	if fromStr == "" {
 		from = time.Now().Unix() - DEFAULT_DAYS_INTERVAL*24*60*60
 	} else {
 		from, err = strconv.ParseInt(fromStr, 10, 64)
-		if err != nil {
-			return 0, 0
-		}
+		v.Check(err == nil, "from", "must be unix timestamp")
 	}
 
 	if toStr == "" {
 		to = time.Now().Unix() + DEFAULT_DAYS_INTERVAL*24*60*60
 	} else {
 		to, err = strconv.ParseInt(toStr, 10, 64)
-		if err != nil {
-			return 0, 0
-		}
+		v.Check(err == nil, "to", "must be unix timestamp")
 	}
 
-	return from, to
+	return from, to, v.Err()
 }
 
 func (ed *EventsDelivery) GetAllEvents(w http.ResponseWriter, r *http.Request) {
-	from, to := getFromToCgies(r.URL.Query())
-	if from == 0 || to == 0 {
-		ed.logger.Warnln("[GetAllEvents] could not parse from to cgies")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`{"message": "could not parse from to cgies"}`))
+	from, to, err := getFromToCgies(r.URL.Query())
+	if err != nil {
+		ed.logger.WithContext(r.Context()).Warnf("[GetAllEvents] could not parse from to cgies: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
+	viewer := r.Context().Value(middleware.ContextUserKey).(*model.User).Login
 	login := r.URL.Query().Get("login")
 	if login == "" {
-		login = r.Context().Value(middleware.ContextUserKey).(*model.User).Login
+		login = viewer
 	}
 
-	events, err := ed.eventUsecase.GetAllEvents(login, from, to)
+	calendar := r.URL.Query().Get(model.CalendarCgi)
+	events, err := ed.eventUsecase(r).GetAllEvents(r.Context(), login, viewer, from, to, calendar)
 	if err != nil {
-		ed.logger.Warnf("[GetAllEvents] events not found: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		ed.logger.WithContext(r.Context()).Warnf("[GetAllEvents] events not found: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -206,19 +181,10 @@ func (ed *EventsDelivery) RemoveEvent(w http.ResponseWriter, r *http.Request) {
 	eventId := vars["event_id"]
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
 
-	err := ed.eventUsecase.RemoveEvent(eventId, usr.Login)
+	err := ed.eventUsecase(r).RemoveEvent(r.Context(), eventId, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[RemoveEvent] event not found: %s", err.Error())
-		switch err {
-		case errors.EventNotFound:
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		case errors.HasNoRights:
-			w.WriteHeader(http.StatusForbidden)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		ed.logger.WithContext(r.Context()).Warnf("[RemoveEvent] event not found: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -229,16 +195,10 @@ func (ed *EventsDelivery) RemoveEvent(w http.ResponseWriter, r *http.Request) {
 func (ed *EventsDelivery) AcceptInvite(w http.ResponseWriter, r *http.Request) {
 	eventId := mux.Vars(r)["event_id"]
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
-	err := ed.eventUsecase.AcceptInvite(eventId, usr.Login)
+	err := ed.eventUsecase(r).AcceptInvite(r.Context(), eventId, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[AcceptInvite] event not found: %s", err.Error())
-		switch err {
-		case errors.EventNotFound:
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		ed.logger.WithContext(r.Context()).Warnf("[AcceptInvite] event not found: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -261,19 +221,15 @@ func (ed *EventsDelivery) GetInvites(w http.ResponseWriter, r *http.Request) {
 	cgi, cgi_type := parseEventUserQuery(r)
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
 
-	invites, err := ed.eventUsecase.GetInvites(cgi, cgi_type, usr.Login)
+	invites, err := ed.eventUsecase(r).GetInvites(r.Context(), cgi, cgi_type, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[GetInvites] GetInvites: %s", err.Error())
-		switch err {
-		case errors.BadInviteCgi:
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		case errors.InviteNotFound:
+		ed.logger.WithContext(r.Context()).Warnf("[GetInvites] GetInvites: %s", err.Error())
+		if err == errors.InviteNotFound {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(`{"message": "ok", "invites": []}`))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
+		errors.Write(w, r, err)
 		return
 	}
 
@@ -284,16 +240,10 @@ func (ed *EventsDelivery) GetInvites(w http.ResponseWriter, r *http.Request) {
 func (ed *EventsDelivery) RejectInvite(w http.ResponseWriter, r *http.Request) {
 	eventId := mux.Vars(r)["event_id"]
 	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
-	err := ed.eventUsecase.RejectInvite(eventId, usr.Login)
+	err := ed.eventUsecase(r).RejectInvite(r.Context(), eventId, usr.Login)
 	if err != nil {
-		ed.logger.Warnf("[RejectInvite]: %s", err.Error())
-		switch err {
-		case errors.EventNotFound:
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errors.ErrorToBytes(err)))
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		ed.logger.WithContext(r.Context()).Warnf("[RejectInvite]: %s", err.Error())
+		errors.Write(w, r, err)
 		return
 	}
 
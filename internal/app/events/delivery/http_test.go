@@ -0,0 +1,456 @@
+package delivery
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nocalendar/internal/app/calendars"
+	changes_delivery "nocalendar/internal/app/changes/delivery"
+	changes_usecase "nocalendar/internal/app/changes/usecase"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/events/usecase"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/stream/broker"
+	stream_delivery "nocalendar/internal/app/stream/delivery"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	TEST_EVENT_ID    = "teamevent"
+	TEST_CALENDAR_ID = "work"
+	TEST_TIMESTAMP   = 1700000000
+)
+
+// fakeEvents keeps events as maps, the way mongo repository returns them
+type fakeEvents struct {
+	events.EventsRepository
+	events map[string]interface{}
+}
+
+func (fe *fakeEvents) InsertSingleEvent(ctx context.Context, event *model.SingleEvent, mode string) error {
+	raw, err := bson.Marshal(event)
+	if err != nil {
+		return err
+	}
+	doc := map[string]interface{}{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	fe.events[event.Id] = doc
+	return nil
+}
+
+func (fe *fakeEvents) GetEvent(ctx context.Context, eventId string) (interface{}, string, error) {
+	event, ok := fe.events[eventId]
+	if !ok {
+		return nil, "", errors.EventNotFound
+	}
+	return event, model.SINGLE_EVENT, nil
+}
+
+func (fe *fakeEvents) GetEventsIdsByLogin(ctx context.Context, login string) ([]string, error) {
+	ids := make([]string, 0)
+	for id, event := range fe.events {
+		if isMember(model.ConvertInterfaceToEvent(event, model.SINGLE_EVENT).Members, login) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// fakeCalendars knows only calendar of alice
+type fakeCalendars struct {
+	calendars.CalendarsRepository
+	calendar *model.Calendar
+	events   []string
+}
+
+func (fc *fakeCalendars) GetCalendar(ctx context.Context, calendarId string) (*model.Calendar, error) {
+	if calendarId != fc.calendar.Id {
+		return nil, errors.CalendarNotFound
+	}
+	return fc.calendar, nil
+}
+
+func (fc *fakeCalendars) GetCalendarsByOwner(ctx context.Context, owner string) ([]*model.Calendar, error) {
+	if owner != fc.calendar.Owner {
+		return []*model.Calendar{}, nil
+	}
+	return []*model.Calendar{fc.calendar}, nil
+}
+
+func (fc *fakeCalendars) GetSubscriptions(ctx context.Context, login string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (fc *fakeCalendars) GetEventIdsByCalendar(ctx context.Context, calendarId string) ([]string, error) {
+	return fc.events, nil
+}
+
+type fakeGroups struct {
+	groups.GroupsRepository
+	groups []*model.Group
+}
+
+func (fg *fakeGroups) GetGroups(ctx context.Context) ([]*model.Group, error) {
+	return fg.groups, nil
+}
+
+func (fg *fakeGroups) GetGroup(ctx context.Context, groupId string) (*model.Group, error) {
+	for _, group := range fg.groups {
+		if group.Id == groupId {
+			return group, nil
+		}
+	}
+	return nil, errors.GroupNotFound
+}
+
+type fakeChanges struct {
+	changes []*model.Change
+}
+
+func (fc *fakeChanges) InsertChange(ctx context.Context, change *model.Change) error {
+	change.Seq = int64(len(fc.changes)) + 1
+	fc.changes = append(fc.changes, change)
+	return nil
+}
+
+func (fc *fakeChanges) GetSeq(ctx context.Context) (int64, error) {
+	return int64(len(fc.changes)), nil
+}
+
+func (fc *fakeChanges) GetChangesSince(ctx context.Context, since int64) ([]*model.Change, error) {
+	return fc.changes[since:], nil
+}
+
+func isMember(members []string, login string) bool {
+	for _, member := range members {
+		if member == login {
+			return true
+		}
+	}
+	return false
+}
+
+// viewers of the event: alice is author, bob is participant, carol and dave have roles
+// on calendar of the event, frank gets role of his group and erin has no rights at all
+var viewers = []struct {
+	login string
+	role  string
+}{
+	{"alice", model.ROLE_MANAGE},
+	{"bob", model.ROLE_WRITE},
+	{"carol", model.ROLE_READ},
+	{"frank", model.ROLE_READ},
+	{"dave", model.ROLE_FREEBUSY},
+	{"erin", model.ROLE_NONE},
+}
+
+// what viewer sees of the event
+const (
+	VIEW_FULL   = "full"
+	VIEW_BUSY   = "busy"
+	VIEW_HIDDEN = "hidden"
+)
+
+var views = map[string]map[string]string{
+	model.VISIBILITY_PUBLIC: {
+		"alice": VIEW_FULL, "bob": VIEW_FULL, "carol": VIEW_FULL, "frank": VIEW_FULL, "dave": VIEW_FULL, "erin": VIEW_FULL,
+	},
+	model.VISIBILITY_BUSY: {
+		"alice": VIEW_FULL, "bob": VIEW_FULL, "carol": VIEW_FULL, "frank": VIEW_FULL, "dave": VIEW_BUSY, "erin": VIEW_BUSY,
+	},
+	model.VISIBILITY_PRIVATE: {
+		"alice": VIEW_FULL, "bob": VIEW_FULL, "carol": VIEW_BUSY, "frank": VIEW_BUSY, "dave": VIEW_BUSY, "erin": VIEW_HIDDEN,
+	},
+}
+
+var visibilities = []string{model.VISIBILITY_PUBLIC, model.VISIBILITY_BUSY, model.VISIBILITY_PRIVATE}
+
+// newServices returns services of organization with one event of alice in her calendar
+func newServices(t *testing.T, visibility string) *tenant.Services {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	er := &fakeEvents{events: map[string]interface{}{}}
+	event := &model.Event{
+		Id:            TEST_EVENT_ID,
+		Title:         "planning",
+		Description:   "secret agenda",
+		Timestamp:     TEST_TIMESTAMP,
+		Members:       []string{"alice", "bob"},
+		ActiveMembers: []string{"alice"},
+		Author:        "alice",
+		Calendar:      TEST_CALENDAR_ID,
+		Visibility:    visibility,
+	}
+	if err := er.InsertSingleEvent(context.Background(), event.ToSingle(""), model.SINGLE_EVENT); err != nil {
+		t.Fatalf("InsertSingleEvent: %s", err.Error())
+	}
+
+	clr := &fakeCalendars{
+		calendar: &model.Calendar{
+			Id:    TEST_CALENDAR_ID,
+			Owner: "alice",
+			Acl: map[string]string{
+				"carol":      model.ROLE_READ,
+				"dave":       model.ROLE_FREEBUSY,
+				"group:team": model.ROLE_READ,
+			},
+		},
+		events: []string{TEST_EVENT_ID},
+	}
+	gr := &fakeGroups{groups: []*model.Group{{Id: "team", Owner: "alice", Members: []string{"alice", "frank"}}}}
+	cr := &fakeChanges{}
+	b := broker.NewLocalBroker(logger)
+	t.Cleanup(b.Close)
+
+	return &tenant.Services{
+		Org:     &model.Org{Id: model.DEFAULT_ORG},
+		Events:  usecase.NewEventsUsecase(er, nil, clr, cr, gr, b, logger),
+		Changes: changes_usecase.NewChangesUsecase(cr, logger),
+		Broker:  b,
+	}
+}
+
+// withUser puts services and user to context as tenant and auth middlewares do
+func withUser(r *http.Request, services *tenant.Services, login string) *http.Request {
+	ctx := tenant.NewContext(r.Context(), services)
+	ctx = context.WithValue(ctx, middleware.ContextUserKey, &model.User{Login: login})
+	return r.WithContext(ctx)
+}
+
+func serve(t *testing.T, services *tenant.Services, login string, handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, withUser(r, services, login))
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, answer interface{}) {
+	if err := json.Unmarshal(w.Body.Bytes(), answer); err != nil {
+		t.Fatalf("cannot parse answer %s: %s", w.Body.String(), err.Error())
+	}
+}
+
+// checkView compares event with the view expected for viewer
+func checkView(t *testing.T, event *model.Event, view string) {
+	if event.Id != TEST_EVENT_ID || event.Timestamp != TEST_TIMESTAMP || event.Calendar != TEST_CALENDAR_ID {
+		t.Errorf("event = %+v, want time and calendar of %s", event, TEST_EVENT_ID)
+	}
+
+	switch view {
+	case VIEW_FULL:
+		if event.Title != "planning" || event.Description != "secret agenda" || len(event.Members) != 2 || event.Author != "alice" {
+			t.Errorf("event = %+v, want whole event", event)
+		}
+	case VIEW_BUSY:
+		if event.Title != "" || event.Description != "" || len(event.Members) != 0 || len(event.ActiveMembers) != 0 || event.Author != "" {
+			t.Errorf("event = %+v, want only time of event", event)
+		}
+	}
+}
+
+func TestGetEventRedaction(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ed := NewEventsDelivery(logger)
+	for _, visibility := range visibilities {
+		for _, viewer := range viewers {
+			t.Run(visibility+"/"+viewer.role+"/"+viewer.login, func(t *testing.T) {
+				services := newServices(t, visibility)
+				r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/event/one/"+TEST_EVENT_ID, nil),
+					map[string]string{"event_id": TEST_EVENT_ID})
+				w := serve(t, services, viewer.login, ed.GetEvent, r)
+
+				view := views[visibility][viewer.login]
+				if view == VIEW_HIDDEN {
+					if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "planning") {
+						t.Errorf("answer = %d %s, want %d", w.Code, w.Body.String(), http.StatusForbidden)
+					}
+					return
+				}
+				if w.Code != http.StatusOK {
+					t.Fatalf("answer = %d %s, want %d", w.Code, w.Body.String(), http.StatusOK)
+				}
+				answer := struct {
+					Event *model.Event `json:"event"`
+				}{}
+				decode(t, w, &answer)
+				checkView(t, answer.Event, view)
+			})
+		}
+	}
+}
+
+func TestGetAllEventsRedaction(t *testing.T) {
+	paths := []struct {
+		name  string
+		query string
+		found bool
+	}{
+		{"all", "", true},
+		{"by calendar", "&calendar=" + TEST_CALENDAR_ID, true},
+		{"by other calendar", "&calendar=other", false},
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ed := NewEventsDelivery(logger)
+	for _, path := range paths {
+		for _, visibility := range visibilities {
+			for _, viewer := range viewers {
+				t.Run(path.name+"/"+visibility+"/"+viewer.role+"/"+viewer.login, func(t *testing.T) {
+					services := newServices(t, visibility)
+					// viewers look at calendar of alice
+					r := httptest.NewRequest(http.MethodGet, "/api/event/all?login=alice&from=1690000000&to=1710000000"+path.query, nil)
+					w := serve(t, services, viewer.login, ed.GetAllEvents, r)
+					if w.Code != http.StatusOK {
+						t.Fatalf("answer = %d %s, want %d", w.Code, w.Body.String(), http.StatusOK)
+					}
+					answer := model.JsonEvents{}
+					decode(t, w, &answer)
+
+					view := views[visibility][viewer.login]
+					if !path.found || view == VIEW_HIDDEN {
+						if len(answer.Events) != 0 {
+							t.Errorf("events = %s, want none", w.Body.String())
+						}
+						return
+					}
+					if len(answer.Events) != 1 {
+						t.Fatalf("events = %s, want one event", w.Body.String())
+					}
+					checkView(t, answer.Events[0], view)
+				})
+			}
+		}
+	}
+}
+
+// editEvent renames the event on behalf of alice
+func editEvent(t *testing.T, services *tenant.Services, ed *EventsDelivery) {
+	body := `{"id": "` + TEST_EVENT_ID + `", "title": "retro", "description": "new agenda"}`
+	w := serve(t, services, "alice", ed.EditEvent, httptest.NewRequest(http.MethodPost, "/api/event/edit", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit event = %d %s", w.Code, w.Body.String())
+	}
+}
+
+// Change feed carries only ids of events. Participants and everyone with role on calendar of
+// the event get them and learn details only from read endpoints, which redact the event
+func TestChangesOfEventRedaction(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ed := NewEventsDelivery(logger)
+	cd := changes_delivery.NewChangesDelivery(logger)
+	for _, visibility := range visibilities {
+		services := newServices(t, visibility)
+		editEvent(t, services, ed)
+
+		for _, viewer := range viewers {
+			t.Run(visibility+"/"+viewer.role+"/"+viewer.login, func(t *testing.T) {
+				w := serve(t, services, viewer.login, cd.Sync, httptest.NewRequest(http.MethodGet, "/api/sync?since=0", nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("answer = %d %s, want %d", w.Code, w.Body.String(), http.StatusOK)
+				}
+				if body := w.Body.String(); strings.Contains(body, "retro") || strings.Contains(body, "agenda") {
+					t.Errorf("change feed = %s, want no details of event", body)
+				}
+
+				answer := model.SyncAnswer{}
+				decode(t, w, &answer)
+				updated := len(answer.Updated) == 1 && answer.Updated[0] == TEST_EVENT_ID
+				audience := viewer.role != model.ROLE_NONE
+				if updated != audience || len(answer.Created) != 0 || len(answer.Deleted) != 0 {
+					t.Errorf("change feed = %s, want update of event %v", w.Body.String(), audience)
+				}
+			})
+		}
+	}
+}
+
+// readNotification returns next notification of stream skipping comments
+func readNotification(t *testing.T, events *bufio.Reader) *model.Notification {
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("cannot read stream: %s", err.Error())
+		}
+		if strings.Contains(line, "retro") || strings.Contains(line, "agenda") {
+			t.Errorf("stream line %q has details of event", line)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		notification := &model.Notification{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), notification); err != nil {
+			t.Fatalf("cannot parse notification %q: %s", line, err.Error())
+		}
+		return notification
+	}
+}
+
+func TestStreamOfEventRedaction(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ed := NewEventsDelivery(logger)
+	sd := stream_delivery.NewStreamDelivery(logger)
+	logins := make([]string, 0, len(viewers))
+	for _, viewer := range viewers {
+		logins = append(logins, viewer.login)
+	}
+
+	for _, visibility := range visibilities {
+		t.Run(visibility, func(t *testing.T) {
+			services := newServices(t, visibility)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sd.Stream(w, withUser(r, services, r.URL.Query().Get("login")))
+			}))
+			defer srv.Close()
+			client := &http.Client{Timeout: 5 * time.Second}
+
+			streams := make(map[string]*bufio.Reader)
+			for _, login := range logins {
+				resp, err := client.Get(srv.URL + "/api/stream?login=" + login)
+				if err != nil {
+					t.Fatalf("cannot open stream of %s: %s", login, err.Error())
+				}
+				defer resp.Body.Close()
+				streams[login] = bufio.NewReader(resp.Body)
+				// stream is subscribed when greeting is written
+				if line, err := streams[login].ReadString('\n'); err != nil || line != ": connected\n" {
+					t.Fatalf("greeting of %s = %q, %v", login, line, err)
+				}
+			}
+
+			editEvent(t, services, ed)
+			// marks end of notifications caused by edit
+			services.Broker.Publish(logins, &model.Notification{Type: "end", Timestamp: time.Now().Unix()})
+
+			for _, viewer := range viewers {
+				notification := readNotification(t, streams[viewer.login])
+				if model.HasRole(viewer.role, model.ROLE_WRITE) {
+					if notification.Type != model.NotificationEventChanged || notification.EventId != TEST_EVENT_ID {
+						t.Errorf("notification of %s = %+v, want change of event", viewer.login, notification)
+					}
+					notification = readNotification(t, streams[viewer.login])
+				}
+				if notification.Type != "end" {
+					t.Errorf("notification of %s = %+v, want end", viewer.login, notification)
+				}
+			}
+		})
+	}
+}
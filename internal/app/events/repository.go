@@ -1,20 +1,23 @@
 package events
 
-import "nocalendar/internal/model"
+import (
+	"context"
+	"nocalendar/internal/model"
+)
 
 type EventsRepository interface {
-	InsertRegularEvent(event *model.RegularEvent, mode string) error
-	InsertSingleEvent(event *model.SingleEvent, mode string) error
+	InsertRegularEvent(ctx context.Context, event *model.RegularEvent, mode string) error
+	InsertSingleEvent(ctx context.Context, event *model.SingleEvent, mode string) error
 
-	GetEvent(eventId string) (interface{}, string, error)
-	GetEventsIdsByLogin(login string) ([]string, error)
-	RemoveEvent(eventId, mode string) error
-	GetAllMembers() (map[string][]string, error)
-	RemoveEventIdFromMember(login, eventId string) error
-	GetAllEventIds() ([]string, error)
+	GetEvent(ctx context.Context, eventId string) (interface{}, string, error)
+	GetEventsIdsByLogin(ctx context.Context, login string) ([]string, error)
+	RemoveEvent(ctx context.Context, eventId, mode string) error
+	GetAllMembers(ctx context.Context) (map[string][]string, error)
+	RemoveEventIdFromMember(ctx context.Context, login, eventId string) error
+	GetAllEventIds(ctx context.Context) ([]string, error)
 
-	InsertInvite(login, event_id string) error
-	CheckInvite(login, event_id string) error
-	RemoveInvite(login, event_id string) error
-	GetInviteByLogin(login string) ([]string, error)
+	InsertInvite(ctx context.Context, login, event_id string) error
+	CheckInvite(ctx context.Context, login, event_id string) error
+	RemoveInvite(ctx context.Context, login, event_id string) error
+	GetInviteByLogin(ctx context.Context, login string) ([]string, error)
 }
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"nocalendar/internal/app/errors"
 	"nocalendar/internal/app/events"
@@ -25,9 +26,9 @@ func NewEventsRepository(db *db.Database, logger *logrus.Logger) events.EventsRe
 	}
 }
 
-func (er *EventsRepository) addEventToMember(members []string, eventId string) error {
+func (er *EventsRepository) addEventToMember(ctx context.Context, members []string, eventId string) error {
 	filter := bson.M{
-		"_id": "json/members",
+		"_id": er.mongo.Doc("json/members"),
 	}
 
 	for _, member := range members {
@@ -37,18 +38,21 @@ func (er *EventsRepository) addEventToMember(members []string, eventId string) e
 			},
 		}
 
-		_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+		_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 		if err != nil {
-			er.logger.Warnf("[addEventToMember] UpdateOne: %s", err.Error())
-			return errors.InternalError
+			er.logger.WithContext(ctx).Warnf("[addEventToMember] UpdateOne: %s", err.Error())
+			return db.StorageError(ctx, err)
 		}
 	}
 	return nil
 }
 
-func (er *EventsRepository) InsertRegularEvent(event *model.RegularEvent, mode string) error {
+func (er *EventsRepository) InsertRegularEvent(ctx context.Context, event *model.RegularEvent, mode string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "InsertRegularEvent")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/events",
+		"_id": er.mongo.Doc("json/events"),
 	}
 
 	body := bson.M{
@@ -57,19 +61,22 @@ func (er *EventsRepository) InsertRegularEvent(event *model.RegularEvent, mode s
 		},
 	}
 
-	_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+	_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		er.logger.Warnf("[InsertRegularEvent] UpdateOne: %s", err.Error())
-		return errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[InsertRegularEvent] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
 
-	err = er.addEventToMember(event.Members, event.Id)
+	err = er.addEventToMember(ctx, event.Members, event.Id)
 	return err
 }
 
-func (er *EventsRepository) InsertSingleEvent(event *model.SingleEvent, mode string) error {
+func (er *EventsRepository) InsertSingleEvent(ctx context.Context, event *model.SingleEvent, mode string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "InsertSingleEvent")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/events",
+		"_id": er.mongo.Doc("json/events"),
 	}
 
 	body := bson.M{
@@ -78,21 +85,21 @@ func (er *EventsRepository) InsertSingleEvent(event *model.SingleEvent, mode str
 		},
 	}
 
-	_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+	_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		er.logger.Warnf("[InsertSingleEvent] UpdateOne: %s", err.Error())
-		return errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[InsertSingleEvent] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
 
-	err = er.addEventToMember(event.Members, event.Id)
+	err = er.addEventToMember(ctx, event.Members, event.Id)
 	return err
 }
 
-func (er *EventsRepository) getRegularEvent(eventId string) (interface{}, error) {
+func (er *EventsRepository) getRegularEvent(ctx context.Context, eventId string) (interface{}, error) {
 	doc := &model.BsonRegularEvent{}
 	opts := options.FindOne()
 	opts.SetProjection(bson.M{fmt.Sprintf("regular.%s", eventId): 1})
-	err := er.mongo.Conn.FindOne(er.mongo.Ctx, bson.M{"_id": "json/events"}, opts).Decode(doc)
+	err := er.mongo.Conn.FindOne(ctx, bson.M{"_id": er.mongo.Doc("json/events")}, opts).Decode(doc)
 	switch err {
 	case nil:
 		if _, ok := doc.Events[eventId]; !ok {
@@ -102,15 +109,15 @@ func (er *EventsRepository) getRegularEvent(eventId string) (interface{}, error)
 	case mongo.ErrNoDocuments:
 		return nil, errors.EventNotFound
 	default:
-		return nil, errors.InternalError
+		return nil, db.StorageError(ctx, err)
 	}
 }
 
-func (er *EventsRepository) getSingleEvent(eventId string) (interface{}, error) {
+func (er *EventsRepository) getSingleEvent(ctx context.Context, eventId string) (interface{}, error) {
 	doc := &model.BsonSingleEvent{}
 	opts := options.FindOne()
 	opts.SetProjection(bson.M{fmt.Sprintf("single.%s", eventId): 1})
-	err := er.mongo.Conn.FindOne(er.mongo.Ctx, bson.M{"_id": "json/events"}, opts).Decode(doc)
+	err := er.mongo.Conn.FindOne(ctx, bson.M{"_id": er.mongo.Doc("json/events")}, opts).Decode(doc)
 	switch err {
 	case nil:
 		if _, ok := doc.Events[eventId]; !ok {
@@ -120,39 +127,45 @@ func (er *EventsRepository) getSingleEvent(eventId string) (interface{}, error)
 	case mongo.ErrNoDocuments:
 		return nil, errors.EventNotFound
 	default:
-		return nil, errors.InternalError
+		return nil, db.StorageError(ctx, err)
 	}
 }
 
-func (er *EventsRepository) GetEvent(eventId string) (interface{}, string, error) {
-	event, err := er.getRegularEvent(eventId)
+func (er *EventsRepository) GetEvent(ctx context.Context, eventId string) (interface{}, string, error) {
+	ctx, end := er.mongo.Call(ctx, "events", "GetEvent")
+	defer end()
+
+	event, err := er.getRegularEvent(ctx, eventId)
 	switch err {
 	case nil:
 		return event, model.REGULAR_EVENT, nil
 	case errors.EventNotFound:
 		break
-	case errors.InternalError:
+	default:
 		return nil, "", err
 	}
 
-	event, err = er.getSingleEvent(eventId)
+	event, err = er.getSingleEvent(ctx, eventId)
 	switch err {
 	case nil:
 		return event, model.SINGLE_EVENT, nil
 	case errors.EventNotFound:
 		break
-	case errors.InternalError:
+	default:
 		return nil, "", err
 	}
 
 	return nil, "", errors.EventNotFound
 }
 
-func (er *EventsRepository) GetEventsIdsByLogin(login string) ([]string, error) {
+func (er *EventsRepository) GetEventsIdsByLogin(ctx context.Context, login string) ([]string, error) {
+	ctx, end := er.mongo.Call(ctx, "events", "GetEventsIdsByLogin")
+	defer end()
+
 	doc := &model.BsonMembers{}
 	opts := options.FindOne()
 	opts.SetProjection(bson.M{fmt.Sprintf("members.%s", login): 1})
-	err := er.mongo.Conn.FindOne(er.mongo.Ctx, bson.M{"_id": "json/members"}, opts).Decode(doc)
+	err := er.mongo.Conn.FindOne(ctx, bson.M{"_id": er.mongo.Doc("json/members")}, opts).Decode(doc)
 	switch err {
 	case nil:
 		if len(doc.Members) == 0 {
@@ -162,13 +175,16 @@ func (er *EventsRepository) GetEventsIdsByLogin(login string) ([]string, error)
 	case mongo.ErrNoDocuments:
 		return nil, errors.MemberNotFound
 	default:
-		return nil, errors.InternalError
+		return nil, db.StorageError(ctx, err)
 	}
 }
 
-func (er *EventsRepository) RemoveEvent(eventId, mode string) error {
+func (er *EventsRepository) RemoveEvent(ctx context.Context, eventId, mode string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "RemoveEvent")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/events",
+		"_id": er.mongo.Doc("json/events"),
 	}
 
 	body := bson.M{
@@ -177,38 +193,44 @@ func (er *EventsRepository) RemoveEvent(eventId, mode string) error {
 		},
 	}
 
-	_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+	_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		er.logger.Warnf("[RemoveEvent] UpdateOne: %s", err.Error())
-		return errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[RemoveEvent] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
 	return nil
 }
 
-func (er *EventsRepository) GetAllMembers() (map[string][]string, error) {
+func (er *EventsRepository) GetAllMembers(ctx context.Context) (map[string][]string, error) {
+	ctx, end := er.mongo.Call(ctx, "events", "GetAllMembers")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/members",
+		"_id": er.mongo.Doc("json/members"),
 	}
 
-	doc := er.mongo.Conn.FindOne(er.mongo.Ctx, filter)
+	doc := er.mongo.Conn.FindOne(ctx, filter)
 	if doc.Err() != nil {
-		er.logger.Warnf("[GetAllMembers] FindOne: %s", doc.Err().Error())
-		return nil, errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[GetAllMembers] FindOne: %s", doc.Err().Error())
+		return nil, db.StorageError(ctx, doc.Err())
 	}
 
 	hm := &model.BsonMembers{}
 	err := doc.Decode(hm)
 	if err != nil {
-		er.logger.Warnf("[GetAllMembers] Decode: %s", err.Error())
-		return nil, errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[GetAllMembers] Decode: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
 	}
 
 	return hm.Members, nil
 }
 
-func (er *EventsRepository) RemoveEventIdFromMember(login, eventId string) error {
+func (er *EventsRepository) RemoveEventIdFromMember(ctx context.Context, login, eventId string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "RemoveEventIdFromMember")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/members",
+		"_id": er.mongo.Doc("json/members"),
 	}
 
 	body := bson.M{
@@ -217,18 +239,21 @@ func (er *EventsRepository) RemoveEventIdFromMember(login, eventId string) error
 		},
 	}
 
-	_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+	_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		er.logger.Warnf("[RemoveEventIdFromMember] UpdateOne: %s", err.Error())
-		return errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[RemoveEventIdFromMember] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
 	return nil
 }
 
-func (er *EventsRepository) GetAllEventIds() ([]string, error) {
+func (er *EventsRepository) GetAllEventIds(ctx context.Context) ([]string, error) {
+	ctx, end := er.mongo.Call(ctx, "events", "GetAllEventIds")
+	defer end()
+
 	step1 := bson.M{
 		"$match": bson.M{
-			"_id": "json/events",
+			"_id": er.mongo.Doc("json/events"),
 		},
 	}
 
@@ -247,22 +272,22 @@ func (er *EventsRepository) GetAllEventIds() ([]string, error) {
 	}
 
 	pipeline := []bson.M{step1, step2, step3}
-	cursor, err := er.mongo.Conn.Aggregate(er.mongo.Ctx, pipeline)
+	cursor, err := er.mongo.Conn.Aggregate(ctx, pipeline)
 	if err != nil {
-		er.logger.Warnf("[GetAllEventIds] Aggregate: %s", err.Error())
-		return nil, errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[GetAllEventIds] Aggregate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
 	}
-	defer cursor.Close(er.mongo.Ctx)
+	defer cursor.Close(ctx)
 
 	doc := make([]bson.M, 0)
-	err = cursor.All(er.mongo.Ctx, &doc)
+	err = cursor.All(ctx, &doc)
 	if err != nil {
-		er.logger.Warnf("[GetAllEventIds] All: %s", err.Error())
-		return nil, errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[GetAllEventIds] All: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
 	}
 
 	if len(doc) != 1 {
-		er.logger.Warnf("[GetAllEventIds] returned non 1 document: %d", len(doc))
+		er.logger.WithContext(ctx).Warnf("[GetAllEventIds] returned non 1 document: %d", len(doc))
 		return nil, errors.InternalError
 	}
 
@@ -274,9 +299,12 @@ func (er *EventsRepository) GetAllEventIds() ([]string, error) {
 	return eventIds, nil
 }
 
-func (er *EventsRepository) InsertInvite(login, event_id string) error {
+func (er *EventsRepository) InsertInvite(ctx context.Context, login, event_id string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "InsertInvite")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/invites",
+		"_id": er.mongo.Doc("json/invites"),
 	}
 
 	body := bson.M{
@@ -285,25 +313,28 @@ func (er *EventsRepository) InsertInvite(login, event_id string) error {
 		},
 	}
 
-	_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+	_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		er.logger.Warnf("[InsertInvite] UpdateOne: %s", err.Error())
-		return errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[InsertInvite] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
 	return nil
 }
 
-func (er *EventsRepository) CheckInvite(login, event_id string) error {
+func (er *EventsRepository) CheckInvite(ctx context.Context, login, event_id string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "CheckInvite")
+	defer end()
+
 	doc := &model.InviteBson{}
 	doc.Invites = make(map[string][]string, 0)
 	body := bson.M{
-		"_id": "json/invites",
+		"_id": er.mongo.Doc("json/invites"),
 	}
 
 	opts := options.FindOne()
 	opts.SetProjection(bson.M{fmt.Sprintf("invites.%s", login): 1})
 
-	err := er.mongo.Conn.FindOne(er.mongo.Ctx, body).Decode(doc)
+	err := er.mongo.Conn.FindOne(ctx, body).Decode(doc)
 	switch err {
 	case nil:
 		if len(doc.Invites) == 0 {
@@ -323,13 +354,16 @@ func (er *EventsRepository) CheckInvite(login, event_id string) error {
 	case mongo.ErrNoDocuments:
 		return errors.InviteNotFound
 	default:
-		return errors.InternalError
+		return db.StorageError(ctx, err)
 	}
 }
 
-func (er *EventsRepository) RemoveInvite(login, event_id string) error {
+func (er *EventsRepository) RemoveInvite(ctx context.Context, login, event_id string) error {
+	ctx, end := er.mongo.Call(ctx, "events", "RemoveInvite")
+	defer end()
+
 	filter := bson.M{
-		"_id": "json/invites",
+		"_id": er.mongo.Doc("json/invites"),
 	}
 
 	body := bson.M{
@@ -338,25 +372,28 @@ func (er *EventsRepository) RemoveInvite(login, event_id string) error {
 		},
 	}
 
-	_, err := er.mongo.Conn.UpdateOne(er.mongo.Ctx, filter, body)
+	_, err := er.mongo.Conn.UpdateOne(ctx, filter, body)
 	if err != nil {
-		er.logger.Warnf("[RemoveInvite] UpdateOne: %s", err.Error())
-		return errors.InternalError
+		er.logger.WithContext(ctx).Warnf("[RemoveInvite] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
 	}
 	return nil
 }
 
-func (er *EventsRepository) GetInviteByLogin(login string) ([]string, error) {
+func (er *EventsRepository) GetInviteByLogin(ctx context.Context, login string) ([]string, error) {
+	ctx, end := er.mongo.Call(ctx, "events", "GetInviteByLogin")
+	defer end()
+
 	doc := &model.InviteBson{}
 	doc.Invites = make(map[string][]string, 0)
 	body := bson.M{
-		"_id": "json/invites",
+		"_id": er.mongo.Doc("json/invites"),
 	}
 
 	opts := options.FindOne()
 	opts.SetProjection(bson.M{fmt.Sprintf("invites.%s", login): 1})
 
-	err := er.mongo.Conn.FindOne(er.mongo.Ctx, body).Decode(doc)
+	err := er.mongo.Conn.FindOne(ctx, body).Decode(doc)
 	switch err {
 	case nil:
 		if len(doc.Invites) == 0 {
@@ -372,6 +409,6 @@ func (er *EventsRepository) GetInviteByLogin(login string) ([]string, error) {
 	case mongo.ErrNoDocuments:
 		return nil, errors.InviteNotFound
 	default:
-		return nil, errors.InternalError
+		return nil, db.StorageError(ctx, err)
 	}
 }
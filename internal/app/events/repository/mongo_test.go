@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/db/dbtest"
+	"nocalendar/internal/model"
+	"testing"
+)
+
+func TestEventsAreIsolatedByOrg(t *testing.T) {
+	mongo := dbtest.NewDatabase(t)
+	logger := dbtest.Logger()
+	ctx := context.Background()
+	acme := NewEventsRepository(dbtest.NewOrgDatabase(t, mongo, "acme"), logger)
+	globex := NewEventsRepository(dbtest.NewOrgDatabase(t, mongo, "globex"), logger)
+
+	event := &model.Event{
+		Id:            "acmeevent",
+		Title:         "planning",
+		Timestamp:     1700000000,
+		Members:       []string{"alice", "bob"},
+		ActiveMembers: []string{"alice"},
+		Author:        "alice",
+		Visibility:    model.VISIBILITY_BUSY,
+	}
+	if err := acme.InsertSingleEvent(ctx, event.ToSingle(""), model.SINGLE_EVENT); err != nil {
+		t.Fatalf("InsertSingleEvent: %s", err.Error())
+	}
+	if err := acme.InsertInvite(ctx, "bob", event.Id); err != nil {
+		t.Fatalf("InsertInvite: %s", err.Error())
+	}
+
+	if _, _, err := globex.GetEvent(ctx, event.Id); err != errors.EventNotFound {
+		t.Errorf("GetEvent in other org = %v, want %v", err, errors.EventNotFound)
+	}
+	if ids, err := globex.GetEventsIdsByLogin(ctx, "alice"); len(ids) != 0 {
+		t.Errorf("GetEventsIdsByLogin in other org = %v, %v, want no events", ids, err)
+	}
+	ids, err := globex.GetAllEventIds(ctx)
+	if err != nil {
+		t.Fatalf("GetAllEventIds: %s", err.Error())
+	}
+	for _, id := range ids {
+		if id == event.Id {
+			t.Errorf("GetAllEventIds in other org returned event of acme")
+		}
+	}
+	if err := globex.CheckInvite(ctx, "bob", event.Id); err == nil {
+		t.Errorf("CheckInvite in other org found invite of acme")
+	}
+
+	// writes in other organization do not reach documents of acme
+	if err := globex.RemoveInvite(ctx, "bob", event.Id); err != nil {
+		t.Fatalf("RemoveInvite in other org: %s", err.Error())
+	}
+	if err := globex.RemoveEvent(ctx, event.Id, model.SINGLE_EVENT); err != nil {
+		t.Fatalf("RemoveEvent in other org: %s", err.Error())
+	}
+	if _, _, err := acme.GetEvent(ctx, event.Id); err != nil {
+		t.Errorf("GetEvent after removal in other org: %v", err)
+	}
+	if err := acme.CheckInvite(ctx, "bob", event.Id); err != nil {
+		t.Errorf("CheckInvite after removal in other org: %v", err)
+	}
+}
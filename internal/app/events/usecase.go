@@ -1,15 +1,22 @@
 package events
 
-import "nocalendar/internal/model"
+import (
+	"context"
+	"nocalendar/internal/model"
+)
 
 type EventsUsecase interface {
-	CreateEvent(event *model.Event, author string) (string, error)
-	EditEvent(event *model.Event, login string) (*model.Event, error)
-	GetEvent(eventId string, login string) (*model.Event, error)
-	GetAllEvents(login string, from, to int64) (*model.JsonEvents, error)
-	RemoveEvent(eventId, login string) error
+	CreateEvent(ctx context.Context, event *model.Event, author string) (string, error)
+	EditEvent(ctx context.Context, event *model.Event, login string) (*model.Event, error)
+	GetEvent(ctx context.Context, eventId string, login string) (*model.Event, error)
+	GetAnyEvent(ctx context.Context, eventId string) (*model.Event, error)
+	GetAllEvents(ctx context.Context, login, viewer string, from, to int64, calendar string) (*model.JsonEvents, error)
+	RemoveEvent(ctx context.Context, eventId, login string) error
+	GetMemberEvents(ctx context.Context, login string) (*model.JsonEvents, error)
+	RemoveMember(ctx context.Context, login, transferTo string) error
+	SyncGroupMembers(ctx context.Context, groupId string, joined, left []string) error
 
-	AcceptInvite(event_id, login string) error
-	GetInvites(cgi string, cgi_type string, login string) (*model.InviteJson, error)
-	RejectInvite(event_id, login string) error
+	AcceptInvite(ctx context.Context, event_id, login string) error
+	GetInvites(ctx context.Context, cgi string, cgi_type string, login string) (*model.InviteJson, error)
+	RejectInvite(ctx context.Context, event_id, login string) error
 }
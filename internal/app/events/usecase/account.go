@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+)
+
+func (eu *EventsUsecase) storeEvent(ctx context.Context, event *model.Event, mode, supEventId string) error {
+	if mode == model.REGULAR_EVENT {
+		return eu.repo.InsertRegularEvent(ctx, event.ToRegular(supEventId), mode)
+	}
+	return eu.repo.InsertSingleEvent(ctx, event.ToSingle(supEventId), mode)
+}
+
+// GetMemberEvents returns full versions of all events where login is a member
+func (eu *EventsUsecase) GetMemberEvents(ctx context.Context, login string) (*model.JsonEvents, error) {
+	ctx, span := tracing.Start(ctx, "events.GetMemberEvents")
+	defer span.End()
+
+	eventIds, err := eu.repo.GetEventsIdsByLogin(ctx, login)
+	switch err {
+	case nil, errors.MemberNotFound:
+		break
+	default:
+		return nil, err
+	}
+
+	events := &model.JsonEvents{Events: make([]*model.Event, 0, len(eventIds))}
+	for _, eventId := range eventIds {
+		ievent, mode, err := eu.repo.GetEvent(ctx, eventId)
+		if err != nil {
+			continue
+		}
+		events.Events = append(events.Events, model.ConvertInterfaceToEvent(ievent, mode))
+	}
+	return events, nil
+}
+
+// RemoveMember removes login from all events before deletion of account. Events authored
+// by login are given to transferTo or cancelled if transferTo is empty
+func (eu *EventsUsecase) RemoveMember(ctx context.Context, login, transferTo string) error {
+	ctx, span := tracing.Start(ctx, "events.RemoveMember")
+	defer span.End()
+
+	eventIds, err := eu.repo.GetEventsIdsByLogin(ctx, login)
+	switch err {
+	case nil, errors.MemberNotFound:
+		break
+	default:
+		return err
+	}
+
+	for _, eventId := range eventIds {
+		ievent, mode, err := eu.repo.GetEvent(ctx, eventId)
+		if err == errors.EventNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		event := model.ConvertInterfaceToEvent(ievent, mode)
+		if event.Author == login && transferTo == "" {
+			err = eu.cancelEvent(ctx, event, mode)
+		} else {
+			err = eu.leaveEvent(ctx, event, mode, model.SupportEventId(ievent, mode), login, transferTo)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = eu.repo.RemoveEventIdFromMember(ctx, login, eventId)
+		if err != nil {
+			return err
+		}
+	}
+
+	invites, err := eu.repo.GetInviteByLogin(ctx, login)
+	switch err {
+	case nil:
+		break
+	case errors.InviteNotFound:
+		return nil
+	default:
+		return err
+	}
+
+	for _, eventId := range invites {
+		err = eu.repo.RemoveInvite(ctx, login, eventId)
+		if err != nil && err != errors.InviteNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (eu *EventsUsecase) cancelEvent(ctx context.Context, event *model.Event, mode string) error {
+	err := eu.repo.RemoveEvent(ctx, event.Id, mode)
+	if err != nil {
+		return err
+	}
+
+	err = eu.moveEventToCalendar(ctx, event.Id, event.Calendar, "")
+	if err != nil {
+		return err
+	}
+
+	err = eu.removeInvites(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	eu.recordChange(ctx, model.CHANGE_DELETED, event, nil)
+	eu.notify(model.NotificationEventRemoved, event.Id, event.Members)
+	return nil
+}
+
+func (eu *EventsUsecase) leaveEvent(ctx context.Context, event *model.Event, mode, supEventId, login, transferTo string) error {
+	event.Members = removeLoginFromMembers(event.Members, login)
+	event.ActiveMembers = removeLoginFromMembers(event.ActiveMembers, login)
+	if event.Author == login {
+		event.Author = transferTo
+		event.Members = addAuthorToMembers(event.Members, transferTo)
+		event.ActiveMembers = addAuthorToMembers(event.ActiveMembers, transferTo)
+
+		// new author has not to accept own event
+		err := eu.repo.RemoveInvite(ctx, transferTo, event.Id)
+		if err != nil && err != errors.InviteNotFound {
+			return err
+		}
+	}
+
+	err := eu.storeEvent(ctx, event, mode, supEventId)
+	if err != nil {
+		return err
+	}
+
+	eu.recordChange(ctx, model.CHANGE_UPDATED, event, []string{login})
+	eu.notify(model.NotificationEventChanged, event.Id, event.Members)
+	return nil
+}
@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/validation"
+)
+
+// expandGroups replaces references to groups in members with current members of groups
+// and remembers referenced groups in event
+func (eu *EventsUsecase) expandGroups(ctx context.Context, event *model.Event) error {
+	v := validation.NewValidator()
+	members := make([]string, 0, len(event.Members))
+	groupIds := make([]string, 0)
+	for _, member := range event.Members {
+		groupId, ok := model.GroupIdOf(member)
+		if !ok {
+			members = append(members, member)
+			continue
+		}
+
+		group, err := eu.groupsRepo.GetGroup(ctx, groupId)
+		switch err {
+		case nil:
+		case errors.GroupNotFound:
+			v.Check(false, "members", fmt.Sprintf("unknown group %s", groupId))
+			continue
+		default:
+			return err
+		}
+		groupIds = append(groupIds, groupId)
+		members = append(members, group.Members...)
+	}
+
+	event.Members = members
+	event.Groups = validation.Unique(groupIds)
+	return v.Err()
+}
+
+// indexGroups makes event follow its groups if it is synced with them and stops following
+// groups of previous version of event
+func (eu *EventsUsecase) indexGroups(ctx context.Context, event *model.Event, oldGroups []string) error {
+	following := make([]string, 0)
+	if event.SyncGroups {
+		following = event.Groups
+	}
+
+	for _, groupId := range following {
+		err := eu.groupsRepo.AddGroupEvent(ctx, groupId, event.Id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, groupId := range subtractMembers(oldGroups, following) {
+		err := eu.groupsRepo.RemoveGroupEvent(ctx, groupId, event.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncGroupMembers invites users who joined group to events synced with it and removes
+// users who left it. Author of event and members of other groups of event stay
+func (eu *EventsUsecase) SyncGroupMembers(ctx context.Context, groupId string, joined, left []string) error {
+	ctx, span := tracing.Start(ctx, "events.SyncGroupMembers")
+	defer span.End()
+
+	eventIds, err := eu.groupsRepo.GetGroupEvents(ctx, groupId)
+	if err != nil {
+		return err
+	}
+
+	for _, eventId := range eventIds {
+		ievent, mode, err := eu.repo.GetEvent(ctx, eventId)
+		if err != nil && err != errors.EventNotFound {
+			return err
+		}
+
+		// removed events and events which stopped following group are dropped lazily
+		if err == errors.EventNotFound || !model.ConvertInterfaceToEvent(ievent, mode).SyncGroups {
+			err = eu.groupsRepo.RemoveGroupEvent(ctx, groupId, eventId)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		event := model.ConvertInterfaceToEvent(ievent, mode)
+		err = eu.syncEvent(ctx, event, mode, model.SupportEventId(ievent, mode), groupId, joined, left)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (eu *EventsUsecase) syncEvent(ctx context.Context, event *model.Event, mode, supEventId, groupId string, joined, left []string) error {
+	staying, err := eu.otherGroupsMembers(ctx, event, groupId)
+	if err != nil {
+		return err
+	}
+
+	oldMembers := event.Members
+	for _, login := range left {
+		if login == event.Author || staying[login] {
+			continue
+		}
+		event.Members = removeLoginFromMembers(event.Members, login)
+		event.ActiveMembers = removeLoginFromMembers(event.ActiveMembers, login)
+	}
+	for _, login := range joined {
+		if !isParticipant(event.Members, login) && len(event.Members) < model.MAX_MEMBERS {
+			event.Members = append(event.Members, login)
+		}
+	}
+
+	invited := subtractMembers(event.Members, oldMembers)
+	removed := subtractMembers(oldMembers, event.Members)
+	if len(invited) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	err = eu.storeEvent(ctx, event, mode, supEventId)
+	if err != nil {
+		return err
+	}
+
+	for _, login := range removed {
+		err = eu.repo.RemoveInvite(ctx, login, event.Id)
+		if err != nil && err != errors.InviteNotFound {
+			return err
+		}
+		err = eu.repo.RemoveEventIdFromMember(ctx, login, event.Id)
+		if err != nil {
+			return err
+		}
+	}
+	err = eu.inviteMembers(ctx, event.Id, invited)
+	if err != nil {
+		return err
+	}
+
+	eu.recordChange(ctx, model.CHANGE_UPDATED, event, removed)
+	eu.notify(model.NotificationEventChanged, event.Id, mergeUnique(oldMembers, event.Members))
+	return nil
+}
+
+// otherGroupsMembers returns members of groups of event except groupId
+func (eu *EventsUsecase) otherGroupsMembers(ctx context.Context, event *model.Event, groupId string) (map[string]bool, error) {
+	members := make(map[string]bool)
+	for _, otherId := range event.Groups {
+		if otherId == groupId {
+			continue
+		}
+
+		group, err := eu.groupsRepo.GetGroup(ctx, otherId)
+		switch err {
+		case nil:
+		case errors.GroupNotFound:
+			continue
+		default:
+			return nil, err
+		}
+		for _, member := range group.Members {
+			members[member] = true
+		}
+	}
+	return members, nil
+}
@@ -1,26 +1,277 @@
 package usecase
 
 import (
+	"context"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/changes"
 	"nocalendar/internal/app/errors"
 	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/stream"
+	"nocalendar/internal/metrics"
 	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
 	"nocalendar/internal/util"
+	"nocalendar/internal/validation"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type EventsUsecase struct {
-	repo   events.EventsRepository
-	logger *logrus.Logger
+	repo          events.EventsRepository
+	authRepo      auth.AuthRepository
+	calendarsRepo calendars.CalendarsRepository
+	changesRepo   changes.ChangesRepository
+	groupsRepo    groups.GroupsRepository
+	broker        stream.Broker
+	logger        *logrus.Logger
 }
 
-func NewEventsUsecase(repo events.EventsRepository, logger *logrus.Logger) events.EventsUsecase {
+func NewEventsUsecase(repo events.EventsRepository, authRepo auth.AuthRepository, calendarsRepo calendars.CalendarsRepository,
+	changesRepo changes.ChangesRepository, groupsRepo groups.GroupsRepository, broker stream.Broker, logger *logrus.Logger) events.EventsUsecase {
 	return &EventsUsecase{
-		repo:   repo,
-		logger: logger,
+		repo:          repo,
+		authRepo:      authRepo,
+		calendarsRepo: calendarsRepo,
+		changesRepo:   changesRepo,
+		groupsRepo:    groupsRepo,
+		broker:        broker,
+		logger:        logger,
 	}
 }
 
+// checkCalendar verifies that login may put events to the calendar. Empty id is a default calendar
+func (eu *EventsUsecase) checkCalendar(ctx context.Context, calendarId, login string) error {
+	if calendarId == "" {
+		return nil
+	}
+
+	calendar, err := eu.calendarsRepo.GetCalendar(ctx, calendarId)
+	if err != nil {
+		return err
+	}
+
+	groupIds, err := eu.groupsOf(ctx, login)
+	if err != nil {
+		return err
+	}
+	if !model.HasRole(calendar.RoleOf(login, groupIds), model.ROLE_WRITE) {
+		return errors.HasNoRights
+	}
+	return nil
+}
+
+// groupsOf returns ids of groups of login, roles granted on calendars to groups belong to their members
+func (eu *EventsUsecase) groupsOf(ctx context.Context, login string) ([]string, error) {
+	groups, err := eu.groupsRepo.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return model.GroupIdsOf(groups, login), nil
+}
+
+// roleResolver computes rights of login on events and caches calendars and groups of login between events
+type roleResolver struct {
+	eu        *EventsUsecase
+	login     string
+	calendars map[string]*model.Calendar
+	groupIds  []string // nil until the first event from calendar
+}
+
+func (eu *EventsUsecase) newRoleResolver(login string) *roleResolver {
+	return &roleResolver{
+		eu:        eu,
+		login:     login,
+		calendars: make(map[string]*model.Calendar),
+	}
+}
+
+// role returns rights of login on the event: author manages event, members may edit it,
+// other users get rights granted on calendar of the event
+func (rr *roleResolver) role(ctx context.Context, event *model.Event) (string, error) {
+	role := model.ROLE_NONE
+	if event.Author == rr.login {
+		return model.ROLE_MANAGE, nil
+	} else if isParticipant(event.Members, rr.login) {
+		role = model.ROLE_WRITE
+	}
+
+	if event.Calendar == "" {
+		return role, nil
+	}
+
+	calendar, ok := rr.calendars[event.Calendar]
+	if !ok {
+		var err error
+		calendar, err = rr.eu.calendarsRepo.GetCalendar(ctx, event.Calendar)
+		switch err {
+		case nil:
+		case errors.CalendarNotFound:
+			calendar = &model.Calendar{}
+		default:
+			return model.ROLE_NONE, err
+		}
+		rr.calendars[event.Calendar] = calendar
+	}
+	if rr.groupIds == nil {
+		groupIds, err := rr.eu.groupsOf(ctx, rr.login)
+		if err != nil {
+			return model.ROLE_NONE, err
+		}
+		rr.groupIds = groupIds
+	}
+	return model.MaxRole(role, calendar.RoleOf(rr.login, rr.groupIds)), nil
+}
+
+func (eu *EventsUsecase) eventRole(ctx context.Context, event *model.Event, login string) (string, error) {
+	return eu.newRoleResolver(login).role(ctx, event)
+}
+
+// calendarEvents returns ids of events of own and subscribed calendars
+func (eu *EventsUsecase) calendarEvents(ctx context.Context, login string) ([]string, error) {
+	owned, err := eu.calendarsRepo.GetCalendarsByOwner(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := eu.calendarsRepo.GetSubscriptions(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	cals := owned
+	for _, calendarId := range subscriptions {
+		calendar, err := eu.calendarsRepo.GetCalendar(ctx, calendarId)
+		switch err {
+		case nil:
+			cals = append(cals, calendar)
+		case errors.CalendarNotFound:
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	groupIds, err := eu.groupsOf(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	eventIds := make([]string, 0)
+	for _, calendar := range cals {
+		if !model.HasRole(calendar.RoleOf(login, groupIds), model.ROLE_FREEBUSY) {
+			continue
+		}
+
+		ids, err := eu.calendarsRepo.GetEventIdsByCalendar(ctx, calendar.Id)
+		if err != nil {
+			return nil, err
+		}
+		eventIds = append(eventIds, ids...)
+	}
+	return eventIds, nil
+}
+
+// moveEventToCalendar keeps index of events by calendar up to date
+func (eu *EventsUsecase) moveEventToCalendar(ctx context.Context, eventId, from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	if from != "" {
+		err := eu.calendarsRepo.RemoveEventFromCalendar(ctx, from, eventId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if to != "" {
+		return eu.calendarsRepo.AddEventToCalendar(ctx, to, eventId)
+	}
+	return nil
+}
+
+// recordChange puts mutation to change feed for audience of event. Removed are users who stop
+// seeing event, unless they still see it through calendar. Event is already stored at this moment,
+// so failure only forces clients to resync and is not returned to caller
+func (eu *EventsUsecase) recordChange(ctx context.Context, op string, event *model.Event, removed []string) {
+	members := eu.audience(ctx, event)
+	err := eu.changesRepo.InsertChange(ctx, &model.Change{
+		EventId:   event.Id,
+		Op:        op,
+		Members:   members,
+		Removed:   subtractMembers(removed, members),
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		eu.logger.WithContext(ctx).Warnf("[recordChange] change of event %s not recorded: %s", event.Id, err.Error())
+	}
+}
+
+// audience returns users who see event in their calendars: members of event and, if event
+// belongs to calendar, its owner and users who got role on calendar directly or by group.
+// Calendar which cannot be read leaves only members, so clients of others resync later
+func (eu *EventsUsecase) audience(ctx context.Context, event *model.Event) []string {
+	users := event.Members
+	if event.Calendar == "" {
+		return users
+	}
+
+	calendar, err := eu.calendarsRepo.GetCalendar(ctx, event.Calendar)
+	if err != nil {
+		if err != errors.CalendarNotFound {
+			eu.logger.WithContext(ctx).Warnf("[audience] calendar of event %s not found: %s", event.Id, err.Error())
+		}
+		return users
+	}
+
+	users = mergeUnique(users, []string{calendar.Owner})
+	for grantee := range calendar.Acl {
+		groupId, ok := model.GroupIdOf(grantee)
+		if !ok {
+			users = mergeUnique(users, []string{grantee})
+			continue
+		}
+
+		group, err := eu.groupsRepo.GetGroup(ctx, groupId)
+		switch err {
+		case nil:
+			users = mergeUnique(users, group.Members)
+		case errors.GroupNotFound:
+		default:
+			eu.logger.WithContext(ctx).Warnf("[audience] group %s of calendar %s not found: %s", groupId, calendar.Id, err.Error())
+		}
+	}
+	return users
+}
+
+func (eu *EventsUsecase) notify(notificationType, eventId string, logins []string) {
+	eu.broker.Publish(logins, &model.Notification{
+		Type:      notificationType,
+		EventId:   eventId,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// mergeUnique returns items of both lists without duplicates
+func mergeUnique(old_members, new_members []string) []string {
+	members := make([]string, 0, len(old_members)+len(new_members))
+	for _, member := range old_members {
+		if !isParticipant(members, member) {
+			members = append(members, member)
+		}
+	}
+	for _, member := range new_members {
+		if !isParticipant(members, member) {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
 func addAuthorToMembers(members []string, author string) []string {
 	for _, member := range members {
 		if member == author {
@@ -30,27 +281,60 @@ func addAuthorToMembers(members []string, author string) []string {
 	return append(members, author)
 }
 
-func (eu *EventsUsecase) CreateEvent(event *model.Event, author string) (string, error) {
+func (eu *EventsUsecase) CreateEvent(ctx context.Context, event *model.Event, author string) (string, error) {
+	ctx, span := tracing.Start(ctx, "events.CreateEvent")
+	defer span.End()
+
 	event.Author = author
-	event.Members = addAuthorToMembers(event.Members, author)
-	event.ActiveMembers = addAuthorToMembers(event.ActiveMembers, author)
+	err := eu.expandGroups(ctx, event)
+	if err != nil {
+		return "", err
+	}
+	event.Members = addAuthorToMembers(validation.Unique(event.Members), author)
+	event.ActiveMembers = addAuthorToMembers(validation.Unique(event.ActiveMembers), author)
 	event.Id = util.GenerateRandomString(model.LENGTH_OF_EVENT_ID)
+	if event.Visibility == "" {
+		event.Visibility = model.VISIBILITY_BUSY
+	}
+	if !model.IsValidVisibility(event.Visibility) {
+		return "", errors.BadVisibility
+	}
+
+	err = eu.validateEvent(ctx, event, event.Members)
+	if err != nil {
+		return "", err
+	}
+
+	err = eu.checkCalendar(ctx, event.Calendar, author)
+	if err != nil {
+		return "", err
+	}
 
-	var err error
 	if event.IsRegular {
-		err = eu.repo.InsertRegularEvent(event.ToRegular(""), model.REGULAR_EVENT)
+		err = eu.repo.InsertRegularEvent(ctx, event.ToRegular(""), model.REGULAR_EVENT)
 	} else {
-		err = eu.repo.InsertSingleEvent(event.ToSingle(""), model.SINGLE_EVENT)
+		err = eu.repo.InsertSingleEvent(ctx, event.ToSingle(""), model.SINGLE_EVENT)
 	}
 	if err != nil {
 		return "", err
 	}
 
-	err = eu.addInvites(event, false /* reinvite */)
+	err = eu.moveEventToCalendar(ctx, event.Id, "", event.Calendar)
 	if err != nil {
 		return "", err
 	}
 
+	err = eu.addInvites(ctx, event, false /* reinvite */)
+	if err != nil {
+		return "", err
+	}
+
+	err = eu.indexGroups(ctx, event, nil)
+	if err != nil {
+		return "", err
+	}
+
+	eu.recordChange(ctx, model.CHANGE_CREATED, event, nil)
 	return event.Id, nil
 }
 
@@ -67,14 +351,25 @@ func copyEvent(old_event, new_event *model.Event) {
 		new_event.Timestamp = old_event.Timestamp
 	}
 
+	// groups are replaced together with members
 	if len(new_event.Members) == 0 {
 		new_event.Members = old_event.Members
+		new_event.Groups = old_event.Groups
+		new_event.SyncGroups = old_event.SyncGroups
 	}
 
 	if len(new_event.ActiveMembers) == 0 {
 		new_event.ActiveMembers = old_event.ActiveMembers
 	}
 
+	if new_event.Calendar == "" {
+		new_event.Calendar = old_event.Calendar
+	}
+
+	if new_event.Visibility == "" {
+		new_event.Visibility = old_event.Visibility
+	}
+
 	new_event.Author = old_event.Author
 }
 
@@ -96,19 +391,30 @@ func isParticipant(members []string, login string) bool {
 	return false
 }
 
-func (eu *EventsUsecase) addInvites(event *model.Event, reinvite bool) error {
+// subtractMembers returns members of old list absent in new one
+func subtractMembers(old_members, new_members []string) []string {
+	members := make([]string, 0)
+	for _, member := range old_members {
+		if !isParticipant(new_members, member) {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+func (eu *EventsUsecase) addInvites(ctx context.Context, event *model.Event, reinvite bool) error {
 	for _, member := range event.Members {
 		if event.Author == member {
 			continue
 		}
 
 		if reinvite {
-			err := eu.repo.RemoveInvite(member, event.Id)
+			err := eu.repo.RemoveInvite(ctx, member, event.Id)
 			if err != nil {
 				return err
 			}
 		} else {
-			err := eu.repo.CheckInvite(member, event.Id)
+			err := eu.repo.CheckInvite(ctx, member, event.Id)
 			switch err {
 			case nil: // invite already accepted
 				continue
@@ -118,26 +424,44 @@ func (eu *EventsUsecase) addInvites(event *model.Event, reinvite bool) error {
 			}
 		}
 
-		err := eu.repo.InsertInvite(member, event.Id)
+		err := eu.repo.InsertInvite(ctx, member, event.Id)
+		if err != nil {
+			return err
+		}
+		metrics.Invites.WithLabelValues("sent").Inc()
+		eu.notify(model.NotificationInvite, event.Id, []string{member})
+	}
+	return nil
+}
+
+// inviteMembers invites logins which were added to existing event
+func (eu *EventsUsecase) inviteMembers(ctx context.Context, eventId string, logins []string) error {
+	for _, login := range logins {
+		err := eu.repo.InsertInvite(ctx, login, eventId)
 		if err != nil {
 			return err
 		}
+		metrics.Invites.WithLabelValues("sent").Inc()
+		eu.notify(model.NotificationInvite, eventId, []string{login})
 	}
 	return nil
 }
 
-func (eu *EventsUsecase) removeInvites(event *model.Event) error {
+func (eu *EventsUsecase) removeInvites(ctx context.Context, event *model.Event) error {
 	for _, member := range event.Members {
-		err := eu.repo.RemoveInvite(member, event.Id)
-		if err == errors.InternalError {
+		err := eu.repo.RemoveInvite(ctx, member, event.Id)
+		if err == errors.InternalError || errors.IsStorageError(err) {
 			return err
 		}
 	}
 	return nil
 }
 
-func (eu *EventsUsecase) EditEvent(event *model.Event, login string) (*model.Event, error) {
-	old_event_version, mode, err := eu.repo.GetEvent(event.Id)
+func (eu *EventsUsecase) EditEvent(ctx context.Context, event *model.Event, login string) (*model.Event, error) {
+	ctx, span := tracing.Start(ctx, "events.EditEvent")
+	defer span.End()
+
+	old_event_version, mode, err := eu.repo.GetEvent(ctx, event.Id)
 	if err != nil {
 		return nil, err
 	}
@@ -152,75 +476,186 @@ func (eu *EventsUsecase) EditEvent(event *model.Event, login string) (*model.Eve
 
 	oev := model.ConvertInterfaceToEvent(old_event_version, mode)
 
-	if !isParticipant(oev.Members, login) {
+	role, err := eu.eventRole(ctx, oev, login)
+	if err != nil {
+		return nil, err
+	}
+	if !model.HasRole(role, model.ROLE_WRITE) {
 		return nil, errors.HasNoRights
 	}
 
+	if len(event.Members) > 0 {
+		err = eu.expandGroups(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	old_ts := oev.Timestamp
 	mergeEvents(oev, event, mode)
+	if !model.IsValidVisibility(event.Visibility) {
+		return nil, errors.BadVisibility
+	}
+
+	event.Members = validation.Unique(event.Members)
+	event.ActiveMembers = validation.Unique(event.ActiveMembers)
+	err = eu.validateEvent(ctx, event, subtractMembers(event.Members, oev.Members))
+	if err != nil {
+		return nil, err
+	}
+
+	if event.Calendar != oev.Calendar {
+		err = eu.checkCalendar(ctx, event.Calendar, login)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if event.IsRegular {
-		err = eu.repo.InsertRegularEvent(event.ToRegular(sup_ev_id), model.REGULAR_EVENT)
+		err = eu.repo.InsertRegularEvent(ctx, event.ToRegular(sup_ev_id), model.REGULAR_EVENT)
 	} else {
 		if mode == model.REGULAR_EVENT {
 			event.Id = util.GenerateRandomString(model.LENGTH_OF_EVENT_ID)
-			err = eu.repo.InsertSingleEvent(event.ToSingle(model.ConvertInterfaceToEvent(old_event_version, mode).Id), model.SINGLE_EVENT)
+			err = eu.repo.InsertSingleEvent(ctx, event.ToSingle(model.ConvertInterfaceToEvent(old_event_version, mode).Id), model.SINGLE_EVENT)
 			if err != nil {
 				return nil, err
 			}
-			err = eu.repo.InsertRegularEvent(model.ConvertInterfaceToEvent(old_event_version, mode).ToRegular(event.Id), model.REGULAR_EVENT)
+			err = eu.repo.InsertRegularEvent(ctx, model.ConvertInterfaceToEvent(old_event_version, mode).ToRegular(event.Id), model.REGULAR_EVENT)
 		} else {
-			err = eu.repo.InsertSingleEvent(event.ToSingle(sup_ev_id), model.SINGLE_EVENT)
+			err = eu.repo.InsertSingleEvent(ctx, event.ToSingle(sup_ev_id), model.SINGLE_EVENT)
 		}
 	}
 	if err != nil {
 		return nil, err
 	}
 
+	if event.Id != oev.Id {
+		err = eu.moveEventToCalendar(ctx, event.Id, "", event.Calendar)
+	} else {
+		err = eu.moveEventToCalendar(ctx, event.Id, oev.Calendar, event.Calendar)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	if old_ts != event.Timestamp {
 		if mode == model.REGULAR_EVENT {
-			err = eu.removeInvites(event)
+			err = eu.removeInvites(ctx, event)
 			if err != nil {
 				return nil, err
 			}
 		}
-		err = eu.addInvites(event, true /* reinvite */)
+		err = eu.addInvites(ctx, event, true /* reinvite */)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = eu.inviteMembers(ctx, event.Id, subtractMembers(event.Members, oev.Members))
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return eu.GetEvent(event.Id, login)
+	oldGroups := oev.Groups
+	if event.Id != oev.Id {
+		// regular event keeps following its groups, its single copy follows them too
+		oldGroups = nil
+	}
+	err = eu.indexGroups(ctx, event, oldGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.Id != oev.Id {
+		// single copy of regular event was created
+		eu.recordChange(ctx, model.CHANGE_CREATED, event, nil)
+		eu.recordChange(ctx, model.CHANGE_UPDATED, oev, nil)
+	} else {
+		eu.recordChange(ctx, model.CHANGE_UPDATED, event, eu.audience(ctx, oev))
+	}
+	eu.notify(model.NotificationEventChanged, event.Id, mergeUnique(oev.Members, event.Members))
+	return eu.GetEvent(ctx, event.Id, login)
 }
 
-func (eu *EventsUsecase) GetEvent(eventId string, login string) (*model.Event, error) {
-	event, mode, err := eu.repo.GetEvent(eventId)
+func (eu *EventsUsecase) GetEvent(ctx context.Context, eventId string, login string) (*model.Event, error) {
+	ctx, span := tracing.Start(ctx, "events.GetEvent")
+	defer span.End()
+
+	ievent, mode, err := eu.repo.GetEvent(ctx, eventId)
+	if err != nil {
+		return nil, err
+	}
+
+	event := model.ConvertInterfaceToEvent(ievent, mode)
+	role, err := eu.eventRole(ctx, event, login)
+	if err != nil {
+		return nil, err
+	}
+
+	view := event.ViewFor(role)
+	if view == nil {
+		return nil, errors.HasNoRights
+	}
+	return view, nil
+}
+
+// GetAnyEvent returns full event without checking rights of viewer, it is for administrators only
+func (eu *EventsUsecase) GetAnyEvent(ctx context.Context, eventId string) (*model.Event, error) {
+	ctx, span := tracing.Start(ctx, "events.GetAnyEvent")
+	defer span.End()
+
+	ievent, mode, err := eu.repo.GetEvent(ctx, eventId)
 	if err != nil {
 		return nil, err
 	}
-	return model.ConvertInterfaceToEvent(event, mode), err
+	return model.ConvertInterfaceToEvent(ievent, mode), nil
 }
 
-func (eu *EventsUsecase) GetAllEvents(login string, from, to int64) (*model.JsonEvents, error) {
-	eventIds, err := eu.repo.GetEventsIdsByLogin(login)
+// GetAllEvents returns calendar of login as viewer sees it
+func (eu *EventsUsecase) GetAllEvents(ctx context.Context, login, viewer string, from, to int64, calendar string) (*model.JsonEvents, error) {
+	ctx, span := tracing.Start(ctx, "events.GetAllEvents")
+	defer span.End()
+
+	eventIds, err := eu.repo.GetEventsIdsByLogin(ctx, login)
 	switch err {
-	case nil:
+	case nil, errors.MemberNotFound:
 		break
-	case errors.MemberNotFound:
-		return &model.JsonEvents{}, nil
 	default:
 		return nil, err
 	}
 
+	// merge events of own and subscribed calendars
+	calendarEventIds, err := eu.calendarEvents(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	eventIds = mergeUnique(eventIds, calendarEventIds)
+	// every event is read by own call of repository
+	span.SetAttributes(attribute.Int("events.read", len(eventIds)))
+
+	resolver := eu.newRoleResolver(viewer)
 	events := &model.JsonEvents{}
 	events.Events = make([]*model.Event, 0)
 	for _, eventId := range eventIds {
-		ev, mode, err := eu.repo.GetEvent(eventId)
+		ev, mode, err := eu.repo.GetEvent(ctx, eventId)
 		if err != nil {
 			continue
 		}
 
 		event := model.ConvertInterfaceToEvent(ev, mode)
+		if calendar != "" && event.Calendar != calendar {
+			continue
+		}
+
+		role, err := resolver.role(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		event = event.ViewFor(role)
+		if event == nil {
+			continue
+		}
+
 		if mode == model.REGULAR_EVENT {
 			if ev.(map[string]interface{})["single_event_id"].(string) == "" {
 				if from < event.Timestamp || event.Timestamp < to {
@@ -254,27 +689,52 @@ func (eu *EventsUsecase) GetAllEvents(login string, from, to int64) (*model.Json
 	return events, nil
 }
 
-func (eu *EventsUsecase) RemoveEvent(eventId, login string) error {
-	event, mode, err := eu.repo.GetEvent(eventId)
+func (eu *EventsUsecase) RemoveEvent(ctx context.Context, eventId, login string) error {
+	ctx, span := tracing.Start(ctx, "events.RemoveEvent")
+	defer span.End()
+
+	event, mode, err := eu.repo.GetEvent(ctx, eventId)
 	if err != nil {
 		return err
 	}
 
-	if event.(map[string]interface{})["author"].(string) != login {
+	role, err := eu.eventRole(ctx, model.ConvertInterfaceToEvent(event, mode), login)
+	if err != nil {
+		return err
+	}
+	if !model.HasRole(role, model.ROLE_MANAGE) {
 		return errors.HasNoRights
 	}
 
-	return eu.repo.RemoveEvent(eventId, mode)
+	err = eu.repo.RemoveEvent(ctx, eventId, mode)
+	if err != nil {
+		return err
+	}
+
+	removed := model.ConvertInterfaceToEvent(event, mode)
+	err = eu.moveEventToCalendar(ctx, eventId, removed.Calendar, "")
+	if err != nil {
+		return err
+	}
+
+	members := removed.Members
+	eu.recordChange(ctx, model.CHANGE_DELETED, removed, nil)
+	eu.notify(model.NotificationEventRemoved, eventId, members)
+	return nil
 }
 
-func (eu *EventsUsecase) AcceptInvite(event_id, login string) error {
-	err := eu.repo.RemoveInvite(login, event_id)
+func (eu *EventsUsecase) AcceptInvite(ctx context.Context, event_id, login string) error {
+	ctx, span := tracing.Start(ctx, "events.AcceptInvite")
+	defer span.End()
+
+	err := eu.repo.RemoveInvite(ctx, login, event_id)
 	if err != nil {
 		return err
 	}
+	metrics.Invites.WithLabelValues("accepted").Inc()
 
-	// err = eu.repo.InsertInvite(inv)
-	ievent, mode, err := eu.repo.GetEvent(event_id)
+	// err = eu.repo.InsertInvite(ctx, inv)
+	ievent, mode, err := eu.repo.GetEvent(ctx, event_id)
 	if err != nil {
 		return err
 	}
@@ -296,17 +756,26 @@ func (eu *EventsUsecase) AcceptInvite(event_id, login string) error {
 
 	switch mode {
 	case model.REGULAR_EVENT:
-		err = eu.repo.InsertRegularEvent(event.ToRegular(sup_ev_id), mode)
+		err = eu.repo.InsertRegularEvent(ctx, event.ToRegular(sup_ev_id), mode)
 	case model.SINGLE_EVENT:
-		err = eu.repo.InsertSingleEvent(event.ToSingle(sup_ev_id), mode)
+		err = eu.repo.InsertSingleEvent(ctx, event.ToSingle(sup_ev_id), mode)
 	default:
 		err = errors.InternalError
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	eu.recordChange(ctx, model.CHANGE_UPDATED, event, nil)
+	eu.notify(model.NotificationEventChanged, event_id, event.Members)
+	return nil
 }
 
-func (eu *EventsUsecase) GetInvites(cgi string, cgi_type string, login string) (*model.InviteJson, error) {
-	invites, err := eu.repo.GetInviteByLogin(login)
+func (eu *EventsUsecase) GetInvites(ctx context.Context, cgi string, cgi_type string, login string) (*model.InviteJson, error) {
+	ctx, span := tracing.Start(ctx, "events.GetInvites")
+	defer span.End()
+
+	invites, err := eu.repo.GetInviteByLogin(ctx, login)
 	if err != nil {
 		return nil, err
 	}
@@ -340,16 +809,20 @@ func removeLoginFromMembers(members []string, login string) []string {
 	return newMembers
 }
 
-func (eu *EventsUsecase) RejectInvite(event_id, login string) error {
-	if err := eu.repo.RemoveInvite(login, event_id); err != nil {
+func (eu *EventsUsecase) RejectInvite(ctx context.Context, event_id, login string) error {
+	ctx, span := tracing.Start(ctx, "events.RejectInvite")
+	defer span.End()
+
+	if err := eu.repo.RemoveInvite(ctx, login, event_id); err != nil {
 		return err
 	}
+	metrics.Invites.WithLabelValues("rejected").Inc()
 
-	if err := eu.repo.RemoveEventIdFromMember(login, event_id); err != nil {
+	if err := eu.repo.RemoveEventIdFromMember(ctx, login, event_id); err != nil {
 		return err
 	}
 
-	old_event_version, mode, err := eu.repo.GetEvent(event_id)
+	old_event_version, mode, err := eu.repo.GetEvent(ctx, event_id)
 	if err != nil {
 		return err
 	}
@@ -366,8 +839,15 @@ func (eu *EventsUsecase) RejectInvite(event_id, login string) error {
 	event.Members = removeLoginFromMembers(event.Members, login)
 	event.ActiveMembers = removeLoginFromMembers(event.ActiveMembers, login)
 	if mode == model.REGULAR_EVENT {
-		return eu.repo.InsertRegularEvent(event.ToRegular(sup_ev_id), mode)
+		err = eu.repo.InsertRegularEvent(ctx, event.ToRegular(sup_ev_id), mode)
 	} else {
-		return eu.repo.InsertSingleEvent(event.ToSingle(sup_ev_id), mode)
+		err = eu.repo.InsertSingleEvent(ctx, event.ToSingle(sup_ev_id), mode)
+	}
+	if err != nil {
+		return err
 	}
+
+	eu.recordChange(ctx, model.CHANGE_UPDATED, event, []string{login})
+	eu.notify(model.NotificationEventChanged, event_id, event.Members)
+	return nil
 }
@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"nocalendar/internal/validation"
+)
+
+// validateEvent checks fields of event and that all new members are registered users.
+// Members already stored in event are not looked up again
+func (eu *EventsUsecase) validateEvent(ctx context.Context, event *model.Event, newMembers []string) error {
+	v := validation.NewValidator()
+	v.Length("title", event.Title, 1, model.MAX_TITLE_LENGTH)
+	v.Length("description", event.Description, 0, model.MAX_DESCRIPTION_LENGTH)
+	v.Range("timestamp", event.Timestamp, model.MIN_TIMESTAMP, model.MAX_TIMESTAMP)
+	if event.IsRegular {
+		v.Range("delta", event.Delta, 1, model.MAX_DELTA_DAYS)
+	}
+
+	v.MaxItems("members", len(event.Members), model.MAX_MEMBERS)
+	if len(event.Members) > model.MAX_MEMBERS {
+		return v.Err()
+	}
+
+	for _, member := range newMembers {
+		_, err := eu.authRepo.GetUser(ctx, member)
+		switch err {
+		case nil:
+		case errors.UserNotFound:
+			v.UnknownLogin(member)
+		default:
+			return err
+		}
+	}
+	return v.Err()
+}
@@ -0,0 +1,177 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type GroupsDelivery struct {
+	logger *logrus.Logger
+}
+
+func NewGroupsDelivery(logger *logrus.Logger) *GroupsDelivery {
+	return &GroupsDelivery{
+		logger: logger,
+	}
+}
+
+func (gd *GroupsDelivery) groupsUsecase(r *http.Request) groups.GroupsUsecase {
+	return tenant.FromContext(r.Context()).Groups
+}
+
+func (gd *GroupsDelivery) Routing(r *mux.Router) {
+	gr := r.PathPrefix("/groups").Subrouter()
+	am := middleware.NewAuthMiddleware(gd.logger)
+	gr.Use(am.TokenChecking)
+
+	gr.Handle("", am.RequireScope(model.SCOPE_GROUPS_READ, gd.GetGroups)).Methods(http.MethodGet, http.MethodOptions)
+	gr.Handle("", am.RequireScope(model.SCOPE_GROUPS_WRITE, gd.CreateGroup)).Methods(http.MethodPost, http.MethodOptions)
+	gr.Handle("/{group_id:[\\w]+}", am.RequireScope(model.SCOPE_GROUPS_READ, gd.GetGroup)).Methods(http.MethodGet, http.MethodOptions)
+	gr.Handle("/{group_id:[\\w]+}", am.RequireScope(model.SCOPE_GROUPS_WRITE, gd.EditGroup)).Methods(http.MethodPatch, http.MethodOptions)
+	gr.Handle("/{group_id:[\\w]+}", am.RequireScope(model.SCOPE_GROUPS_WRITE, gd.RemoveGroup)).Methods(http.MethodDelete, http.MethodOptions)
+
+	gr.Handle("/{group_id:[\\w]+}/members", am.RequireScope(model.SCOPE_GROUPS_WRITE, gd.AddMembers)).Methods(http.MethodPost, http.MethodOptions)
+	gr.Handle("/{group_id:[\\w]+}/members/{login}", am.RequireScope(model.SCOPE_GROUPS_WRITE, gd.RemoveMember)).Methods(http.MethodDelete, http.MethodOptions)
+}
+
+func readJson(r *http.Request, value interface{}) error {
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, value)
+}
+
+func (gd *GroupsDelivery) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	group := &model.Group{}
+	err := readJson(r, group)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[CreateGroup] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadGroup)
+		return
+	}
+
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	groupId, err := gd.groupsUsecase(r).CreateGroup(r.Context(), group, usr.Login)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[CreateGroup] group not created: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "ok", "group_id": "%s"}`, groupId)))
+}
+
+func (gd *GroupsDelivery) EditGroup(w http.ResponseWriter, r *http.Request) {
+	group := &model.Group{}
+	err := readJson(r, group)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[EditGroup] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadGroup)
+		return
+	}
+	group.Id = mux.Vars(r)["group_id"]
+
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	group, err = gd.groupsUsecase(r).EditGroup(r.Context(), group, usr.Login)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[EditGroup] group not edited: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(group.ToAnswer()))
+}
+
+func (gd *GroupsDelivery) GetGroup(w http.ResponseWriter, r *http.Request) {
+	groupId := mux.Vars(r)["group_id"]
+
+	group, err := gd.groupsUsecase(r).GetGroup(r.Context(), groupId)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[GetGroup] group not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(group.ToAnswer()))
+}
+
+func (gd *GroupsDelivery) GetGroups(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	all, err := gd.groupsUsecase(r).GetGroups(r.Context(), usr.Login)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[GetGroups] groups not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(all.ToAnswer()))
+}
+
+func (gd *GroupsDelivery) RemoveGroup(w http.ResponseWriter, r *http.Request) {
+	groupId := mux.Vars(r)["group_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	err := gd.groupsUsecase(r).RemoveGroup(r.Context(), groupId, usr.Login)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[RemoveGroup] group not removed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (gd *GroupsDelivery) AddMembers(w http.ResponseWriter, r *http.Request) {
+	request := &model.GroupMembers{}
+	err := readJson(r, request)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[AddMembers] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadGroup)
+		return
+	}
+
+	groupId := mux.Vars(r)["group_id"]
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	group, err := gd.groupsUsecase(r).AddMembers(r.Context(), groupId, request.Members, usr.Login)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[AddMembers] members not added: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(group.ToAnswer()))
+}
+
+func (gd *GroupsDelivery) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	group, err := gd.groupsUsecase(r).RemoveMember(r.Context(), vars["group_id"], vars["login"], usr.Login)
+	if err != nil {
+		gd.logger.WithContext(r.Context()).Warnf("[RemoveMember] member not removed: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(group.ToAnswer()))
+}
@@ -0,0 +1,17 @@
+package groups
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type GroupsRepository interface {
+	InsertGroup(ctx context.Context, group *model.Group) error
+	GetGroup(ctx context.Context, groupId string) (*model.Group, error)
+	GetGroups(ctx context.Context) ([]*model.Group, error)
+	RemoveGroup(ctx context.Context, groupId string) error
+
+	AddGroupEvent(ctx context.Context, groupId, eventId string) error
+	RemoveGroupEvent(ctx context.Context, groupId, eventId string) error
+	GetGroupEvents(ctx context.Context, groupId string) ([]string, error)
+}
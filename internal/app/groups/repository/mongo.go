@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/db"
+	"nocalendar/internal/model"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GroupsRepository struct {
+	mongo  *db.Database
+	logger *logrus.Logger
+}
+
+func NewGroupsRepository(db *db.Database, logger *logrus.Logger) groups.GroupsRepository {
+	return &GroupsRepository{
+		mongo:  db,
+		logger: logger,
+	}
+}
+
+func (gr *GroupsRepository) InsertGroup(ctx context.Context, group *model.Group) error {
+	ctx, end := gr.mongo.Call(ctx, "groups", "InsertGroup")
+	defer end()
+
+	filter := bson.M{
+		"_id": gr.mongo.Doc("json/groups"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("groups.%s", group.Id): group,
+		},
+	}
+
+	_, err := gr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		gr.logger.WithContext(ctx).Warnf("[InsertGroup] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (gr *GroupsRepository) GetGroup(ctx context.Context, groupId string) (*model.Group, error) {
+	ctx, end := gr.mongo.Call(ctx, "groups", "GetGroup")
+	defer end()
+
+	doc := &model.BsonGroups{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("groups.%s", groupId): 1})
+	err := gr.mongo.Conn.FindOne(ctx, bson.M{"_id": gr.mongo.Doc("json/groups")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		group, ok := doc.Groups[groupId]
+		if !ok {
+			return nil, errors.GroupNotFound
+		}
+		return group, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.GroupNotFound
+	default:
+		gr.logger.WithContext(ctx).Warnf("[GetGroup] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (gr *GroupsRepository) GetGroups(ctx context.Context) ([]*model.Group, error) {
+	ctx, end := gr.mongo.Call(ctx, "groups", "GetGroups")
+	defer end()
+
+	doc := &model.BsonGroups{}
+	err := gr.mongo.Conn.FindOne(ctx, bson.M{"_id": gr.mongo.Doc("json/groups")}).Decode(doc)
+	switch err {
+	case nil, mongo.ErrNoDocuments:
+		break
+	default:
+		gr.logger.WithContext(ctx).Warnf("[GetGroups] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+
+	groups := make([]*model.Group, 0, len(doc.Groups))
+	for _, group := range doc.Groups {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func (gr *GroupsRepository) RemoveGroup(ctx context.Context, groupId string) error {
+	ctx, end := gr.mongo.Call(ctx, "groups", "RemoveGroup")
+	defer end()
+
+	_, err := gr.mongo.Conn.UpdateOne(ctx, bson.M{"_id": gr.mongo.Doc("json/groups")}, bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("groups.%s", groupId): "",
+		},
+	})
+	if err != nil {
+		gr.logger.WithContext(ctx).Warnf("[RemoveGroup] UpdateOne groups: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	_, err = gr.mongo.Conn.UpdateOne(ctx, bson.M{"_id": gr.mongo.Doc("json/group_events")}, bson.M{
+		"$unset": bson.M{
+			fmt.Sprintf("group_events.%s", groupId): "",
+		},
+	})
+	if err != nil {
+		gr.logger.WithContext(ctx).Warnf("[RemoveGroup] UpdateOne group_events: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (gr *GroupsRepository) AddGroupEvent(ctx context.Context, groupId, eventId string) error {
+	ctx, end := gr.mongo.Call(ctx, "groups", "AddGroupEvent")
+	defer end()
+
+	filter := bson.M{
+		"_id": gr.mongo.Doc("json/group_events"),
+	}
+
+	body := bson.M{
+		"$addToSet": bson.M{
+			fmt.Sprintf("group_events.%s", groupId): eventId,
+		},
+	}
+
+	_, err := gr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		gr.logger.WithContext(ctx).Warnf("[AddGroupEvent] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (gr *GroupsRepository) RemoveGroupEvent(ctx context.Context, groupId, eventId string) error {
+	ctx, end := gr.mongo.Call(ctx, "groups", "RemoveGroupEvent")
+	defer end()
+
+	filter := bson.M{
+		"_id": gr.mongo.Doc("json/group_events"),
+	}
+
+	body := bson.M{
+		"$pull": bson.M{
+			fmt.Sprintf("group_events.%s", groupId): eventId,
+		},
+	}
+
+	_, err := gr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		gr.logger.WithContext(ctx).Warnf("[RemoveGroupEvent] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (gr *GroupsRepository) GetGroupEvents(ctx context.Context, groupId string) ([]string, error) {
+	ctx, end := gr.mongo.Call(ctx, "groups", "GetGroupEvents")
+	defer end()
+
+	doc := &model.BsonGroupEvents{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("group_events.%s", groupId): 1})
+	err := gr.mongo.Conn.FindOne(ctx, bson.M{"_id": gr.mongo.Doc("json/group_events")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		return doc.Events[groupId], nil
+	case mongo.ErrNoDocuments:
+		return nil, nil
+	default:
+		gr.logger.WithContext(ctx).Warnf("[GetGroupEvents] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
@@ -0,0 +1,18 @@
+package groups
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type GroupsUsecase interface {
+	CreateGroup(ctx context.Context, group *model.Group, owner string) (string, error)
+	EditGroup(ctx context.Context, group *model.Group, login string) (*model.Group, error)
+	GetGroup(ctx context.Context, groupId string) (*model.Group, error)
+	GetGroups(ctx context.Context, login string) (*model.JsonGroups, error)
+	RemoveGroup(ctx context.Context, groupId, login string) error
+
+	AddMembers(ctx context.Context, groupId string, members []string, login string) (*model.Group, error)
+	RemoveMember(ctx context.Context, groupId, member, login string) (*model.Group, error)
+	RemoveUser(ctx context.Context, login, transferTo string) error
+}
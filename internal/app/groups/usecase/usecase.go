@@ -0,0 +1,268 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/util"
+	"nocalendar/internal/validation"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+type GroupsUsecase struct {
+	repo          groups.GroupsRepository
+	authRepo      auth.AuthRepository
+	eventsUsecase events.EventsUsecase
+	logger        *logrus.Logger
+}
+
+func NewGroupsUsecase(repo groups.GroupsRepository, authRepo auth.AuthRepository, eventsUsecase events.EventsUsecase,
+	logger *logrus.Logger) groups.GroupsUsecase {
+	return &GroupsUsecase{
+		repo:          repo,
+		authRepo:      authRepo,
+		eventsUsecase: eventsUsecase,
+		logger:        logger,
+	}
+}
+
+// checkGroup validates name of group and new members, members already in group are not looked up again
+func (gu *GroupsUsecase) checkGroup(ctx context.Context, group *model.Group, newMembers []string) error {
+	v := validation.NewValidator()
+	v.Length("name", group.Name, 1, model.MAX_TITLE_LENGTH)
+	v.MaxItems("members", len(group.Members), model.MAX_MEMBERS)
+	if len(group.Members) > model.MAX_MEMBERS {
+		return v.Err()
+	}
+
+	for _, member := range newMembers {
+		_, err := gu.authRepo.GetUser(ctx, member)
+		switch err {
+		case nil:
+		case errors.UserNotFound:
+			v.UnknownLogin(member)
+		default:
+			return err
+		}
+	}
+	return v.Err()
+}
+
+// getOwnGroup returns group if login owns it
+func (gu *GroupsUsecase) getOwnGroup(ctx context.Context, groupId, login string) (*model.Group, error) {
+	group, err := gu.repo.GetGroup(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	if group.Owner != login {
+		return nil, errors.HasNoRights
+	}
+	return group, nil
+}
+
+func (gu *GroupsUsecase) CreateGroup(ctx context.Context, group *model.Group, owner string) (string, error) {
+	ctx, span := tracing.Start(ctx, "groups.CreateGroup")
+	defer span.End()
+
+	group.Id = util.GenerateRandomString(model.LENGTH_OF_GROUP_ID)
+	group.Owner = owner
+	group.Members = validation.Unique(group.Members)
+
+	err := gu.checkGroup(ctx, group, group.Members)
+	if err != nil {
+		return "", err
+	}
+
+	err = gu.repo.InsertGroup(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	return group.Id, nil
+}
+
+// EditGroup renames group, members are changed through AddMembers and RemoveMember
+func (gu *GroupsUsecase) EditGroup(ctx context.Context, group *model.Group, login string) (*model.Group, error) {
+	ctx, span := tracing.Start(ctx, "groups.EditGroup")
+	defer span.End()
+
+	old, err := gu.getOwnGroup(ctx, group.Id, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if group.Name == "" {
+		group.Name = old.Name
+	}
+	group.Owner = old.Owner
+	group.Members = old.Members
+
+	err = gu.checkGroup(ctx, group, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gu.repo.InsertGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (gu *GroupsUsecase) GetGroup(ctx context.Context, groupId string) (*model.Group, error) {
+	ctx, span := tracing.Start(ctx, "groups.GetGroup")
+	defer span.End()
+
+	return gu.repo.GetGroup(ctx, groupId)
+}
+
+// GetGroups returns all groups of organization, groups of login go first
+func (gu *GroupsUsecase) GetGroups(ctx context.Context, login string) (*model.JsonGroups, error) {
+	ctx, span := tracing.Start(ctx, "groups.GetGroups")
+	defer span.End()
+
+	all, err := gu.repo.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	own := func(group *model.Group) bool {
+		return group.Owner == login || group.HasMember(login)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if own(all[i]) != own(all[j]) {
+			return own(all[i])
+		}
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Id < all[j].Id
+	})
+	return &model.JsonGroups{Groups: all}, nil
+}
+
+// RemoveGroup removes group, members invited from it stay in events
+func (gu *GroupsUsecase) RemoveGroup(ctx context.Context, groupId, login string) error {
+	ctx, span := tracing.Start(ctx, "groups.RemoveGroup")
+	defer span.End()
+
+	_, err := gu.getOwnGroup(ctx, groupId, login)
+	if err != nil {
+		return err
+	}
+	return gu.repo.RemoveGroup(ctx, groupId)
+}
+
+// AddMembers adds members to group and invites them to events synced with group
+func (gu *GroupsUsecase) AddMembers(ctx context.Context, groupId string, members []string, login string) (*model.Group, error) {
+	ctx, span := tracing.Start(ctx, "groups.AddMembers")
+	defer span.End()
+
+	group, err := gu.getOwnGroup(ctx, groupId, login)
+	if err != nil {
+		return nil, err
+	}
+
+	joined := make([]string, 0)
+	for _, member := range validation.Unique(members) {
+		if !group.HasMember(member) {
+			joined = append(joined, member)
+		}
+	}
+	group.Members = append(group.Members, joined...)
+
+	err = gu.checkGroup(ctx, group, joined)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gu.repo.InsertGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gu.eventsUsecase.SyncGroupMembers(ctx, group.Id, joined, nil)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// RemoveMember removes member from group and from events synced with group
+func (gu *GroupsUsecase) RemoveMember(ctx context.Context, groupId, member, login string) (*model.Group, error) {
+	ctx, span := tracing.Start(ctx, "groups.RemoveMember")
+	defer span.End()
+
+	group, err := gu.getOwnGroup(ctx, groupId, login)
+	if err != nil {
+		return nil, err
+	}
+	if !group.HasMember(member) {
+		return nil, errors.UserNotFound
+	}
+
+	err = gu.removeMember(ctx, group, member)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (gu *GroupsUsecase) removeMember(ctx context.Context, group *model.Group, member string) error {
+	members := make([]string, 0, len(group.Members))
+	for _, login := range group.Members {
+		if login != member {
+			members = append(members, login)
+		}
+	}
+	group.Members = members
+
+	err := gu.repo.InsertGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	return gu.eventsUsecase.SyncGroupMembers(ctx, group.Id, nil, []string{member})
+}
+
+// RemoveUser handles groups of deleted user: own groups are given to transferTo or removed
+// if it is empty, user leaves groups of others
+func (gu *GroupsUsecase) RemoveUser(ctx context.Context, login, transferTo string) error {
+	ctx, span := tracing.Start(ctx, "groups.RemoveUser")
+	defer span.End()
+
+	all, err := gu.repo.GetGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range all {
+		if group.Owner == login {
+			if transferTo == "" {
+				err = gu.repo.RemoveGroup(ctx, group.Id)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			group.Owner = transferTo
+			err = gu.repo.InsertGroup(ctx, group)
+			if err != nil {
+				return err
+			}
+		}
+
+		if group.HasMember(login) {
+			err = gu.removeMember(ctx, group, login)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
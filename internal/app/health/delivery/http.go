@@ -0,0 +1,57 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/health"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const READY_CHECK_TIMEOUT = 2 * time.Second
+
+// HealthDelivery answers probes of orchestrator. Probes do not belong to any organization
+// and are not limited, so they are routed outside of /api
+type HealthDelivery struct {
+	storage health.Checker
+	logger  *logrus.Logger
+}
+
+func NewHealthDelivery(storage health.Checker, logger *logrus.Logger) *HealthDelivery {
+	return &HealthDelivery{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+func (hd *HealthDelivery) Routing(r *mux.Router) {
+	r.HandleFunc("/healthz", hd.Liveness).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", hd.Readiness).Methods(http.MethodGet)
+}
+
+// Liveness only shows that process serves requests
+func (hd *HealthDelivery) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+// Readiness checks that storage is reachable
+func (hd *HealthDelivery) Readiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), READY_CHECK_TIMEOUT)
+	defer cancel()
+
+	err := hd.storage.Ping(ctx)
+	if err != nil {
+		hd.logger.WithContext(r.Context()).Warnf("[Readiness] storage is unavailable: %s", err.Error())
+		errors.Write(w, r, errors.StorageUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
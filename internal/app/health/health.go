@@ -0,0 +1,8 @@
+package health
+
+import "context"
+
+// Checker is a dependency which service cannot serve requests without
+type Checker interface {
+	Ping(ctx context.Context) error
+}
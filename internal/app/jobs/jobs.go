@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/metrics"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Runner runs maintenance jobs over events of one organization. Jobs are run by
+// cmd/regular on schedule and by administrators on demand
+type Runner struct {
+	eventsRepo events.EventsRepository
+	logger     *logrus.Logger
+}
+
+func NewRunner(eventsRepo events.EventsRepository, logger *logrus.Logger) *Runner {
+	return &Runner{
+		eventsRepo: eventsRepo,
+		logger:     logger,
+	}
+}
+
+func (jr *Runner) Run(ctx context.Context, job string) (*model.JobResult, error) {
+	switch job {
+	case model.JOB_CLEAN_REMOVED_EVENTS:
+		return jr.CleanRemovedEvents(ctx)
+	case model.JOB_UPDATE_TIMESTAMP:
+		return jr.UpdateTimestamps(ctx, time.Now().Unix())
+	default:
+		return nil, errors.JobNotFound
+	}
+}
+
+// CleanRemovedEvents drops ids of removed events from lists of members
+func (jr *Runner) CleanRemovedEvents(ctx context.Context) (*model.JobResult, error) {
+	ctx, span := tracing.Start(ctx, "jobs.CleanRemovedEvents")
+	defer span.End()
+
+	started := time.Now()
+	result, err := jr.cleanRemovedEvents(ctx)
+	observe(model.JOB_CLEAN_REMOVED_EVENTS, started, result, err)
+	return result, err
+}
+
+func (jr *Runner) cleanRemovedEvents(ctx context.Context) (*model.JobResult, error) {
+	members, err := jr.eventsRepo.GetAllMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.JobResult{Job: model.JOB_CLEAN_REMOVED_EVENTS, Failed: make([]string, 0)}
+	for member, eventIds := range members {
+		for _, eventId := range eventIds {
+			_, _, err := jr.eventsRepo.GetEvent(ctx, eventId)
+			if err != errors.EventNotFound {
+				continue
+			}
+
+			err = jr.eventsRepo.RemoveEventIdFromMember(ctx, member, eventId)
+			if err != nil {
+				jr.logger.WithContext(ctx).Warnf("[CleanRemovedEvents] event %s of %s not removed: %s", eventId, member, err.Error())
+				result.Failed = append(result.Failed, eventId)
+				continue
+			}
+			result.Processed++
+		}
+	}
+	return result, nil
+}
+
+// UpdateTimestamps moves past regular events to next repeat and removes past single
+// copies of regular events
+func (jr *Runner) UpdateTimestamps(ctx context.Context, now int64) (*model.JobResult, error) {
+	ctx, span := tracing.Start(ctx, "jobs.UpdateTimestamps")
+	defer span.End()
+
+	started := time.Now()
+	result, err := jr.updateTimestamps(ctx, now)
+	observe(model.JOB_UPDATE_TIMESTAMP, started, result, err)
+	return result, err
+}
+
+func (jr *Runner) updateTimestamps(ctx context.Context, now int64) (*model.JobResult, error) {
+	eventIds, err := jr.eventsRepo.GetAllEventIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.JobResult{Job: model.JOB_UPDATE_TIMESTAMP, Failed: make([]string, 0)}
+	for _, eventId := range eventIds {
+		// skip initialized event id
+		if eventId == "nocalender_regular_event_init" || eventId == "nocalender_single_event_init" {
+			continue
+		}
+
+		updated, err := jr.updateTimestamp(ctx, eventId, now)
+		if err != nil {
+			jr.logger.WithContext(ctx).Warnf("[UpdateTimestamps] event %s not updated: %s", eventId, err.Error())
+			result.Failed = append(result.Failed, eventId)
+			continue
+		}
+		if updated {
+			result.Processed++
+		}
+	}
+	return result, nil
+}
+
+// observe records run of job in metrics. Run is partial if some events failed
+func observe(job string, started time.Time, result *model.JobResult, err error) {
+	metrics.JobDuration.WithLabelValues(job).Observe(time.Since(started).Seconds())
+
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	} else if len(result.Failed) > 0 {
+		outcome = "partial"
+	}
+	metrics.JobRuns.WithLabelValues(job, outcome).Inc()
+	if err != nil {
+		return
+	}
+
+	metrics.JobEvents.WithLabelValues(job, "processed").Add(float64(result.Processed))
+	metrics.JobEvents.WithLabelValues(job, "failed").Add(float64(len(result.Failed)))
+	if outcome == "success" {
+		metrics.JobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+}
+
+func (jr *Runner) updateTimestamp(ctx context.Context, eventId string, now int64) (bool, error) {
+	ievent, mode, err := jr.eventsRepo.GetEvent(ctx, eventId)
+	if err != nil {
+		return false, err
+	}
+
+	supEventId := model.SupportEventId(ievent, mode)
+	event := model.ConvertInterfaceToEvent(ievent, mode)
+	if event.Timestamp >= now {
+		return false, nil
+	}
+
+	if mode == model.REGULAR_EVENT {
+		event.Timestamp += event.Delta * model.DAYS_IN_SECONDS
+		return true, jr.eventsRepo.InsertRegularEvent(ctx, event.ToRegular(supEventId), mode)
+	}
+
+	// past single copy is dropped, regular event goes on without it
+	err = jr.eventsRepo.RemoveEvent(ctx, event.Id, mode)
+	if err != nil {
+		return false, err
+	}
+	iregular, regularMode, err := jr.eventsRepo.GetEvent(ctx, supEventId)
+	if err != nil {
+		return false, err
+	}
+	regular := model.ConvertInterfaceToEvent(iregular, regularMode)
+	return true, jr.eventsRepo.InsertRegularEvent(ctx, regular.ToRegular(""), model.REGULAR_EVENT)
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"nocalendar/internal/ratelimit"
+
+	"github.com/sirupsen/logrus"
+)
+
+type AccessLogMiddleware struct {
+	ipHeader string
+	logger   *logrus.Logger
+}
+
+func NewAccessLogMiddleware(ipHeader string, logger *logrus.Logger) *AccessLogMiddleware {
+	return &AccessLogMiddleware{
+		ipHeader: ipHeader,
+		logger:   logger,
+	}
+}
+
+// Log writes line for every request when it ends. It must be used after
+// RequestMiddleware, which gives id, route and latency to the line
+func (alm *AccessLogMiddleware) Log(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		level := logrus.InfoLevel
+		if recorder.Status >= http.StatusInternalServerError {
+			level = logrus.ErrorLevel
+		}
+		alm.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     recorder.Status,
+			"bytes":      recorder.Bytes,
+			"ip":         ratelimit.ClientIp(r, alm.ipHeader),
+			"user_agent": r.UserAgent(),
+		}).Log(level, "access")
+	})
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"nocalendar/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// StatusRecorder remembers status and size of response for middlewares which run after handler
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{
+		ResponseWriter: w,
+		Status:         http.StatusOK,
+	}
+}
+
+func (sr *StatusRecorder) WriteHeader(status int) {
+	sr.Status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *StatusRecorder) Write(buf []byte) (int, error) {
+	n, err := sr.ResponseWriter.Write(buf)
+	sr.Bytes += n
+	return n, err
+}
+
+// Flush keeps streams of notifications working through recorder
+func (sr *StatusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// MetricsMiddleware counts requests by template of route
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		started := time.Now()
+		recorder := NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		status := strconv.Itoa(recorder.Status)
+		metrics.HttpRequests.WithLabelValues(route, r.Method, status).Inc()
+		metrics.HttpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(started).Seconds())
+	})
+}
@@ -3,14 +3,22 @@ package middleware
 import (
 	"context"
 	"net/http"
-	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/logger"
+	"nocalendar/internal/model"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 type contextKey string
 
-const ContextUserKey contextKey = "user_key"
+const (
+	ContextUserKey    contextKey = "user_key"
+	ContextSessionKey contextKey = "session_key"
+	ContextApiKeyKey  contextKey = "api_key_key"
+)
 
 func ContentTypeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -19,37 +27,136 @@ func ContentTypeMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AuthMiddleware checks credentials with auth usecase of organization of request,
+// so it must be used after TenantMiddleware
 type AuthMiddleware struct {
-	authUsecase auth.AuthUsecase
-	logger      *logrus.Logger
+	logger *logrus.Logger
 }
 
-func NewAuthMiddleware(authUsecase auth.AuthUsecase, logger *logrus.Logger) *AuthMiddleware {
+func NewAuthMiddleware(logger *logrus.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
-		authUsecase: authUsecase,
-		logger:      logger,
+		logger: logger,
 	}
 }
 
+// TokenChecking accepts access token of session or api key. Requests with api key have
+// no session in context, but have the key itself
 func (am *AuthMiddleware) TokenChecking(next http.Handler) http.Handler {
+	return am.tokenChecking(next, false)
+}
+
+// RestrictedTokenChecking also accepts sessions which have to enroll second factor first
+func (am *AuthMiddleware) RestrictedTokenChecking(next http.Handler) http.Handler {
+	return am.tokenChecking(next, true)
+}
+
+func (am *AuthMiddleware) tokenChecking(next http.Handler, allowRestricted bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Authorize")
 		if token == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(`{"message": "unauthorized"}`))
+			errors.Write(w, r, errors.Unauthorized)
+			return
+		}
+
+		authUsecase := tenant.FromContext(r.Context()).Auth
+		if strings.HasPrefix(token, model.API_KEY_PREFIX) {
+			usr, apiKey, err := authUsecase.CheckApiKey(r.Context(), token)
+			if errors.IsStorageError(err) {
+				errors.Write(w, r, err)
+				return
+			}
+			if err != nil {
+				errors.Write(w, r, errors.Unauthorized)
+				return
+			}
+
+			logLogin(r, usr)
+			ctx := context.WithValue(r.Context(), ContextUserKey, usr)
+			ctx = context.WithValue(ctx, ContextApiKeyKey, apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		usr, err := am.authUsecase.GetUserByToken(token)
+		usr, session, err := authUsecase.CheckAccessToken(token)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(`{"message": "unauthorized"}`))
+			errors.Write(w, r, errors.Unauthorized)
 			return
 		}
 
+		if session.Restricted && !allowRestricted {
+			errors.Write(w, r, errors.TotpRequired)
+			return
+		}
+
+		logLogin(r, usr)
 		ctx := context.WithValue(r.Context(), ContextUserKey, usr)
+		ctx = context.WithValue(ctx, ContextSessionKey, session)
 
-		w.Header().Set("Authorize", usr.Token)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// logLogin adds login of user to lines logged during request
+func logLogin(r *http.Request, usr *model.User) {
+	if req := logger.RequestFromContext(r.Context()); req != nil {
+		req.Login = usr.Login
+	}
+}
+
+// SessionOnly rejects requests with api key, it must be used after TokenChecking
+func (am *AuthMiddleware) SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(ContextSessionKey).(*model.Session); !ok {
+			errors.Write(w, r, errors.SessionOnly)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope rejects requests with api key without scope, sessions have all scopes.
+// It must be used after TokenChecking
+func (am *AuthMiddleware) RequireScope(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey, ok := r.Context().Value(ContextApiKeyKey).(*model.ApiKey); ok && !apiKey.HasScope(scope) {
+			errors.Write(w, r, errors.ScopeRequired)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole rejects users whose role is lower than required one, suspended users are rejected
+// even if their access token is still valid. Full user replaces the one from token in
+// context. It must be used after TokenChecking
+func (am *AuthMiddleware) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			login := r.Context().Value(ContextUserKey).(*model.User).Login
+			usr, err := tenant.FromContext(r.Context()).Auth.GetProfile(r.Context(), login)
+			if err != nil {
+				am.logger.WithContext(r.Context()).Warnf("[RequireRole] user %s not found: %s", login, err.Error())
+				if errors.IsStorageError(err) {
+					errors.Write(w, r, err)
+					return
+				}
+				errors.Write(w, r, errors.Unauthorized)
+				return
+			}
+
+			if usr.Suspended {
+				errors.Write(w, r, errors.UserSuspended)
+				return
+			}
+			if !model.HasUserRole(usr.UserRole(), role) {
+				errors.Write(w, r, errors.HasNoRights)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ContextUserKey, usr)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
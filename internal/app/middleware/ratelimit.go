@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type RateLimitMiddleware struct {
+	limiter  *ratelimit.TokenBucket
+	ipHeader string
+	logger   *logrus.Logger
+}
+
+func NewRateLimitMiddleware(limiter *ratelimit.TokenBucket, ipHeader string, logger *logrus.Logger) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		limiter:  limiter,
+		ipHeader: ipHeader,
+		logger:   logger,
+	}
+}
+
+// SetRetryAfter sets Retry-After header in whole seconds, rounded up
+func SetRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// Limit rejects requests of client which exceeded rate limit
+func (rm *RateLimitMiddleware) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ratelimit.ClientIp(r, rm.ipHeader)
+		ok, wait := rm.limiter.Allow(ip)
+		if !ok {
+			rm.logger.WithContext(r.Context()).Warnf("[Limit] rate limit exceeded by %s", ip)
+			SetRetryAfter(w, wait)
+			errors.Write(w, r, errors.TooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
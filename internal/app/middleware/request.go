@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"nocalendar/internal/logger"
+	"nocalendar/internal/util"
+	"regexp"
+	"time"
+)
+
+const (
+	REQUEST_ID_HEADER    = "X-Request-ID"
+	LENGTH_OF_REQUEST_ID = 16
+)
+
+// id of proxy goes to log as is, so it must not break lines or fields
+var requestIdRegexp = regexp.MustCompile(`^[\w\-.:]{1,128}$`)
+
+// RequestMiddleware takes id of request from proxy or generates new one and returns it
+// in response. Fields of request are put to context for logger
+func RequestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if !requestIdRegexp.MatchString(id) {
+			id = util.GenerateSecureString(LENGTH_OF_REQUEST_ID)
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+
+		req := &logger.Request{
+			Id:      id,
+			Route:   routeTemplate(r),
+			Started: time.Now(),
+		}
+		next.ServeHTTP(w, r.WithContext(logger.WithRequest(r.Context(), req)))
+	})
+}
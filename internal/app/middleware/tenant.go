@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/logger"
+	"nocalendar/internal/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+type TenantMiddleware struct {
+	tenants *tenant.Registry
+	logger  *logrus.Logger
+}
+
+func NewTenantMiddleware(tenants *tenant.Registry, logger *logrus.Logger) *TenantMiddleware {
+	return &TenantMiddleware{
+		tenants: tenants,
+		logger:  logger,
+	}
+}
+
+// Tenant puts services of organization from Organization header or org cgi to context.
+// Requests without organization go to default one
+func (tm *TenantMiddleware) Tenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId := r.Header.Get(model.ORG_HEADER)
+		if orgId == "" {
+			orgId = r.URL.Query().Get(model.OrgCgi)
+		}
+
+		services, err := tm.tenants.Get(r.Context(), orgId)
+		if err != nil {
+			tm.logger.WithContext(r.Context()).Warnf("[Tenant] organization %s not resolved: %s", orgId, err.Error())
+			errors.Write(w, r, err)
+			return
+		}
+
+		if req := logger.RequestFromContext(r.Context()); req != nil {
+			req.Org = services.Org.Id
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), services)))
+	})
+}
+
+// TargetTenant lets super administrators manage other organizations: services of
+// organization from target_org cgi replace services of their own one. It must be used
+// after AuthMiddleware.RequireRole
+func (tm *TenantMiddleware) TargetTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId := r.URL.Query().Get(model.TargetOrgCgi)
+		if orgId == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		usr := r.Context().Value(ContextUserKey).(*model.User)
+		if !model.HasUserRole(usr.UserRole(), model.USER_ROLE_SUPER_ADMIN) {
+			errors.Write(w, r, errors.HasNoRights)
+			return
+		}
+
+		services, err := tm.tenants.Get(r.Context(), orgId)
+		if err != nil {
+			tm.logger.WithContext(r.Context()).Warnf("[TargetTenant] organization %s not resolved: %s", orgId, err.Error())
+			errors.Write(w, r, err)
+			return
+		}
+
+		tm.logger.WithContext(r.Context()).Infof("[TargetTenant] %s manages organization %s", usr.Login, orgId)
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), services)))
+	})
+}
@@ -0,0 +1,13 @@
+package orgs
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type OrgsRepository interface {
+	InsertOrg(ctx context.Context, org *model.Org) error
+	GetOrg(ctx context.Context, orgId string) (*model.Org, error)
+	GetOrgs(ctx context.Context) ([]*model.Org, error)
+	UpdateSettings(ctx context.Context, orgId string, settings *model.OrgSettings) error
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/orgs"
+	"nocalendar/internal/db"
+	"nocalendar/internal/model"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrgsRepository keeps registry of organizations. It is the only document which
+// belongs to no organization, so it is not addressed through Database.Doc
+type OrgsRepository struct {
+	mongo  *db.Database
+	logger *logrus.Logger
+}
+
+func NewOrgsRepository(mongo *db.Database, logger *logrus.Logger) orgs.OrgsRepository {
+	return &OrgsRepository{
+		mongo:  mongo,
+		logger: logger,
+	}
+}
+
+func (or *OrgsRepository) InsertOrg(ctx context.Context, org *model.Org) error {
+	ctx, end := or.mongo.Call(ctx, "orgs", "InsertOrg")
+	defer end()
+
+	filter := bson.M{
+		"_id":                          "json/orgs",
+		fmt.Sprintf("orgs.%s", org.Id): bson.M{"$exists": false},
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("orgs.%s", org.Id): org,
+		},
+	}
+
+	res, err := or.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		or.logger.WithContext(ctx).Warnf("[InsertOrg] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	if res.MatchedCount == 0 {
+		return errors.OrgAlreadyExists
+	}
+	return nil
+}
+
+func (or *OrgsRepository) UpdateSettings(ctx context.Context, orgId string, settings *model.OrgSettings) error {
+	ctx, end := or.mongo.Call(ctx, "orgs", "UpdateSettings")
+	defer end()
+
+	filter := bson.M{
+		"_id":                         "json/orgs",
+		fmt.Sprintf("orgs.%s", orgId): bson.M{"$exists": true},
+	}
+
+	set := bson.M{}
+	if settings.Require2fa != nil {
+		set[fmt.Sprintf("orgs.%s.require_2fa", orgId)] = *settings.Require2fa
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	res, err := or.mongo.Conn.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		or.logger.WithContext(ctx).Warnf("[UpdateSettings] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	if res.MatchedCount == 0 {
+		return errors.OrgNotFound
+	}
+	return nil
+}
+
+func (or *OrgsRepository) GetOrg(ctx context.Context, orgId string) (*model.Org, error) {
+	ctx, end := or.mongo.Call(ctx, "orgs", "GetOrg")
+	defer end()
+
+	doc := &model.BsonOrgs{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("orgs.%s", orgId): 1})
+	err := or.mongo.Conn.FindOne(ctx, bson.M{"_id": "json/orgs"}, opts).Decode(doc)
+	switch err {
+	case nil:
+		org, ok := doc.Orgs[orgId]
+		if !ok {
+			return nil, errors.OrgNotFound
+		}
+		return &org, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.OrgNotFound
+	default:
+		or.logger.WithContext(ctx).Warnf("[GetOrg] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (or *OrgsRepository) GetOrgs(ctx context.Context) ([]*model.Org, error) {
+	ctx, end := or.mongo.Call(ctx, "orgs", "GetOrgs")
+	defer end()
+
+	doc := &model.BsonOrgs{}
+	err := or.mongo.Conn.FindOne(ctx, bson.M{"_id": "json/orgs"}).Decode(doc)
+	if err != nil {
+		or.logger.WithContext(ctx).Warnf("[GetOrgs] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+
+	result := make([]*model.Org, 0, len(doc.Orgs))
+	for id := range doc.Orgs {
+		org := doc.Orgs[id]
+		result = append(result, &org)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/db/dbtest"
+	"nocalendar/internal/model"
+	"testing"
+)
+
+func TestUpdateSettingsKeepsOtherFields(t *testing.T) {
+	or := NewOrgsRepository(dbtest.NewDatabase(t), dbtest.Logger())
+	ctx := context.Background()
+
+	err := or.InsertOrg(ctx, &model.Org{Id: "acme", Name: "Acme", OpenRegistration: true})
+	if err != nil {
+		t.Fatalf("InsertOrg: %s", err.Error())
+	}
+
+	require := true
+	if err := or.UpdateSettings(ctx, "acme", &model.OrgSettings{Require2fa: &require}); err != nil {
+		t.Fatalf("UpdateSettings: %s", err.Error())
+	}
+	org, err := or.GetOrg(ctx, "acme")
+	if err != nil || !org.Require2fa || org.Name != "Acme" || !org.OpenRegistration {
+		t.Errorf("GetOrg = %+v, %v, want require_2fa with other fields kept", org, err)
+	}
+
+	if err := or.UpdateSettings(ctx, "ghost", &model.OrgSettings{Require2fa: &require}); err != errors.OrgNotFound {
+		t.Errorf("UpdateSettings of unknown org = %v, want %v", err, errors.OrgNotFound)
+	}
+}
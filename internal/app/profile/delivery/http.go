@@ -0,0 +1,159 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/profile"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ProfileDelivery struct {
+	logger *logrus.Logger
+}
+
+func NewProfileDelivery(logger *logrus.Logger) *ProfileDelivery {
+	return &ProfileDelivery{
+		logger: logger,
+	}
+}
+
+func (pd *ProfileDelivery) profileUsecase(r *http.Request) profile.ProfileUsecase {
+	return tenant.FromContext(r.Context()).Profile
+}
+
+func (pd *ProfileDelivery) authUsecase(r *http.Request) auth.AuthUsecase {
+	return tenant.FromContext(r.Context()).Auth
+}
+
+func (pd *ProfileDelivery) Routing(r *mux.Router) {
+	me := r.PathPrefix("/user/me").Subrouter()
+	am := middleware.NewAuthMiddleware(pd.logger)
+	me.Use(am.TokenChecking, am.SessionOnly)
+
+	me.HandleFunc("", pd.GetProfile).Methods(http.MethodGet, http.MethodOptions)
+	me.HandleFunc("", pd.UpdateProfile).Methods(http.MethodPatch, http.MethodOptions)
+	me.HandleFunc("", pd.DeleteAccount).Methods(http.MethodDelete, http.MethodOptions)
+	me.HandleFunc("/export", pd.Export).Methods(http.MethodGet, http.MethodOptions)
+
+	r.Handle("/users/search", am.TokenChecking(am.RequireScope(model.SCOPE_USERS_READ, pd.SearchUsers))).Methods(http.MethodGet, http.MethodOptions)
+}
+
+func (pd *ProfileDelivery) GetProfile(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	usrProfile, err := pd.profileUsecase(r).GetProfile(r.Context(), usr.Login)
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[GetProfile] profile not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(usrProfile.ToAnswer()))
+}
+
+func (pd *ProfileDelivery) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	update := &model.ProfileUpdate{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, update)
+	}
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[UpdateProfile] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.BadProfile)
+		return
+	}
+
+	usrProfile, err := pd.profileUsecase(r).UpdateProfile(r.Context(), usr.Login, update)
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[UpdateProfile] profile not updated: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(usrProfile.ToAnswer()))
+}
+
+func (pd *ProfileDelivery) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	request := &model.DeleteAccountRequest{}
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err == nil && len(buf) > 0 {
+		err = json.Unmarshal(buf, request)
+	}
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[DeleteAccount] cannot read body: %s", err.Error())
+		errors.Write(w, r, errors.MalformedBody)
+		return
+	}
+
+	err = pd.profileUsecase(r).DeleteAccount(r.Context(), usr.Login, request)
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[DeleteAccount] account not deleted: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "ok"}`))
+}
+
+func (pd *ProfileDelivery) Export(w http.ResponseWriter, r *http.Request) {
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+
+	archive, err := pd.profileUsecase(r).Export(r.Context(), usr.Login)
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[Export] data not exported: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="nocalendar-%s.zip"`, usr.Login))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+func (pd *ProfileDelivery) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, limit := 0, 0
+	var err error
+	if value := query.Get(model.OffsetCgi); value != "" {
+		offset, err = strconv.Atoi(value)
+	}
+	if value := query.Get(model.LimitCgi); err == nil && value != "" {
+		limit, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[SearchUsers] cannot parse cgies: %s", err.Error())
+		errors.Write(w, r, errors.BadSearchQuery)
+		return
+	}
+
+	users, err := pd.authUsecase(r).SearchUsers(r.Context(), query.Get(model.QueryCgi), offset, limit)
+	if err != nil {
+		pd.logger.WithContext(r.Context()).Warnf("[SearchUsers] users not found: %s", err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(users.ToAnswer()))
+}
@@ -0,0 +1,13 @@
+package profile
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type ProfileUsecase interface {
+	GetProfile(ctx context.Context, login string) (*model.UserProfile, error)
+	UpdateProfile(ctx context.Context, login string, update *model.ProfileUpdate) (*model.UserProfile, error)
+	DeleteAccount(ctx context.Context, login string, request *model.DeleteAccountRequest) error
+	Export(ctx context.Context, login string) ([]byte, error)
+}
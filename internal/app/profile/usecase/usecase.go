@@ -0,0 +1,224 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/profile"
+	"nocalendar/internal/app/sso"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProfileUsecase has no own storage, it combines data of other domains
+type ProfileUsecase struct {
+	authUsecase      auth.AuthUsecase
+	eventsUsecase    events.EventsUsecase
+	calendarsUsecase calendars.CalendarsUsecase
+	groupsUsecase    groups.GroupsUsecase
+	ssoUsecase       sso.SsoUsecase
+	logger           *logrus.Logger
+}
+
+func NewProfileUsecase(authUsecase auth.AuthUsecase, eventsUsecase events.EventsUsecase, calendarsUsecase calendars.CalendarsUsecase,
+	groupsUsecase groups.GroupsUsecase, ssoUsecase sso.SsoUsecase, logger *logrus.Logger) profile.ProfileUsecase {
+	return &ProfileUsecase{
+		authUsecase:      authUsecase,
+		eventsUsecase:    eventsUsecase,
+		calendarsUsecase: calendarsUsecase,
+		groupsUsecase:    groupsUsecase,
+		ssoUsecase:       ssoUsecase,
+		logger:           logger,
+	}
+}
+
+func (pu *ProfileUsecase) GetProfile(ctx context.Context, login string) (*model.UserProfile, error) {
+	ctx, span := tracing.Start(ctx, "profile.GetProfile")
+	defer span.End()
+
+	usr, err := pu.authUsecase.GetProfile(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	return usr.Profile(), nil
+}
+
+func (pu *ProfileUsecase) UpdateProfile(ctx context.Context, login string, update *model.ProfileUpdate) (*model.UserProfile, error) {
+	ctx, span := tracing.Start(ctx, "profile.UpdateProfile")
+	defer span.End()
+
+	usr, err := pu.authUsecase.UpdateProfile(ctx, login, update)
+	if err != nil {
+		return nil, err
+	}
+	return usr.Profile(), nil
+}
+
+// DeleteAccount removes user from events, calendars and groups of other users, gives away or cancels
+// own events, calendars and groups and then removes user with sessions, api keys and linked identities
+func (pu *ProfileUsecase) DeleteAccount(ctx context.Context, login string, request *model.DeleteAccountRequest) error {
+	ctx, span := tracing.Start(ctx, "profile.DeleteAccount")
+	defer span.End()
+
+	usr, err := pu.authUsecase.GetProfile(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	// users created by identity provider have no password
+	if usr.Password != "" {
+		_, err = pu.authUsecase.GetUser(ctx, &model.Auth{Login: login, Password: request.Password})
+		if err == errors.BadCredentials {
+			return errors.BadPassword
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if request.TransferTo != "" {
+		if request.TransferTo == login {
+			return errors.BadTransfer
+		}
+		_, err = pu.authUsecase.GetProfile(ctx, request.TransferTo)
+		if err == errors.UserNotFound {
+			return errors.BadTransfer
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// checked last, so code is not spent on request which fails anyway
+	if usr.TotpEnabled {
+		_, err = pu.authUsecase.CheckSecondFactor(ctx, login, &model.SecondFactorRequest{
+			Code:         request.Code,
+			RecoveryCode: request.RecoveryCode,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = pu.eventsUsecase.RemoveMember(ctx, login, request.TransferTo)
+	if err != nil {
+		return err
+	}
+
+	err = pu.calendarsUsecase.RemoveOwner(ctx, login, request.TransferTo)
+	if err != nil {
+		return err
+	}
+
+	err = pu.groupsUsecase.RemoveUser(ctx, login, request.TransferTo)
+	if err != nil {
+		return err
+	}
+
+	err = pu.ssoUsecase.RemoveIdentities(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	pu.logger.WithContext(ctx).Infof("[DeleteAccount] account %s deleted", login)
+	return pu.authUsecase.RemoveUser(ctx, login)
+}
+
+func addJson(archive *zip.Writer, name string, data interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// Export returns zip archive with all personal data of user
+func (pu *ProfileUsecase) Export(ctx context.Context, login string) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "profile.Export")
+	defer span.End()
+
+	usr, err := pu.authUsecase.GetProfile(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	memberEvents, err := pu.eventsUsecase.GetMemberEvents(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	invites, err := pu.eventsUsecase.GetInvites(ctx, "", model.NilCgi, login)
+	if err == errors.InviteNotFound {
+		invites, err = &model.InviteJson{Invites: []string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cals, err := pu.calendarsUsecase.GetCalendars(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	allGroups, err := pu.groupsUsecase.GetGroups(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	ownGroups := make([]*model.Group, 0)
+	for _, group := range allGroups.Groups {
+		if group.Owner == login || group.HasMember(login) {
+			ownGroups = append(ownGroups, group)
+		}
+	}
+
+	sessions, err := pu.authUsecase.GetSessions(ctx, login, "")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := pu.authUsecase.GetApiKeys(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", usr.Profile()},
+		{"events.json", memberEvents.Events},
+		{"invites.json", invites.Invites},
+		{"calendars.json", cals.Calendars},
+		{"groups.json", ownGroups},
+		{"sessions.json", sessions.Sessions},
+		{"api_keys.json", keys.ApiKeys},
+	}
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for _, file := range files {
+		err = addJson(archive, file.name, file.data)
+		if err != nil {
+			pu.logger.WithContext(ctx).Warnf("[Export] cannot write %s: %s", file.name, err.Error())
+			return nil, errors.InternalError
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		pu.logger.WithContext(ctx).Warnf("[Export] cannot close archive: %s", err.Error())
+		return nil, errors.InternalError
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/sso"
+	"nocalendar/internal/model"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeAuth knows alice with password and second factor, valid code is "123456"
+type fakeAuth struct {
+	auth.AuthUsecase
+	removed bool
+}
+
+func (fa *fakeAuth) GetProfile(ctx context.Context, login string) (*model.User, error) {
+	return &model.User{Login: login, Password: "hash", TotpEnabled: true}, nil
+}
+
+func (fa *fakeAuth) GetUser(ctx context.Context, ausr *model.Auth) (*model.User, error) {
+	if ausr.Password != "password" {
+		return nil, errors.BadCredentials
+	}
+	return &model.User{Login: ausr.Login}, nil
+}
+
+func (fa *fakeAuth) CheckSecondFactor(ctx context.Context, login string, request *model.SecondFactorRequest) (*model.User, error) {
+	if request.Code != "123456" && request.RecoveryCode != "abcd-efgh" {
+		return nil, errors.BadTotpCode
+	}
+	return &model.User{Login: login}, nil
+}
+
+func (fa *fakeAuth) RemoveUser(ctx context.Context, login string) error {
+	fa.removed = true
+	return nil
+}
+
+type fakeEvents struct{ events.EventsUsecase }
+
+func (fakeEvents) RemoveMember(ctx context.Context, login, transferTo string) error { return nil }
+
+type fakeCalendars struct{ calendars.CalendarsUsecase }
+
+func (fakeCalendars) RemoveOwner(ctx context.Context, login, transferTo string) error { return nil }
+
+type fakeGroups struct{ groups.GroupsUsecase }
+
+func (fakeGroups) RemoveUser(ctx context.Context, login, transferTo string) error { return nil }
+
+type fakeSso struct{ sso.SsoUsecase }
+
+func (fakeSso) RemoveIdentities(ctx context.Context, login string) error { return nil }
+
+func TestDeleteAccountRequiresSecondFactor(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	tests := []struct {
+		name    string
+		request *model.DeleteAccountRequest
+		err     error
+	}{
+		{"password only", &model.DeleteAccountRequest{Password: "password"}, errors.BadTotpCode},
+		{"wrong code", &model.DeleteAccountRequest{Password: "password", Code: "000000"}, errors.BadTotpCode},
+		{"wrong password", &model.DeleteAccountRequest{Password: "guess", Code: "123456"}, errors.BadPassword},
+		{"one-time code", &model.DeleteAccountRequest{Password: "password", Code: "123456"}, nil},
+		{"recovery code", &model.DeleteAccountRequest{Password: "password", RecoveryCode: "abcd-efgh"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			au := &fakeAuth{}
+			pu := NewProfileUsecase(au, fakeEvents{}, fakeCalendars{}, fakeGroups{}, fakeSso{}, logger)
+
+			err := pu.DeleteAccount(context.Background(), "alice", tt.request)
+			if err != tt.err {
+				t.Fatalf("DeleteAccount = %v, want %v", err, tt.err)
+			}
+			if au.removed != (tt.err == nil) {
+				t.Errorf("user removed = %t, want %t", au.removed, tt.err == nil)
+			}
+		})
+	}
+}
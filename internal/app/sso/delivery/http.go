@@ -0,0 +1,91 @@
+package delivery
+
+import (
+	"net/http"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/sso"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type SsoDelivery struct {
+	tenants *tenant.Registry // callback of provider finds organization by state
+	logger  *logrus.Logger
+}
+
+func NewSsoDelivery(tenants *tenant.Registry, logger *logrus.Logger) *SsoDelivery {
+	return &SsoDelivery{
+		tenants: tenants,
+		logger:  logger,
+	}
+}
+
+func (sd *SsoDelivery) ssoUsecase(r *http.Request) sso.SsoUsecase {
+	return tenant.FromContext(r.Context()).Sso
+}
+
+func (sd *SsoDelivery) Routing(r *mux.Router) {
+	s := r.PathPrefix("/oidc").Subrouter()
+	s.HandleFunc("/providers", sd.GetProviders).Methods(http.MethodGet, http.MethodOptions)
+	s.HandleFunc("/{provider:[\\w-]+}/login", sd.Login).Methods(http.MethodGet, http.MethodOptions)
+	s.HandleFunc("/{provider:[\\w-]+}/callback", sd.Callback).Methods(http.MethodGet, http.MethodOptions)
+}
+
+func (sd *SsoDelivery) GetProviders(w http.ResponseWriter, r *http.Request) {
+	providers := sd.ssoUsecase(r).GetProviders()
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(providers.ToAnswer()))
+}
+
+func (sd *SsoDelivery) Login(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	url, err := sd.ssoUsecase(r).Login(r.Context(), provider)
+	if err != nil {
+		sd.logger.WithContext(r.Context()).Warnf("[Login] login with %s not started: %s", provider, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (sd *SsoDelivery) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	query := r.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		sd.logger.WithContext(r.Context()).Warnf("[Callback] %s returned error: %s", provider, providerErr)
+		errors.Write(w, r, errors.OidcRejected)
+		return
+	}
+
+	state := query.Get("state")
+	orgId, _ := model.SplitOrgState(state)
+	services, err := sd.tenants.Get(r.Context(), orgId)
+	if err != nil {
+		sd.logger.WithContext(r.Context()).Warnf("[Callback] organization of state not found: %s", err.Error())
+		if errors.IsStorageError(err) {
+			errors.Write(w, r, err)
+			return
+		}
+		errors.Write(w, r, errors.BadOidcState)
+		return
+	}
+
+	usr, tokens, err := services.Sso.Callback(r.Context(), provider, state, query.Get("code"), r.UserAgent())
+	if err != nil {
+		sd.logger.WithContext(r.Context()).Warnf("[Callback] login with %s failed: %s", provider, err.Error())
+		errors.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Authorize", tokens.AccessToken)
+	w.Header().Set("Refresh-Token", tokens.RefreshToken)
+	w.WriteHeader(http.StatusOK)
+	w.Write(model.ToBytes(usr.Profile()))
+}
@@ -0,0 +1,16 @@
+package sso
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type SsoRepository interface {
+	InsertState(ctx context.Context, state string, oidcState *model.OidcState) error
+	PopState(ctx context.Context, state string) (*model.OidcState, error)
+	RemoveStatesBefore(ctx context.Context, timestamp int64) error
+
+	GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error)
+	InsertIdentity(ctx context.Context, identity *model.Identity) error
+	RemoveIdentitiesByLogin(ctx context.Context, login string) error
+}
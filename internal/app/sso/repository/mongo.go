@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/sso"
+	"nocalendar/internal/db"
+	"nocalendar/internal/model"
+	"nocalendar/internal/util"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SsoRepository struct {
+	mongo  *db.Database
+	logger *logrus.Logger
+}
+
+func NewSsoRepository(mongo *db.Database, logger *logrus.Logger) sso.SsoRepository {
+	return &SsoRepository{
+		mongo:  mongo,
+		logger: logger,
+	}
+}
+
+func (sr *SsoRepository) InsertState(ctx context.Context, state string, oidcState *model.OidcState) error {
+	ctx, end := sr.mongo.Call(ctx, "sso", "InsertState")
+	defer end()
+
+	filter := bson.M{
+		"_id": sr.mongo.Doc("json/oidc_states"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("oidc_states.%s", state): oidcState,
+		},
+	}
+
+	_, err := sr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		sr.logger.WithContext(ctx).Warnf("[InsertState] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+// PopState atomically returns and removes state, so each state can be used only once
+func (sr *SsoRepository) PopState(ctx context.Context, state string) (*model.OidcState, error) {
+	ctx, end := sr.mongo.Call(ctx, "sso", "PopState")
+	defer end()
+
+	key := fmt.Sprintf("oidc_states.%s", state)
+	filter := bson.M{
+		"_id": sr.mongo.Doc("json/oidc_states"),
+	}
+	filter[key] = bson.M{"$exists": true}
+
+	body := bson.M{
+		"$unset": bson.M{
+			key: "",
+		},
+	}
+
+	opts := options.FindOneAndUpdate()
+	opts.SetProjection(bson.M{key: 1})
+	opts.SetReturnDocument(options.Before)
+
+	doc := &model.BsonOidcStates{}
+	err := sr.mongo.Conn.FindOneAndUpdate(ctx, filter, body, opts).Decode(doc)
+	switch err {
+	case nil:
+		oidcState, ok := doc.States[state]
+		if !ok {
+			return nil, errors.BadOidcState
+		}
+		return oidcState, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.BadOidcState
+	default:
+		sr.logger.WithContext(ctx).Warnf("[PopState] FindOneAndUpdate: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+// RemoveStatesBefore removes states of logins which were never completed
+func (sr *SsoRepository) RemoveStatesBefore(ctx context.Context, timestamp int64) error {
+	ctx, end := sr.mongo.Call(ctx, "sso", "RemoveStatesBefore")
+	defer end()
+
+	doc := &model.BsonOidcStates{}
+	err := sr.mongo.Conn.FindOne(ctx, bson.M{"_id": sr.mongo.Doc("json/oidc_states")}).Decode(doc)
+	if err != nil {
+		sr.logger.WithContext(ctx).Warnf("[RemoveStatesBefore] FindOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	unset := bson.M{}
+	for state, oidcState := range doc.States {
+		if oidcState.CreatedAt < timestamp {
+			unset[fmt.Sprintf("oidc_states.%s", state)] = ""
+		}
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+
+	_, err = sr.mongo.Conn.UpdateOne(ctx, bson.M{"_id": sr.mongo.Doc("json/oidc_states")}, bson.M{"$unset": unset})
+	if err != nil {
+		sr.logger.WithContext(ctx).Warnf("[RemoveStatesBefore] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+// identityKey hashes provider and subject, because subject may contain symbols forbidden in field names
+func identityKey(provider, subject string) string {
+	return util.HashToken(provider + "\x00" + subject)
+}
+
+func (sr *SsoRepository) GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error) {
+	ctx, end := sr.mongo.Call(ctx, "sso", "GetIdentity")
+	defer end()
+
+	key := identityKey(provider, subject)
+	doc := &model.BsonIdentities{}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{fmt.Sprintf("identities.%s", key): 1})
+	err := sr.mongo.Conn.FindOne(ctx, bson.M{"_id": sr.mongo.Doc("json/identities")}, opts).Decode(doc)
+	switch err {
+	case nil:
+		identity, ok := doc.Identities[key]
+		if !ok {
+			return nil, errors.UserNotFound
+		}
+		return identity, nil
+	case mongo.ErrNoDocuments:
+		return nil, errors.UserNotFound
+	default:
+		sr.logger.WithContext(ctx).Warnf("[GetIdentity] FindOne: %s", err.Error())
+		return nil, db.StorageError(ctx, err)
+	}
+}
+
+func (sr *SsoRepository) InsertIdentity(ctx context.Context, identity *model.Identity) error {
+	ctx, end := sr.mongo.Call(ctx, "sso", "InsertIdentity")
+	defer end()
+
+	filter := bson.M{
+		"_id": sr.mongo.Doc("json/identities"),
+	}
+
+	body := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("identities.%s", identityKey(identity.Provider, identity.Subject)): identity,
+		},
+	}
+
+	_, err := sr.mongo.Conn.UpdateOne(ctx, filter, body)
+	if err != nil {
+		sr.logger.WithContext(ctx).Warnf("[InsertIdentity] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
+
+func (sr *SsoRepository) RemoveIdentitiesByLogin(ctx context.Context, login string) error {
+	ctx, end := sr.mongo.Call(ctx, "sso", "RemoveIdentitiesByLogin")
+	defer end()
+
+	doc := &model.BsonIdentities{}
+	err := sr.mongo.Conn.FindOne(ctx, bson.M{"_id": sr.mongo.Doc("json/identities")}).Decode(doc)
+	if err != nil {
+		sr.logger.WithContext(ctx).Warnf("[RemoveIdentitiesByLogin] FindOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+
+	unset := bson.M{}
+	for key, identity := range doc.Identities {
+		if identity.Login == login {
+			unset[fmt.Sprintf("identities.%s", key)] = ""
+		}
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+
+	_, err = sr.mongo.Conn.UpdateOne(ctx, bson.M{"_id": sr.mongo.Doc("json/identities")}, bson.M{"$unset": unset})
+	if err != nil {
+		sr.logger.WithContext(ctx).Warnf("[RemoveIdentitiesByLogin] UpdateOne: %s", err.Error())
+		return db.StorageError(ctx, err)
+	}
+	return nil
+}
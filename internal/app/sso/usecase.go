@@ -0,0 +1,13 @@
+package sso
+
+import (
+	"context"
+	"nocalendar/internal/model"
+)
+
+type SsoUsecase interface {
+	GetProviders() *model.JsonOidcProviders
+	Login(ctx context.Context, provider string) (string, error)
+	Callback(ctx context.Context, provider, state, code, device string) (*model.User, *model.Tokens, error)
+	RemoveIdentities(ctx context.Context, login string) error
+}
@@ -0,0 +1,343 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/sso"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"nocalendar/internal/util"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// oidcClient is discovered lazily, so unavailable provider does not prevent server start
+type oidcClient struct {
+	config   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+type SsoUsecase struct {
+	orgId       string // prefix of state, callback of provider finds organization by it
+	repo        sso.SsoRepository
+	authRepo    auth.AuthRepository
+	authUsecase auth.AuthUsecase
+	providers   map[string]*model.OidcProvider
+	httpClient  *http.Client
+	logger      *logrus.Logger
+
+	mu      sync.Mutex
+	clients map[string]*oidcClient
+}
+
+func NewSsoUsecase(orgId string, repo sso.SsoRepository, authRepo auth.AuthRepository, authUsecase auth.AuthUsecase,
+	providers []*model.OidcProvider, logger *logrus.Logger) sso.SsoUsecase {
+	byName := make(map[string]*model.OidcProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name] = provider
+	}
+	return &SsoUsecase{
+		orgId:       orgId,
+		repo:        repo,
+		authRepo:    authRepo,
+		authUsecase: authUsecase,
+		providers:   byName,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		logger:      logger,
+		clients:     make(map[string]*oidcClient),
+	}
+}
+
+// LoadProviders reads json array of providers from file, empty path means that sso is disabled
+func LoadProviders(path string) ([]*model.OidcProvider, error) {
+	providers := make([]*model.OidcProvider, 0)
+	if path == "" {
+		return providers, nil
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, &providers)
+	if err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// clientContext makes requests to providers go through http client of usecase
+func (su *SsoUsecase) clientContext(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, su.httpClient)
+}
+
+func (su *SsoUsecase) client(name string) (*oidcClient, error) {
+	provider, ok := su.providers[name]
+	if !ok {
+		return nil, errors.ProviderNotFound
+	}
+
+	su.mu.Lock()
+	defer su.mu.Unlock()
+	if client, ok := su.clients[name]; ok {
+		return client, nil
+	}
+
+	// keys of provider are fetched with this context later, so it must not end with request
+	discovered, err := oidc.NewProvider(su.clientContext(context.Background()), provider.Issuer)
+	if err != nil {
+		su.logger.Warnf("[client] discovery of %s failed: %s", name, err.Error())
+		return nil, errors.InternalError
+	}
+
+	scopes := append([]string{oidc.ScopeOpenID}, provider.Scopes...)
+	client := &oidcClient{
+		config: &oauth2.Config{
+			ClientID:     provider.ClientId,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectUrl,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: discovered.Verifier(&oidc.Config{ClientID: provider.ClientId}),
+	}
+	su.clients[name] = client
+	return client, nil
+}
+
+func (su *SsoUsecase) GetProviders() *model.JsonOidcProviders {
+	answer := &model.JsonOidcProviders{Providers: make([]string, 0, len(su.providers))}
+	for name := range su.providers {
+		answer.Providers = append(answer.Providers, name)
+	}
+	sort.Strings(answer.Providers)
+	return answer
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Login returns url of provider where user should be redirected
+func (su *SsoUsecase) Login(ctx context.Context, provider string) (string, error) {
+	ctx, span := tracing.Start(ctx, "sso.Login")
+	defer span.End()
+
+	client, err := su.client(provider)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	err = su.repo.RemoveStatesBefore(ctx, now-model.OIDC_STATE_TTL)
+	if err != nil {
+		su.logger.WithContext(ctx).Warnf("[Login] expired states not removed: %s", err.Error())
+	}
+
+	state := util.GenerateSecureString(model.LENGTH_OF_OIDC_STATE)
+	oidcState := &model.OidcState{
+		Provider:  provider,
+		Nonce:     util.GenerateSecureString(model.LENGTH_OF_OIDC_STATE),
+		Verifier:  util.GenerateSecureString(model.LENGTH_OF_OIDC_VERIFIER),
+		CreatedAt: now,
+	}
+	err = su.repo.InsertState(ctx, state, oidcState)
+	if err != nil {
+		return "", err
+	}
+
+	return client.config.AuthCodeURL(model.OrgState(su.orgId, state),
+		oidc.Nonce(oidcState.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(oidcState.Verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Callback exchanges code for ID token and starts session of linked, found by email or new user
+func (su *SsoUsecase) Callback(ctx context.Context, provider, state, code, device string) (*model.User, *model.Tokens, error) {
+	ctx, span := tracing.Start(ctx, "sso.Callback")
+	defer span.End()
+
+	client, err := su.client(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orgId, state := model.SplitOrgState(state)
+	if orgId != su.orgId {
+		return nil, nil, errors.BadOidcState
+	}
+
+	oidcState, err := su.repo.PopState(ctx, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if oidcState.Provider != provider || time.Now().Unix()-oidcState.CreatedAt > model.OIDC_STATE_TTL {
+		return nil, nil, errors.BadOidcState
+	}
+
+	ctx = su.clientContext(ctx)
+	token, err := client.config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", oidcState.Verifier))
+	if err != nil {
+		su.logger.WithContext(ctx).Warnf("[Callback] exchange with %s failed: %s", provider, err.Error())
+		return nil, nil, errors.OidcRejected
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		su.logger.WithContext(ctx).Warnf("[Callback] %s returned no id token", provider)
+		return nil, nil, errors.OidcRejected
+	}
+
+	idToken, err := client.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		su.logger.WithContext(ctx).Warnf("[Callback] id token of %s not verified: %s", provider, err.Error())
+		return nil, nil, errors.OidcRejected
+	}
+	if idToken.Nonce != oidcState.Nonce {
+		su.logger.WithContext(ctx).Warnf("[Callback] nonce mismatch for %s", provider)
+		return nil, nil, errors.OidcRejected
+	}
+
+	claims := &model.OidcClaims{}
+	err = idToken.Claims(claims)
+	if err != nil || claims.Subject == "" {
+		return nil, nil, errors.OidcRejected
+	}
+
+	usr, err := su.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := su.authUsecase.CreateSession(ctx, usr.Login, device)
+	if err != nil {
+		return nil, nil, err
+	}
+	return usr, tokens, nil
+}
+
+func (su *SsoUsecase) resolveUser(ctx context.Context, provider string, claims *model.OidcClaims) (*model.User, error) {
+	identity, err := su.repo.GetIdentity(ctx, provider, claims.Subject)
+	switch err {
+	case nil:
+		return su.authRepo.GetUser(ctx, identity.Login)
+	case errors.UserNotFound:
+		break
+	default:
+		return nil, err
+	}
+
+	var usr *model.User
+	if claims.Email != "" && claims.EmailVerified {
+		usr, err = su.authRepo.GetUserByEmail(ctx, claims.Email)
+		if err != nil && err != errors.UserNotFound {
+			return nil, err
+		}
+
+		// somebody could register with foreign email, such account must not be taken over
+		if usr != nil && !usr.EmailVerified {
+			usr = nil
+		}
+	}
+
+	if usr == nil {
+		usr, err = su.provisionUser(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = su.repo.InsertIdentity(ctx, &model.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Login:    usr.Login,
+		LinkedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+// sanitizeLogin keeps symbols which are safe in logins, they are used as keys of documents
+func sanitizeLogin(raw string) string {
+	login := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, raw)
+	if login == "" {
+		return "user"
+	}
+	return login
+}
+
+// provisionUser creates user without password, so it can log in only through provider
+func (su *SsoUsecase) provisionUser(ctx context.Context, claims *model.OidcClaims) (*model.User, error) {
+	if claims.Email != "" {
+		_, err := su.authRepo.GetUserByEmail(ctx, claims.Email)
+		switch err {
+		case nil:
+			// email is not verified by provider or by user, so account cannot be linked
+			return nil, errors.EmailAlreadyExists
+		case errors.UserNotFound:
+			break
+		default:
+			return nil, err
+		}
+	}
+
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = sanitizeLogin(base)
+
+	login := base
+	for i := 0; ; i++ {
+		_, err := su.authRepo.GetUser(ctx, login)
+		if err == errors.UserNotFound {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == 5 {
+			return nil, errors.LoginAlreadyExists
+		}
+		login = base + "_" + strings.ToLower(util.GenerateSecureString(4))
+	}
+
+	return su.authRepo.Insert(ctx, &model.User{
+		Login:   login,
+		Name:    claims.GivenName,
+		Surname: claims.FamilyName,
+		Email:   claims.Email,
+
+		EmailVerified: claims.EmailVerified,
+	})
+}
+
+func (su *SsoUsecase) RemoveIdentities(ctx context.Context, login string) error {
+	ctx, span := tracing.Start(ctx, "sso.RemoveIdentities")
+	defer span.End()
+
+	return su.repo.RemoveIdentitiesByLogin(ctx, login)
+}
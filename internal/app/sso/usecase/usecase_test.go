@@ -0,0 +1,470 @@
+package usecase
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TEST_CLIENT_ID     = "nocalendar"
+	TEST_CLIENT_SECRET = "client secret"
+	TEST_REDIRECT_URL  = "https://calendar.example.com/api/oidc/mock/callback"
+)
+
+// grant is what issuer remembers about authorization code
+type grant struct {
+	challenge string
+	nonce     string
+	claims    map[string]interface{}
+}
+
+// mockIssuer is OpenID provider with discovery, keys and token endpoints. Authorization
+// endpoint is not served, tests issue codes themselves as if user logged in at provider
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	grants    map[string]*grant
+	verifiers []string // code verifiers received by token endpoint
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err.Error())
+	}
+	mi := &mockIssuer{key: key, grants: make(map[string]*grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", mi.discovery)
+	mux.HandleFunc("/keys", mi.keys)
+	mux.HandleFunc("/token", mi.token)
+	mi.Server = httptest.NewServer(mux)
+	t.Cleanup(mi.Close)
+	return mi
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (mi *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                mi.URL,
+		"authorization_endpoint":                mi.URL + "/authorize",
+		"token_endpoint":                        mi.URL + "/token",
+		"jwks_uri":                              mi.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func encodeSegment(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (mi *mockIssuer) keys(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   encodeSegment(mi.key.N.Bytes()),
+			"e":   encodeSegment(big.NewInt(int64(mi.key.E)).Bytes()),
+		}},
+	})
+}
+
+// idToken signs claims of grant for the client
+func (mi *mockIssuer) idToken(g *grant) (string, error) {
+	claims := map[string]interface{}{
+		"iss":   mi.URL,
+		"aud":   TEST_CLIENT_ID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	for name, value := range g.claims {
+		claims[name] = value
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, mi.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encodeSegment(signature), nil
+}
+
+// token exchanges code once, verifier must match challenge sent with authorization request
+func (mi *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != TEST_CLIENT_ID || secret != TEST_CLIENT_SECRET {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	verifier := r.PostForm.Get("code_verifier")
+	mi.mu.Lock()
+	g, ok := mi.grants[r.PostForm.Get("code")]
+	delete(mi.grants, r.PostForm.Get("code"))
+	mi.verifiers = append(mi.verifiers, verifier)
+	mi.mu.Unlock()
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != TEST_REDIRECT_URL {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if codeChallenge(verifier) != g.challenge {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	idToken, err := mi.idToken(g)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// authorize plays user who logged in at provider: it checks authorization request
+// and returns code and state which provider would send to callback
+func (mi *mockIssuer) authorize(t *testing.T, authUrl string, claims map[string]interface{}) (string, string) {
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("cannot parse authorization url %s: %s", authUrl, err.Error())
+	}
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("client_id") != TEST_CLIENT_ID || query.Get("redirect_uri") != TEST_REDIRECT_URL {
+		t.Fatalf("authorization url %s is not for mock client", authUrl)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization url %s has no PKCE challenge", authUrl)
+	}
+	if query.Get("nonce") == "" || query.Get("state") == "" {
+		t.Fatalf("authorization url %s has no nonce or state", authUrl)
+	}
+
+	code := "code-" + query.Get("state")
+	mi.mu.Lock()
+	mi.grants[code] = &grant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	mi.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (mi *mockIssuer) receivedVerifiers() []string {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	return append([]string{}, mi.verifiers...)
+}
+
+// fakeSso keeps states and identities in memory
+type fakeSso struct {
+	states     map[string]*model.OidcState
+	identities map[string]*model.Identity
+}
+
+func (fs *fakeSso) InsertState(ctx context.Context, state string, oidcState *model.OidcState) error {
+	fs.states[state] = oidcState
+	return nil
+}
+
+func (fs *fakeSso) PopState(ctx context.Context, state string) (*model.OidcState, error) {
+	oidcState, ok := fs.states[state]
+	if !ok {
+		return nil, errors.BadOidcState
+	}
+	delete(fs.states, state)
+	return oidcState, nil
+}
+
+func (fs *fakeSso) RemoveStatesBefore(ctx context.Context, timestamp int64) error {
+	return nil
+}
+
+func (fs *fakeSso) GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error) {
+	identity, ok := fs.identities[provider+"/"+subject]
+	if !ok {
+		return nil, errors.UserNotFound
+	}
+	return identity, nil
+}
+
+func (fs *fakeSso) InsertIdentity(ctx context.Context, identity *model.Identity) error {
+	fs.identities[identity.Provider+"/"+identity.Subject] = identity
+	return nil
+}
+
+func (fs *fakeSso) RemoveIdentitiesByLogin(ctx context.Context, login string) error {
+	return nil
+}
+
+type fakeUsers struct {
+	auth.AuthRepository
+	users map[string]*model.User
+}
+
+func (fu *fakeUsers) GetUser(ctx context.Context, login string) (*model.User, error) {
+	usr, ok := fu.users[login]
+	if !ok {
+		return nil, errors.UserNotFound
+	}
+	return usr, nil
+}
+
+func (fu *fakeUsers) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, usr := range fu.users {
+		if usr.Email == email {
+			return usr, nil
+		}
+	}
+	return nil, errors.UserNotFound
+}
+
+func (fu *fakeUsers) Insert(ctx context.Context, usr *model.User) (*model.User, error) {
+	fu.users[usr.Login] = usr
+	return usr, nil
+}
+
+type fakeSessions struct {
+	auth.AuthUsecase
+}
+
+func (fs *fakeSessions) CreateSession(ctx context.Context, login, device string) (*model.Tokens, error) {
+	return &model.Tokens{AccessToken: "access of " + login, RefreshToken: "refresh of " + login}, nil
+}
+
+type testSso struct {
+	*SsoUsecase
+	issuer *mockIssuer
+	repo   *fakeSso
+	users  *fakeUsers
+}
+
+func newTestSso(t *testing.T) *testSso {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	issuer := newMockIssuer(t)
+	repo := &fakeSso{states: make(map[string]*model.OidcState), identities: make(map[string]*model.Identity)}
+	users := &fakeUsers{users: map[string]*model.User{
+		"alice":   {Login: "alice", Email: "alice@example.com", EmailVerified: true},
+		"mallory": {Login: "mallory", Email: "victim@example.com"},
+	}}
+	provider := &model.OidcProvider{
+		Name:         "mock",
+		Issuer:       issuer.URL,
+		ClientId:     TEST_CLIENT_ID,
+		ClientSecret: TEST_CLIENT_SECRET,
+		RedirectUrl:  TEST_REDIRECT_URL,
+	}
+	su := NewSsoUsecase("acme", repo, users, &fakeSessions{}, []*model.OidcProvider{provider}, logger).(*SsoUsecase)
+	return &testSso{SsoUsecase: su, issuer: issuer, repo: repo, users: users}
+}
+
+// login goes through provider and returns code and state for callback
+func (ts *testSso) login(t *testing.T, claims map[string]interface{}) (string, string) {
+	authUrl, err := ts.Login(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Login: %s", err.Error())
+	}
+	return ts.issuer.authorize(t, authUrl, claims)
+}
+
+func subject(sub string) map[string]interface{} {
+	return map[string]interface{}{"sub": sub}
+}
+
+func TestCallbackSendsVerifierOfState(t *testing.T) {
+	ts := newTestSso(t)
+	code, state := ts.login(t, subject("linked"))
+	ts.repo.identities["mock/linked"] = &model.Identity{Provider: "mock", Subject: "linked", Login: "alice"}
+	_, stored := model.SplitOrgState(state)
+	verifier := ts.repo.states[stored].Verifier
+
+	usr, tokens, err := ts.Callback(context.Background(), "mock", state, code, "test")
+	if err != nil {
+		t.Fatalf("Callback: %s", err.Error())
+	}
+	if usr.Login != "alice" || tokens.AccessToken != "access of alice" {
+		t.Errorf("Callback = %+v, %+v, want session of alice", usr, tokens)
+	}
+	if verifiers := ts.issuer.receivedVerifiers(); len(verifiers) != 1 || verifiers[0] != verifier {
+		t.Errorf("verifiers sent to provider = %v, want %s", verifiers, verifier)
+	}
+	if len(verifier) != model.LENGTH_OF_OIDC_VERIFIER {
+		t.Errorf("verifier length = %d, want %d", len(verifier), model.LENGTH_OF_OIDC_VERIFIER)
+	}
+}
+
+func TestCallbackRejectsWrongVerifier(t *testing.T) {
+	ts := newTestSso(t)
+	code, state := ts.login(t, subject("linked"))
+	// verifier of other login attempt does not match challenge sent to provider
+	_, stored := model.SplitOrgState(state)
+	ts.repo.states[stored].Verifier = "verifier of other login attempt"
+
+	if _, _, err := ts.Callback(context.Background(), "mock", state, code, "test"); err != errors.OidcRejected {
+		t.Errorf("Callback = %v, want %v", err, errors.OidcRejected)
+	}
+}
+
+func TestCallbackRejectsBadState(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(ts *testSso, state string) (string, string)
+	}{
+		{"unknown state", func(ts *testSso, state string) (string, string) {
+			return "mock", model.OrgState("acme", "unknown")
+		}},
+		{"state of other org", func(ts *testSso, state string) (string, string) {
+			_, stored := model.SplitOrgState(state)
+			return "mock", model.OrgState("globex", stored)
+		}},
+		{"state without org", func(ts *testSso, state string) (string, string) {
+			_, stored := model.SplitOrgState(state)
+			return "mock", stored
+		}},
+		{"expired state", func(ts *testSso, state string) (string, string) {
+			_, stored := model.SplitOrgState(state)
+			ts.repo.states[stored].CreatedAt -= model.OIDC_STATE_TTL + 1
+			return "mock", state
+		}},
+		{"state of other provider", func(ts *testSso, state string) (string, string) {
+			_, stored := model.SplitOrgState(state)
+			ts.repo.states[stored].Provider = "other"
+			return "mock", state
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestSso(t)
+			code, state := ts.login(t, subject("linked"))
+			ts.repo.identities["mock/linked"] = &model.Identity{Provider: "mock", Subject: "linked", Login: "alice"}
+
+			provider, state := tt.modify(ts, state)
+			if _, _, err := ts.Callback(context.Background(), provider, state, code, "test"); err != errors.BadOidcState {
+				t.Errorf("Callback = %v, want %v", err, errors.BadOidcState)
+			}
+			if len(ts.issuer.receivedVerifiers()) != 0 {
+				t.Errorf("code is exchanged with bad state")
+			}
+		})
+	}
+}
+
+func TestCallbackRejectsReusedState(t *testing.T) {
+	ts := newTestSso(t)
+	code, state := ts.login(t, subject("linked"))
+	ts.repo.identities["mock/linked"] = &model.Identity{Provider: "mock", Subject: "linked", Login: "alice"}
+
+	if _, _, err := ts.Callback(context.Background(), "mock", state, code, "test"); err != nil {
+		t.Fatalf("Callback: %s", err.Error())
+	}
+	if _, _, err := ts.Callback(context.Background(), "mock", state, code, "test"); err != errors.BadOidcState {
+		t.Errorf("second Callback = %v, want %v", err, errors.BadOidcState)
+	}
+}
+
+func TestCallbackRejectsNonceMismatch(t *testing.T) {
+	ts := newTestSso(t)
+	code, state := ts.login(t, subject("linked"))
+	ts.repo.identities["mock/linked"] = &model.Identity{Provider: "mock", Subject: "linked", Login: "alice"}
+	// provider returns token issued for other authorization request
+	ts.issuer.mu.Lock()
+	ts.issuer.grants[code].nonce = "nonce of other request"
+	ts.issuer.mu.Unlock()
+
+	if _, _, err := ts.Callback(context.Background(), "mock", state, code, "test"); err != errors.OidcRejected {
+		t.Errorf("Callback = %v, want %v", err, errors.OidcRejected)
+	}
+}
+
+func TestCallbackLinksAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		login  string
+		err    error
+	}{
+		{"already linked", map[string]interface{}{"sub": "linked", "email": "other@example.com", "email_verified": true}, "alice", nil},
+		{"existing verified email", map[string]interface{}{"sub": "new", "email": "alice@example.com", "email_verified": true}, "alice", nil},
+		{"email not verified by provider", map[string]interface{}{"sub": "new", "email": "alice@example.com"}, "", errors.EmailAlreadyExists},
+		{"email not verified by user", map[string]interface{}{"sub": "new", "email": "victim@example.com", "email_verified": true}, "", errors.EmailAlreadyExists},
+		{"new user", map[string]interface{}{"sub": "new", "email": "bob@example.com", "email_verified": true, "preferred_username": "bob.smith"}, "bob_smith", nil},
+		{"new user without name", map[string]interface{}{"sub": "new", "email": "carol@example.com", "email_verified": true}, "carol", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestSso(t)
+			ts.repo.identities["mock/linked"] = &model.Identity{Provider: "mock", Subject: "linked", Login: "alice"}
+			users := len(ts.users.users)
+			code, state := ts.login(t, tt.claims)
+
+			usr, tokens, err := ts.Callback(context.Background(), "mock", state, code, "test")
+			if err != tt.err {
+				t.Fatalf("Callback = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				if _, ok := ts.repo.identities["mock/new"]; ok || len(ts.users.users) != users {
+					t.Errorf("account is linked or created after error")
+				}
+				return
+			}
+
+			if usr.Login != tt.login || tokens.AccessToken != "access of "+tt.login {
+				t.Errorf("Callback = %+v, %+v, want session of %s", usr, tokens, tt.login)
+			}
+			identity, ok := ts.repo.identities["mock/"+tt.claims["sub"].(string)]
+			if !ok || identity.Login != tt.login {
+				t.Errorf("identity = %+v, want link to %s", identity, tt.login)
+			}
+			if _, ok := ts.users.users[tt.login]; !ok {
+				t.Errorf("user %s is not stored", tt.login)
+			}
+		})
+	}
+}
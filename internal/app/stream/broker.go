@@ -0,0 +1,12 @@
+package stream
+
+import "nocalendar/internal/model"
+
+// Broker delivers notifications to every subscribed session of a user.
+// Local implementation lives in process, but any message broker may be used instead.
+type Broker interface {
+	Publish(logins []string, notification *model.Notification)
+	Subscribe(login string) (<-chan *model.Notification, func())
+	// Close ends all subscriptions, so open streams are finished on shutdown
+	Close()
+}
@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"nocalendar/internal/app/stream"
+	"nocalendar/internal/model"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const SUBSCRIBER_BUFFER_SIZE = 16
+
+type subscriber struct {
+	ch chan *model.Notification
+}
+
+type LocalBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*subscriber]struct{}
+	closed      bool
+	logger      *logrus.Logger
+}
+
+func NewLocalBroker(logger *logrus.Logger) stream.Broker {
+	return &LocalBroker{
+		subscribers: make(map[string]map[*subscriber]struct{}),
+		logger:      logger,
+	}
+}
+
+func (lb *LocalBroker) Publish(logins []string, notification *model.Notification) {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	for _, login := range logins {
+		for sub := range lb.subscribers[login] {
+			select {
+			case sub.ch <- notification:
+			default:
+				lb.logger.Warnf("[Publish] subscriber of %s is too slow, notification dropped", login)
+			}
+		}
+	}
+}
+
+func (lb *LocalBroker) Subscribe(login string) (<-chan *model.Notification, func()) {
+	sub := &subscriber{
+		ch: make(chan *model.Notification, SUBSCRIBER_BUFFER_SIZE),
+	}
+
+	lb.mu.Lock()
+	if lb.closed {
+		lb.mu.Unlock()
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	if _, ok := lb.subscribers[login]; !ok {
+		lb.subscribers[login] = make(map[*subscriber]struct{})
+	}
+	lb.subscribers[login][sub] = struct{}{}
+	lb.mu.Unlock()
+
+	// subscriber may be already removed by Close, its channel is closed then
+	unsubscribe := func() {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		if _, ok := lb.subscribers[login][sub]; !ok {
+			return
+		}
+		delete(lb.subscribers[login], sub)
+		if len(lb.subscribers[login]) == 0 {
+			delete(lb.subscribers, login)
+		}
+		close(sub.ch)
+	}
+	return sub.ch, unsubscribe
+}
+
+func (lb *LocalBroker) Close() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	for _, subs := range lb.subscribers {
+		for sub := range subs {
+			close(sub.ch)
+		}
+	}
+	lb.subscribers = make(map[string]map[*subscriber]struct{})
+	lb.closed = true
+}
@@ -0,0 +1,94 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/middleware"
+	"nocalendar/internal/app/stream"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/model"
+	"nocalendar/internal/server"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	HEARTBEAT_INTERVAL = 30 * time.Second
+	// time to write one message, stream as a whole is not limited by write timeout of server
+	STREAM_WRITE_TIMEOUT = 10 * time.Second
+)
+
+type StreamDelivery struct {
+	logger *logrus.Logger
+}
+
+func NewStreamDelivery(logger *logrus.Logger) *StreamDelivery {
+	return &StreamDelivery{
+		logger: logger,
+	}
+}
+
+func (sd *StreamDelivery) broker(r *http.Request) stream.Broker {
+	return tenant.FromContext(r.Context()).Broker
+}
+
+func (sd *StreamDelivery) Routing(r *mux.Router) {
+	st := r.PathPrefix("/stream").Subrouter()
+	am := middleware.NewAuthMiddleware(sd.logger)
+	st.Use(am.TokenChecking)
+
+	st.Handle("", am.RequireScope(model.SCOPE_EVENTS_READ, sd.Stream)).Methods(http.MethodGet, http.MethodOptions)
+}
+
+// Stream keeps connection open and pushes notifications as Server-Sent Events
+func (sd *StreamDelivery) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sd.logger.WithContext(r.Context()).Warnln("[Stream] response writer does not support flushing")
+		errors.Write(w, r, errors.InternalError)
+		return
+	}
+
+	usr := r.Context().Value(middleware.ContextUserKey).(*model.User)
+	notifications, unsubscribe := sd.broker(r).Subscribe(usr.Login)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(": connected\n\n"))
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+
+	for {
+		err := server.ExtendWriteDeadline(r, HEARTBEAT_INTERVAL+STREAM_WRITE_TIMEOUT)
+		if err != nil {
+			sd.logger.WithContext(r.Context()).Warnf("[Stream] cannot extend write deadline: %s", err.Error())
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			w.Write([]byte(": ping\n\n"))
+			flusher.Flush()
+		case notification, ok := <-notifications:
+			if !ok {
+				return
+			}
+			_, err := w.Write([]byte(fmt.Sprintf("event: %s\ndata: %s\n\n", notification.Type, model.ToBytes(notification))))
+			if err != nil {
+				sd.logger.WithContext(r.Context()).Warnf("[Stream] cannot write notification: %s", err.Error())
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package tenant_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nocalendar/internal/app/auth/delivery"
+	auth_repository "nocalendar/internal/app/auth/repository"
+	auth_usecase "nocalendar/internal/app/auth/usecase"
+	calendars_delivery "nocalendar/internal/app/calendars/delivery"
+	calendars_repository "nocalendar/internal/app/calendars/repository"
+	calendars_usecase "nocalendar/internal/app/calendars/usecase"
+	changes_repository "nocalendar/internal/app/changes/repository"
+	changes_usecase "nocalendar/internal/app/changes/usecase"
+	events_delivery "nocalendar/internal/app/events/delivery"
+	events_repository "nocalendar/internal/app/events/repository"
+	events_usecase "nocalendar/internal/app/events/usecase"
+	groups_repository "nocalendar/internal/app/groups/repository"
+	groups_usecase "nocalendar/internal/app/groups/usecase"
+	"nocalendar/internal/app/middleware"
+	orgs_repository "nocalendar/internal/app/orgs/repository"
+	"nocalendar/internal/app/stream"
+	"nocalendar/internal/app/stream/broker"
+	"nocalendar/internal/app/tenant"
+	"nocalendar/internal/config"
+	"nocalendar/internal/db"
+	"nocalendar/internal/db/dbtest"
+	"nocalendar/internal/mailer"
+	"nocalendar/internal/model"
+	"nocalendar/internal/ratelimit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newApi serves auth, calendars and events of organizations acme and globex
+func newApi(t *testing.T) http.Handler {
+	mongo := dbtest.NewDatabase(t)
+	logger := dbtest.Logger()
+	ctx := context.Background()
+
+	orgsRepo := orgs_repository.NewOrgsRepository(mongo, logger)
+	for _, id := range []string{"acme", "globex"} {
+		err := orgsRepo.InsertOrg(ctx, &model.Org{Id: id, Name: id, OpenRegistration: true})
+		if err != nil {
+			t.Fatalf("InsertOrg %s: %s", id, err.Error())
+		}
+	}
+
+	authCfg := config.AuthConfig{TokenSecret: "isolation test secret", BcryptCost: bcrypt.MinCost}
+	mail := mailer.NewMailer(config.SmtpConfig{}, logger)
+	build := func(org *model.Org, orgDb *db.Database, broker stream.Broker) *tenant.Services {
+		ar := auth_repository.NewAuthRepository(orgDb, logger)
+		cr := changes_repository.NewChangesRepository(orgDb, logger)
+		clr := calendars_repository.NewCalendarsRepository(orgDb, logger)
+		gr := groups_repository.NewGroupsRepository(orgDb, logger)
+		er := events_repository.NewEventsRepository(orgDb, logger)
+		eu := events_usecase.NewEventsUsecase(er, ar, clr, cr, gr, broker, logger)
+		return &tenant.Services{
+			Org:       org,
+			Auth:      auth_usecase.NewAuthUsecase(ar, org, authCfg, mail, logger),
+			Events:    eu,
+			Calendars: calendars_usecase.NewCalendarsUsecase(clr, ar, gr, logger),
+			Groups:    groups_usecase.NewGroupsUsecase(gr, ar, eu, logger),
+			Changes:   changes_usecase.NewChangesUsecase(cr, logger),
+			Broker:    broker,
+		}
+	}
+	newBroker := func() stream.Broker {
+		return broker.NewLocalBroker(logger)
+	}
+	tenants := tenant.NewRegistry(orgsRepo, mongo, build, newBroker, logger)
+	t.Cleanup(tenants.Close)
+
+	r := mux.NewRouter()
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(middleware.NewTenantMiddleware(tenants, logger).Tenant)
+	lockout := ratelimit.NewLockout(1000, time.Second, time.Second, time.Minute)
+	delivery.NewAuthDelivery(ratelimit.NewLoginGuard(lockout, lockout, ""), logger).Routing(api)
+	calendars_delivery.NewCalendarsDelivery(logger).Routing(api)
+	events_delivery.NewEventsDelivery(logger).Routing(api)
+	return r
+}
+
+func call(t *testing.T, api http.Handler, method, path, org, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set(model.ORG_HEADER, org)
+	if token != "" {
+		r.Header.Set("Authorize", token)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	return w
+}
+
+func register(t *testing.T, api http.Handler, org, login, email string) string {
+	body := `{"login": "` + login + `", "password": "long enough password", "email": "` + email +
+		`", "name": "Name", "surname": "Surname"}`
+	w := call(t, api, http.MethodPost, "/api/register", org, "", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register %s in %s = %d %s", login, org, w.Code, w.Body.String())
+	}
+	return w.Header().Get("Authorize")
+}
+
+func answerField(t *testing.T, w *httptest.ResponseRecorder, field string) string {
+	answer := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("cannot parse answer %s: %s", w.Body.String(), err.Error())
+	}
+	value, _ := answer[field].(string)
+	return value
+}
+
+func TestOrganizationsAreIsolated(t *testing.T) {
+	api := newApi(t)
+
+	// login and email are unique only inside organization
+	alice := register(t, api, "acme", "alice", "shared@example.com")
+	bob := register(t, api, "globex", "bob", "shared@example.com")
+	register(t, api, "globex", "alice", "alice@globex.example.com")
+
+	w := call(t, api, http.MethodPost, "/api/calendars", "acme", alice, `{"title": "work"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create calendar = %d %s", w.Code, w.Body.String())
+	}
+	calendarId := answerField(t, w, "calendar_id")
+
+	w = call(t, api, http.MethodPost, "/api/event", "acme", alice,
+		`{"title": "planning", "timestamp": 1700000000, "members": ["alice"], "calendar": "`+calendarId+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create event = %d %s", w.Code, w.Body.String())
+	}
+	eventId := answerField(t, w, "event_id")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"token of other org", http.MethodGet, "/api/event/one/" + eventId, alice, "", http.StatusUnauthorized},
+		{"read event", http.MethodGet, "/api/event/one/" + eventId, bob, "", http.StatusNotFound},
+		{"edit event", http.MethodPost, "/api/event/edit", bob,
+			`{"id": "` + eventId + `", "title": "hijacked", "timestamp": 1700000000}`, http.StatusNotFound},
+		{"accept event", http.MethodPost, "/api/event/accept/" + eventId, bob, "", http.StatusNotFound},
+		{"remove event", http.MethodDelete, "/api/event/remove/" + eventId, bob, "", http.StatusNotFound},
+		{"read calendar", http.MethodGet, "/api/calendars/one/" + calendarId, bob, "", http.StatusNotFound},
+		{"subscribe calendar", http.MethodPost, "/api/calendars/subscribe/" + calendarId, bob, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(t, api, tt.method, tt.path, "globex", tt.token, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status = %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+		})
+	}
+
+	// users of other organization cannot be invited
+	w = call(t, api, http.MethodPost, "/api/event", "acme", alice,
+		`{"title": "planning", "timestamp": 1700000000, "members": ["bob"]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invite user of other org = %d %s, want %d", w.Code, w.Body.String(), http.StatusUnprocessableEntity)
+	}
+
+	w = call(t, api, http.MethodGet, "/api/event/one/"+eventId, "acme", alice, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "planning") {
+		t.Errorf("event of acme after requests of globex = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,273 @@
+package tenant
+
+import (
+	"context"
+	"nocalendar/internal/app/admin"
+	"nocalendar/internal/app/auth"
+	"nocalendar/internal/app/calendars"
+	"nocalendar/internal/app/changes"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/app/events"
+	"nocalendar/internal/app/groups"
+	"nocalendar/internal/app/orgs"
+	"nocalendar/internal/app/profile"
+	"nocalendar/internal/app/sso"
+	"nocalendar/internal/app/stream"
+	"nocalendar/internal/db"
+	"nocalendar/internal/model"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// MISSING_ORG_TTL is how long unknown organization is answered without asking mongo.
+	// Organization created meanwhile becomes reachable after it
+	MISSING_ORG_TTL = 30 * time.Second
+	// MAX_MISSING_ORGS bounds memory spent on ids of unknown organizations, ids beyond it
+	// are not remembered
+	MAX_MISSING_ORGS = 10000
+)
+
+// Services are usecases of one organization. All their repositories are built over
+// database scoped to the organization, so they cannot reach data of other ones
+type Services struct {
+	Org       *model.Org
+	Auth      auth.AuthUsecase
+	Sso       sso.SsoUsecase
+	Events    events.EventsUsecase
+	Calendars calendars.CalendarsUsecase
+	Groups    groups.GroupsUsecase
+	Changes   changes.ChangesUsecase
+	Profile   profile.ProfileUsecase
+	Admin     admin.AdminUsecase
+	Broker    stream.Broker
+}
+
+// Builder wires services of org over its database and broker
+type Builder func(org *model.Org, mongo *db.Database, broker stream.Broker) *Services
+
+// Registry builds services of organization on first request and keeps them.
+// Brokers outlive services, so open streams survive rebuilding of services.
+// Organization id comes from unauthenticated request, so mongo is never asked under mu:
+// requests of one organization share a lookup and unknown ids are remembered for a while
+type Registry struct {
+	orgsRepo  orgs.OrgsRepository
+	mongo     *db.Database
+	build     Builder
+	newBroker func() stream.Broker
+	lookups   singleflight.Group
+	mu        sync.Mutex
+	services  map[string]*Services
+	brokers   map[string]stream.Broker
+	missing   map[string]time.Time // unknown organization id to time until it is not looked up
+	epochs    map[string]uint64    // organization id to number of Forget calls, services loaded before them are not kept
+	logger    *logrus.Logger
+}
+
+func NewRegistry(orgsRepo orgs.OrgsRepository, mongo *db.Database, build Builder, newBroker func() stream.Broker,
+	logger *logrus.Logger) *Registry {
+	return &Registry{
+		orgsRepo:  orgsRepo,
+		mongo:     mongo,
+		build:     build,
+		newBroker: newBroker,
+		services:  make(map[string]*Services),
+		brokers:   make(map[string]stream.Broker),
+		missing:   make(map[string]time.Time),
+		epochs:    make(map[string]uint64),
+		logger:    logger,
+	}
+}
+
+// Get returns services of organization, empty id means default organization
+func (tr *Registry) Get(ctx context.Context, orgId string) (*Services, error) {
+	if orgId == "" {
+		orgId = model.DEFAULT_ORG
+	}
+	if !model.IsValidOrgId(orgId) {
+		return nil, errors.OrgNotFound
+	}
+
+	services, known := tr.cached(orgId)
+	if services != nil {
+		return services, nil
+	}
+	if !known {
+		return nil, errors.OrgNotFound
+	}
+
+	// lookup is shared by all requests of organization, client of the first one
+	// must not cancel it for others
+	res, err, _ := tr.lookups.Do(orgId, func() (interface{}, error) {
+		return tr.load(detach(ctx), orgId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*Services), nil
+}
+
+// cached returns ready services of organization. Organization is not known if it was
+// not found recently
+func (tr *Registry) cached(orgId string) (*Services, bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if services, ok := tr.services[orgId]; ok {
+		return services, true
+	}
+	until, ok := tr.missing[orgId]
+	return nil, !ok || time.Now().After(until)
+}
+
+func (tr *Registry) load(ctx context.Context, orgId string) (*Services, error) {
+	// services could be built by lookup which finished right before this one started
+	if services, _ := tr.cached(orgId); services != nil {
+		return services, nil
+	}
+
+	tr.mu.Lock()
+	epoch := tr.epochs[orgId]
+	tr.mu.Unlock()
+
+	org, err := tr.orgsRepo.GetOrg(ctx, orgId)
+	if err == errors.OrgNotFound {
+		tr.rememberMissing(orgId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mongo := tr.mongo.ForOrg(org.Id)
+	err = mongo.InitDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if services, ok := tr.services[orgId]; ok {
+		return services, nil
+	}
+
+	broker, ok := tr.brokers[orgId]
+	if !ok {
+		broker = tr.newBroker()
+		tr.brokers[orgId] = broker
+	}
+
+	services := tr.build(org, mongo, broker)
+	// organization was changed while it was read, so next request loads it again
+	if tr.epochs[orgId] != epoch {
+		return services, nil
+	}
+	tr.services[orgId] = services
+	delete(tr.missing, orgId)
+	tr.logger.WithContext(ctx).Infof("[load] services of organization %s are ready", orgId)
+	return services, nil
+}
+
+func (tr *Registry) rememberMissing(orgId string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	now := time.Now()
+	if len(tr.missing) >= MAX_MISSING_ORGS {
+		for id, until := range tr.missing {
+			if now.After(until) {
+				delete(tr.missing, id)
+			}
+		}
+	}
+	if len(tr.missing) < MAX_MISSING_ORGS {
+		tr.missing[orgId] = now.Add(MISSING_ORG_TTL)
+	}
+}
+
+// Forget drops services of organization, so changed settings are applied on next request.
+// Organization which was not found is looked up again too
+func (tr *Registry) Forget(orgId string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.services, orgId)
+	delete(tr.missing, orgId)
+	tr.epochs[orgId]++
+}
+
+// UpdateSettings stores settings of organization and forgets its services, so requests
+// after it are served with new settings
+func (tr *Registry) UpdateSettings(ctx context.Context, orgId string, settings *model.OrgSettings) error {
+	err := tr.orgsRepo.UpdateSettings(ctx, orgId, settings)
+	if err != nil {
+		return err
+	}
+	tr.Forget(orgId)
+	return nil
+}
+
+// ActiveSessions counts sessions of every organization. Services of organizations which
+// were not requested yet are built for it
+func (tr *Registry) ActiveSessions(ctx context.Context) (map[string]int, error) {
+	orgs, err := tr.orgsRepo.GetOrgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(orgs))
+	for _, org := range orgs {
+		services, err := tr.Get(ctx, org.Id)
+		if err != nil {
+			return nil, err
+		}
+		counts[org.Id], err = services.Auth.CountActiveSessions(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// Close finishes brokers of all organizations, services are not usable after it
+func (tr *Registry) Close() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for _, broker := range tr.brokers {
+		broker.Close()
+	}
+}
+
+// detached keeps values of context, e.g. trace and request id for logs, but is never
+// canceled. Repository calls are still limited by query timeout
+type detached struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+type contextKey string
+
+const contextServicesKey contextKey = "tenant_services"
+
+func NewContext(ctx context.Context, services *Services) context.Context {
+	return context.WithValue(ctx, contextServicesKey, services)
+}
+
+// FromContext returns services of organization resolved by TenantMiddleware
+func FromContext(ctx context.Context) *Services {
+	return ctx.Value(contextServicesKey).(*Services)
+}
@@ -0,0 +1,256 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeOrgs knows no organizations but keeps updated settings. Lookups wait for release if it is set
+type fakeOrgs struct {
+	mu       sync.Mutex
+	calls    map[string]int
+	settings map[string]*model.OrgSettings
+	release  chan struct{}
+}
+
+func newFakeOrgs() *fakeOrgs {
+	return &fakeOrgs{calls: make(map[string]int), settings: make(map[string]*model.OrgSettings)}
+}
+
+func (fo *fakeOrgs) InsertOrg(ctx context.Context, org *model.Org) error {
+	return nil
+}
+
+func (fo *fakeOrgs) GetOrg(ctx context.Context, orgId string) (*model.Org, error) {
+	fo.mu.Lock()
+	fo.calls[orgId]++
+	release := fo.release
+	fo.mu.Unlock()
+
+	if release != nil {
+		<-release
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, errors.OrgNotFound
+}
+
+func (fo *fakeOrgs) GetOrgs(ctx context.Context) ([]*model.Org, error) {
+	return nil, nil
+}
+
+func (fo *fakeOrgs) UpdateSettings(ctx context.Context, orgId string, settings *model.OrgSettings) error {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	fo.settings[orgId] = settings
+	return nil
+}
+
+func (fo *fakeOrgs) callsOf(orgId string) int {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	return fo.calls[orgId]
+}
+
+func (fo *fakeOrgs) waitCalls(t *testing.T, orgId string, calls int) {
+	deadline := time.Now().Add(time.Second)
+	for fo.callsOf(orgId) < calls {
+		if time.Now().After(deadline) {
+			t.Fatalf("lookups of %s = %d, want %d", orgId, fo.callsOf(orgId), calls)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestRegistry(orgs *fakeOrgs) *Registry {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return NewRegistry(orgs, nil, nil, nil, logger)
+}
+
+func TestGetRejectsInvalidOrgWithoutLookup(t *testing.T) {
+	orgs := newFakeOrgs()
+	tr := newTestRegistry(orgs)
+
+	if _, err := tr.Get(context.Background(), "Not An Org!"); err != errors.OrgNotFound {
+		t.Fatalf("Get = %v, want %v", err, errors.OrgNotFound)
+	}
+	if calls := orgs.callsOf("Not An Org!"); calls != 0 {
+		t.Errorf("lookups = %d, want 0", calls)
+	}
+}
+
+func TestGetRemembersMissingOrg(t *testing.T) {
+	orgs := newFakeOrgs()
+	tr := newTestRegistry(orgs)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := tr.Get(ctx, "ghost"); err != errors.OrgNotFound {
+			t.Fatalf("Get = %v, want %v", err, errors.OrgNotFound)
+		}
+	}
+	if calls := orgs.callsOf("ghost"); calls != 1 {
+		t.Errorf("lookups = %d, want 1", calls)
+	}
+
+	// forgotten and expired organizations are looked up again
+	tr.Forget("ghost")
+	tr.Get(ctx, "ghost")
+	if calls := orgs.callsOf("ghost"); calls != 2 {
+		t.Errorf("lookups after Forget = %d, want 2", calls)
+	}
+
+	tr.mu.Lock()
+	tr.missing["ghost"] = time.Now().Add(-time.Second)
+	tr.mu.Unlock()
+	tr.Get(ctx, "ghost")
+	if calls := orgs.callsOf("ghost"); calls != 3 {
+		t.Errorf("lookups after expiration = %d, want 3", calls)
+	}
+}
+
+func TestGetBoundsMissingOrgs(t *testing.T) {
+	orgs := newFakeOrgs()
+	tr := newTestRegistry(orgs)
+	ctx := context.Background()
+
+	tr.mu.Lock()
+	for i := 0; i < MAX_MISSING_ORGS; i++ {
+		tr.missing[fmt.Sprintf("ghost-%d", i)] = time.Now().Add(time.Minute)
+	}
+	tr.mu.Unlock()
+
+	tr.Get(ctx, "overflow")
+	if len(tr.missing) != MAX_MISSING_ORGS {
+		t.Fatalf("remembered %d orgs, want %d", len(tr.missing), MAX_MISSING_ORGS)
+	}
+	if _, ok := tr.missing["overflow"]; ok {
+		t.Errorf("org beyond limit is remembered")
+	}
+
+	// expired ids make room for new ones
+	tr.mu.Lock()
+	tr.missing["ghost-0"] = time.Now().Add(-time.Second)
+	tr.mu.Unlock()
+	tr.Get(ctx, "overflow")
+	if _, ok := tr.missing["overflow"]; !ok {
+		t.Errorf("org is not remembered after expired ones are dropped")
+	}
+}
+
+func TestGetSharesLookupOfOrg(t *testing.T) {
+	orgs := newFakeOrgs()
+	orgs.release = make(chan struct{})
+	tr := newTestRegistry(orgs)
+
+	results := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := tr.Get(context.Background(), "ghost")
+			results <- err
+		}()
+	}
+	orgs.waitCalls(t, "ghost", 1)
+	time.Sleep(50 * time.Millisecond)
+	close(orgs.release)
+
+	for i := 0; i < 10; i++ {
+		if err := <-results; err != errors.OrgNotFound {
+			t.Errorf("Get = %v, want %v", err, errors.OrgNotFound)
+		}
+	}
+	if calls := orgs.callsOf("ghost"); calls != 1 {
+		t.Errorf("lookups = %d, want 1", calls)
+	}
+}
+
+func TestLookupDoesNotBlockOtherOrgs(t *testing.T) {
+	orgs := newFakeOrgs()
+	orgs.release = make(chan struct{})
+	defer close(orgs.release)
+	tr := newTestRegistry(orgs)
+	acme := &Services{Org: &model.Org{Id: "acme"}}
+	tr.services["acme"] = acme
+
+	go tr.Get(context.Background(), "ghost")
+	orgs.waitCalls(t, "ghost", 1)
+
+	done := make(chan *Services)
+	go func() {
+		services, _ := tr.Get(context.Background(), "acme")
+		done <- services
+	}()
+	select {
+	case services := <-done:
+		if services != acme {
+			t.Errorf("Get returned services of other org")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Get of ready org waits for lookup of other org")
+	}
+}
+
+func TestLookupIsNotCanceledByFirstRequest(t *testing.T) {
+	orgs := newFakeOrgs()
+	orgs.release = make(chan struct{})
+	tr := newTestRegistry(orgs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := tr.Get(ctx, "ghost")
+		first <- err
+	}()
+	orgs.waitCalls(t, "ghost", 1)
+
+	second := make(chan error)
+	go func() {
+		_, err := tr.Get(context.Background(), "ghost")
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	close(orgs.release)
+
+	if err := <-second; err != errors.OrgNotFound {
+		t.Errorf("Get of second request = %v, want %v", err, errors.OrgNotFound)
+	}
+	if err := <-first; err != errors.OrgNotFound {
+		t.Errorf("Get of canceled request = %v, want %v", err, errors.OrgNotFound)
+	}
+}
+
+func TestUpdateSettingsForgetsServices(t *testing.T) {
+	orgs := newFakeOrgs()
+	tr := newTestRegistry(orgs)
+	tr.services["acme"] = &Services{Org: &model.Org{Id: "acme"}}
+	tr.services["globex"] = &Services{Org: &model.Org{Id: "globex"}}
+
+	require := true
+	if err := tr.UpdateSettings(context.Background(), "acme", &model.OrgSettings{Require2fa: &require}); err != nil {
+		t.Fatalf("UpdateSettings: %s", err.Error())
+	}
+	if settings := orgs.settings["acme"]; settings == nil || settings.Require2fa == nil || !*settings.Require2fa {
+		t.Errorf("stored settings = %+v, want require_2fa", settings)
+	}
+
+	// services are rebuilt from stored organization on next request
+	if services, known := tr.cached("acme"); services != nil || !known {
+		t.Errorf("cached = %v, %t, want services forgotten", services, known)
+	}
+	if services, _ := tr.cached("globex"); services == nil {
+		t.Errorf("services of other org are forgotten")
+	}
+	if tr.epochs["acme"] != 1 {
+		t.Errorf("epoch = %d, want 1, services loaded before update must not be kept", tr.epochs["acme"])
+	}
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the whole configuration of service. Each option is taken from the first
+// source which sets it: command-line flag, env, config file, default value
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Mongo     MongoConfig     `yaml:"mongo"`
+	Log       LogConfig       `yaml:"log"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Smtp      SmtpConfig      `yaml:"smtp"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	ClientIpHeader    string        `yaml:"client_ip_header"` // header with address of client set by proxy
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"` // streams of notifications extend it by themselves
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"` // how long in-flight requests are drained
+}
+
+type MongoConfig struct {
+	Url            string        `yaml:"url"`
+	Database       string        `yaml:"database"`
+	Collection     string        `yaml:"collection"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"` // connecting and creating of documents on start
+	QueryTimeout   time.Duration `yaml:"query_timeout"`   // one call of repository
+}
+
+type LogConfig struct {
+	Level     string `yaml:"level"`
+	Format    string `yaml:"format"`     // text or json
+	AccessLog bool   `yaml:"access_log"` // line for every http request
+}
+
+type AuthConfig struct {
+	TokenSecret   string `yaml:"token_secret"`
+	BcryptCost    int    `yaml:"bcrypt_cost"`
+	Require2fa    bool   `yaml:"require_2fa"`    // for users of all organizations
+	AppUrl        string `yaml:"app_url"`        // web client which links in letters lead to
+	OidcProviders string `yaml:"oidc_providers"` // path to json file with providers
+}
+
+type RateLimitConfig struct {
+	Rps                   float64 `yaml:"rps"`
+	Burst                 int     `yaml:"burst"`
+	LoginMaxFailures      int     `yaml:"login_max_failures"`
+	LoginMaxFailuresPerIp int     `yaml:"login_max_failures_per_ip"`
+}
+
+// SmtpConfig without address makes mailer write letters to log
+type SmtpConfig struct {
+	Addr     string `yaml:"addr"`
+	From     string `yaml:"from"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+type MetricsConfig struct {
+	Enabled        bool   `yaml:"enabled"`         // serve /metrics
+	Token          string `yaml:"token"`           // bearer token which scrapers of /metrics send
+	PushgatewayUrl string `yaml:"pushgateway_url"` // where tools of cmd/regular push metrics of jobs
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`      // none, otlp, stdout or file
+	OtlpEndpoint string  `yaml:"otlp_endpoint"` // host:port of collector, OTEL_EXPORTER_OTLP_ENDPOINT is used without it
+	OtlpInsecure bool    `yaml:"otlp_insecure"` // plain http to collector
+	File         string  `yaml:"file"`          // where file exporter appends spans
+	SampleRatio  float64 `yaml:"sample_ratio"`  // share of traces started by service itself
+}
+
+const (
+	minBcryptCost = 4  // bcrypt.MinCost
+	maxBcryptCost = 31 // bcrypt.MaxCost
+)
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8000",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Mongo: MongoConfig{
+			ConnectTimeout: 10 * time.Second,
+			QueryTimeout:   5 * time.Second,
+		},
+		Log: LogConfig{
+			Level:     "info",
+			Format:    "text",
+			AccessLog: true,
+		},
+		Auth: AuthConfig{
+			BcryptCost: 10,
+		},
+		RateLimit: RateLimitConfig{
+			Rps:                   10,
+			Burst:                 40,
+			LoginMaxFailures:      5,
+			LoginMaxFailuresPerIp: 20,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Validate reports all incorrect options at once. Token secret is checked by server
+// itself, tools do not need it
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is empty")
+	check(c.Server.ReadHeaderTimeout >= 0, "server.read_header_timeout must not be negative")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Mongo.Url != "", "mongo.url is empty")
+	check(c.Mongo.Database != "", "mongo.database is empty")
+	check(c.Mongo.Collection != "", "mongo.collection is empty")
+	check(c.Mongo.ConnectTimeout > 0, "mongo.connect_timeout must be positive")
+	check(c.Mongo.QueryTimeout > 0, "mongo.query_timeout must be positive")
+	_, err := logrus.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level %q is unknown", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format %q is unknown", c.Log.Format)
+	check(c.Auth.BcryptCost >= minBcryptCost && c.Auth.BcryptCost <= maxBcryptCost,
+		"auth.bcrypt_cost must be between %d and %d", minBcryptCost, maxBcryptCost)
+	check(c.RateLimit.Rps > 0, "rate_limit.rps must be positive")
+	check(c.RateLimit.Burst > 0, "rate_limit.burst must be positive")
+	check(c.RateLimit.LoginMaxFailures > 0, "rate_limit.login_max_failures must be positive")
+	check(c.RateLimit.LoginMaxFailuresPerIp > 0, "rate_limit.login_max_failures_per_ip must be positive")
+	check(c.Smtp.Addr == "" || c.Smtp.From != "", "smtp.from is required with smtp.addr")
+	// metrics list organizations, so they are never served to everyone
+	check(!c.Metrics.Enabled || c.Metrics.Token != "", "metrics.token is required with metrics.enabled")
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout" || c.Tracing.Exporter == "file",
+		"tracing.exporter %q is unknown", c.Tracing.Exporter)
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "tracing.file is required with file exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("incorrect config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
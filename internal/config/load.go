@@ -0,0 +1,306 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CONFIG_ENV names env with path to config file, --config flag overrides it
+const CONFIG_ENV string = "NOCALENDAR_CONFIG"
+
+// option binds field of config to its flag and env
+type option struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func (c *Config) options() []option {
+	return []option{
+		{"addr", "LISTEN_ADDR", "address to listen on", &stringValue{&c.Server.Addr}},
+		{"client-ip-header", "CLIENT_IP_HEADER", "header with client address set by proxy", &stringValue{&c.Server.ClientIpHeader}},
+		{"read-header-timeout", "READ_HEADER_TIMEOUT", "time to read request headers, 0 disables it", &durationValue{&c.Server.ReadHeaderTimeout}},
+		{"read-timeout", "READ_TIMEOUT", "time to read whole request, 0 disables it", &durationValue{&c.Server.ReadTimeout}},
+		{"write-timeout", "WRITE_TIMEOUT", "time to write response, 0 disables it", &durationValue{&c.Server.WriteTimeout}},
+		{"idle-timeout", "IDLE_TIMEOUT", "time to keep idle connection, 0 disables it", &durationValue{&c.Server.IdleTimeout}},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time to drain in-flight requests on shutdown", &durationValue{&c.Server.ShutdownTimeout}},
+		{"mongo-url", "MONGO_URL", "mongo connection string", &stringValue{&c.Mongo.Url}},
+		{"mongo-db", "MONGO_DB", "mongo database", &stringValue{&c.Mongo.Database}},
+		{"mongo-collection", "MONGO_COLLECTION", "mongo collection", &stringValue{&c.Mongo.Collection}},
+		{"mongo-connect-timeout", "MONGO_CONNECT_TIMEOUT", "time to connect to mongo on start", &durationValue{&c.Mongo.ConnectTimeout}},
+		{"mongo-query-timeout", "MONGO_QUERY_TIMEOUT", "time of one call to mongo", &durationValue{&c.Mongo.QueryTimeout}},
+		{"log-level", "LOG_LEVEL", "one of trace, debug, info, warning, error", &stringValue{&c.Log.Level}},
+		{"log-format", "LOG_FORMAT", "text or json", &stringValue{&c.Log.Format}},
+		{"access-log", "ACCESS_LOG", "log every http request", &boolValue{&c.Log.AccessLog}},
+		{"token-secret", "TOKEN_SECRET", "secret for signing of tokens", &stringValue{&c.Auth.TokenSecret}},
+		{"bcrypt-cost", "BCRYPT_COST", "cost of password hashes", &intValue{&c.Auth.BcryptCost}},
+		{"require-2fa", "REQUIRE_2FA", "require second factor from users of all organizations", &boolValue{&c.Auth.Require2fa}},
+		{"app-url", "APP_URL", "url of web client for links in letters", &stringValue{&c.Auth.AppUrl}},
+		{"oidc-providers", "OIDC_PROVIDERS", "path to json file with oidc providers", &stringValue{&c.Auth.OidcProviders}},
+		{"rate-limit-rps", "RATE_LIMIT_RPS", "requests per second from one address", &floatValue{&c.RateLimit.Rps}},
+		{"rate-limit-burst", "RATE_LIMIT_BURST", "burst of requests from one address", &intValue{&c.RateLimit.Burst}},
+		{"login-max-failures", "LOGIN_MAX_FAILURES", "failed logins before lockout of login", &intValue{&c.RateLimit.LoginMaxFailures}},
+		{"login-max-failures-per-ip", "LOGIN_MAX_FAILURES_PER_IP", "failed logins before lockout of address", &intValue{&c.RateLimit.LoginMaxFailuresPerIp}},
+		{"smtp-addr", "SMTP_ADDR", "host:port of smtp server", &stringValue{&c.Smtp.Addr}},
+		{"smtp-from", "SMTP_FROM", "sender address", &stringValue{&c.Smtp.From}},
+		{"smtp-user", "SMTP_USER", "smtp login", &stringValue{&c.Smtp.User}},
+		{"smtp-password", "SMTP_PASSWORD", "smtp password", &stringValue{&c.Smtp.Password}},
+		{"metrics-enabled", "METRICS_ENABLED", "serve prometheus metrics on /metrics", &boolValue{&c.Metrics.Enabled}},
+		{"metrics-token", "METRICS_TOKEN", "bearer token required by /metrics", &stringValue{&c.Metrics.Token}},
+		{"pushgateway-url", "PUSHGATEWAY_URL", "pushgateway for metrics of regular jobs", &stringValue{&c.Metrics.PushgatewayUrl}},
+		{"tracing-exporter", "TRACING_EXPORTER", "one of none, otlp, stdout, file", &stringValue{&c.Tracing.Exporter}},
+		{"tracing-otlp-endpoint", "TRACING_OTLP_ENDPOINT", "host:port of otlp/http collector", &stringValue{&c.Tracing.OtlpEndpoint}},
+		{"tracing-otlp-insecure", "TRACING_OTLP_INSECURE", "send spans to collector over plain http", &boolValue{&c.Tracing.OtlpInsecure}},
+		{"tracing-file", "TRACING_FILE", "file for spans of file exporter", &stringValue{&c.Tracing.File}},
+		{"tracing-sample-ratio", "TRACING_SAMPLE_RATIO", "share of traces started by service", &floatValue{&c.Tracing.SampleRatio}},
+	}
+}
+
+// Load registers options in fs, parses args and builds config from defaults, file, env
+// and flags. Tools may register own flags in fs before
+func Load(fs *flag.FlagSet, args []string) (*Config, bool, error) {
+	cfg := Default()
+	options := cfg.options()
+
+	// flags are applied last, so first they are only collected
+	flagValues := make(map[string]*pendingValue, len(options))
+	for _, opt := range options {
+		pending := &pendingValue{target: opt.value}
+		flagValues[opt.flag] = pending
+		fs.Var(pending, opt.flag, fmt.Sprintf("%s (env %s)", opt.usage, opt.env))
+	}
+	path := fs.String("config", "", fmt.Sprintf("path to yaml config file (env %s)", CONFIG_ENV))
+	printConfig := fs.Bool("print-config", false, "print resulting config and exit")
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if *path == "" {
+		*path = os.Getenv(CONFIG_ENV)
+	}
+	if *path != "" {
+		buf, err := ioutil.ReadFile(*path)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot read config file: %s", err.Error())
+		}
+		// typos in keys would silently leave defaults
+		decoder := yaml.NewDecoder(bytes.NewReader(buf))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+		if err != nil && err != io.EOF {
+			return nil, false, fmt.Errorf("cannot parse config file %s: %s", *path, err.Error())
+		}
+	}
+
+	for _, opt := range options {
+		value, ok := os.LookupEnv(opt.env)
+		if !ok || value == "" {
+			continue
+		}
+		err = opt.value.Set(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("incorrect env %s: %s", opt.env, err.Error())
+		}
+	}
+
+	for _, opt := range options {
+		pending := flagValues[opt.flag]
+		if !pending.set {
+			continue
+		}
+		err = opt.value.Set(pending.raw)
+		if err != nil {
+			return nil, false, fmt.Errorf("incorrect flag -%s: %s", opt.flag, err.Error())
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, false, err
+	}
+	return cfg, *printConfig, nil
+}
+
+// MustLoad loads config from command line of process. It exits on incorrect config
+// and after printing config if --print-config is passed
+func MustLoad() *Config {
+	cfg, printConfig, err := Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	if printConfig {
+		fmt.Print(cfg.String())
+		os.Exit(0)
+	}
+	return cfg
+}
+
+// String returns config as yaml with secrets hidden
+func (c *Config) String() string {
+	hidden := *c
+	if hidden.Auth.TokenSecret != "" {
+		hidden.Auth.TokenSecret = "<hidden>"
+	}
+	if hidden.Smtp.Password != "" {
+		hidden.Smtp.Password = "<hidden>"
+	}
+	if hidden.Metrics.Token != "" {
+		hidden.Metrics.Token = "<hidden>"
+	}
+	hidden.Mongo.Url = hideUserinfo(hidden.Mongo.Url)
+	hidden.Metrics.PushgatewayUrl = hideUserinfo(hidden.Metrics.PushgatewayUrl)
+
+	buf, err := yaml.Marshal(&hidden)
+	if err != nil {
+		return err.Error()
+	}
+	return string(buf)
+}
+
+// hideUserinfo replaces credentials of url with ***. Mongo urls may list several hosts,
+// which net/url does not parse, so userinfo is cut by hand
+func hideUserinfo(rawUrl string) string {
+	start := strings.Index(rawUrl, "://")
+	if start < 0 {
+		return rawUrl
+	}
+	start += len("://")
+
+	end := len(rawUrl)
+	if i := strings.IndexAny(rawUrl[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	at := strings.LastIndex(rawUrl[start:end], "@")
+	if at < 0 {
+		return rawUrl
+	}
+	return rawUrl[:start] + "***" + rawUrl[start+at:]
+}
+
+type stringValue struct{ p *string }
+
+func (v *stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+func (v *stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+type intValue struct{ p *int }
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v.p = n
+	return nil
+}
+
+func (v *intValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+
+type floatValue struct{ p *float64 }
+
+func (v *floatValue) Set(s string) error {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v.p = n
+	return nil
+}
+
+func (v *floatValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v.p, 'g', -1, 64)
+}
+
+type durationValue struct{ p *time.Duration }
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v.p = d
+	return nil
+}
+
+func (v *durationValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+
+type boolValue struct{ p *bool }
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.p = b
+	return nil
+}
+
+func (v *boolValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+func (v *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+// pendingValue keeps raw value of flag until config file and env are applied
+type pendingValue struct {
+	target flag.Value
+	raw    string
+	set    bool
+}
+
+func (v *pendingValue) Set(s string) error {
+	v.raw = s
+	v.set = true
+	return nil
+}
+
+func (v *pendingValue) String() string {
+	if v.target == nil {
+		return ""
+	}
+	return v.target.String()
+}
+
+func (v *pendingValue) IsBoolFlag() bool {
+	b, ok := v.target.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,59 @@
+// Package dbtest gives tests over storage a database of their own
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"nocalendar/internal/config"
+	"nocalendar/internal/db"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MONGO_URL_ENV names mongo which tests over storage use. Without it such tests are skipped
+const MONGO_URL_ENV = "NOCALENDAR_TEST_MONGO_URL"
+
+// Logger discards everything, failures are reported by tests themselves
+func Logger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+// NewDatabase returns database of default organization over new collection, which is dropped
+// when test ends. Documents of other organizations are reached through ForOrg
+func NewDatabase(t testing.TB) *db.Database {
+	url := os.Getenv(MONGO_URL_ENV)
+	if url == "" {
+		t.Skipf("%s is not set", MONGO_URL_ENV)
+	}
+
+	cfg := config.MongoConfig{
+		Url:            url,
+		Database:       "nocalendar_test",
+		Collection:     fmt.Sprintf("test_%d", time.Now().UnixNano()),
+		ConnectTimeout: 10 * time.Second,
+		QueryTimeout:   5 * time.Second,
+	}
+	mongo := db.NewDatabase(cfg, Logger())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+		defer cancel()
+		mongo.Conn.Drop(ctx)
+		mongo.Close(ctx)
+	})
+	return mongo
+}
+
+// NewOrgDatabase returns database of org with created documents
+func NewOrgDatabase(t testing.TB, mongo *db.Database, org string) *db.Database {
+	orgDb := mongo.ForOrg(org)
+	if err := orgDb.InitDocuments(context.Background()); err != nil {
+		t.Fatalf("cannot init documents of %s: %s", org, err.Error())
+	}
+	return orgDb
+}
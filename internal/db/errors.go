@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	stderrors "errors"
+	"nocalendar/internal/app/errors"
+	"nocalendar/internal/metrics"
+	"nocalendar/internal/tracing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StorageError turns error of mongo into error of app. Timeouts and lost connection are
+// told apart from other failures, so clients get 504 and 503 instead of 500. The error
+// is counted in metrics and recorded in span of repository call of ctx
+func StorageError(ctx context.Context, err error) error {
+	var appErr *errors.Error
+	if stderrors.As(err, &appErr) {
+		return appErr
+	}
+
+	var selection topology.ServerSelectionError
+	var result *errors.Error
+	var kind string
+	switch {
+	case stderrors.Is(err, context.Canceled):
+		result, kind = errors.RequestCanceled, "canceled"
+	case stderrors.As(err, &selection):
+		result, kind = errors.StorageUnavailable, "unavailable"
+	case mongo.IsTimeout(err):
+		result, kind = errors.QueryTimeout, "timeout"
+	case mongo.IsNetworkError(err):
+		result, kind = errors.StorageUnavailable, "unavailable"
+	default:
+		result, kind = errors.InternalError, "internal"
+	}
+
+	if c, ok := ctx.Value(contextCallKey).(*call); ok {
+		metrics.RepositoryErrors.WithLabelValues(c.repository, c.method, kind).Inc()
+		tracing.Fail(trace.SpanFromContext(ctx), err)
+	}
+	return result
+}
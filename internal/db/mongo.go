@@ -2,23 +2,88 @@ package db
 
 import (
 	"context"
-	"nocalendar/internal/app/errors"
-	"os"
+	"fmt"
+	"nocalendar/internal/config"
+	"nocalendar/internal/metrics"
+	"nocalendar/internal/model"
+	"nocalendar/internal/tracing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Database struct {
-	Conn   *mongo.Collection
-	Ctx    context.Context
-	logger *logrus.Logger
+	Conn         *mongo.Collection
+	org          string // documents of other organizations are not reachable through this value
+	queryTimeout time.Duration
+	logger       *logrus.Logger
 }
 
-func (d *Database) find(body bson.M, opts *options.FindOneOptions) (bool, error) {
-	res := d.Conn.FindOne(d.Ctx, body, opts)
+// Doc returns _id of document in organization of database. Documents of default organization
+// keep their ids from times without organizations
+func (d *Database) Doc(name string) string {
+	if d.org == "" || d.org == model.DEFAULT_ORG {
+		return name
+	}
+	return fmt.Sprintf("org/%s/%s", d.org, name)
+}
+
+// ForOrg returns database sharing connection, which reads and writes only documents of org
+func (d *Database) ForOrg(org string) *Database {
+	return &Database{
+		Conn:         d.Conn,
+		org:          org,
+		queryTimeout: d.queryTimeout,
+		logger:       d.logger,
+	}
+}
+
+type contextKey string
+
+const contextCallKey contextKey = "repository_call"
+
+type call struct {
+	repository string
+	method     string
+}
+
+// Call starts call of repository: it is limited by query timeout, measured in metrics
+// and traced as span. Cancel of ctx, e.g. by disconnected client, cancels the call too.
+// Returned function must be called when the call ends
+func (d *Database) Call(ctx context.Context, repository, method string) (context.Context, func()) {
+	started := time.Now()
+	ctx, span := tracing.Start(ctx, "mongo "+repository+"."+method,
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.mongodb.collection", d.Conn.Name()),
+		attribute.String("db.operation", method),
+	)
+	ctx = context.WithValue(ctx, contextCallKey, &call{repository: repository, method: method})
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	return ctx, func() {
+		cancel()
+		span.End()
+		metrics.RepositoryDuration.WithLabelValues(repository, method).Observe(time.Since(started).Seconds())
+	}
+}
+
+// Ping checks that mongo is reachable, it is used by readiness probe
+func (d *Database) Ping(ctx context.Context) error {
+	return d.Conn.Database().Client().Ping(ctx, readpref.Primary())
+}
+
+// Close disconnects from mongo. Databases of all organizations share the connection,
+// so it is closed once on shutdown
+func (d *Database) Close(ctx context.Context) error {
+	return d.Conn.Database().Client().Disconnect(ctx)
+}
+
+func (d *Database) find(ctx context.Context, body bson.M, opts *options.FindOneOptions) (bool, error) {
+	res := d.Conn.FindOne(ctx, body, opts)
 	switch res.Err() {
 	case nil:
 		break
@@ -35,67 +100,99 @@ func (d *Database) find(body bson.M, opts *options.FindOneOptions) (bool, error)
 	return true, nil
 }
 
-func (d *Database) insert(body bson.M) error {
-	_, err := d.Conn.InsertOne(d.Ctx, body)
+func (d *Database) insert(ctx context.Context, body bson.M) error {
+	_, err := d.Conn.InsertOne(ctx, body)
 	return err
 }
 
-func (d *Database) initCollections() error {
+// initDocument inserts document if there is no document with the same _id yet
+func (d *Database) initDocument(ctx context.Context, doc bson.M) error {
 	opts := options.FindOne()
-	opts.SetProjection(bson.M{"users.nocalender_user_init.id": 1})
-	exist, err := d.find(bson.M{"_id": "json/users"}, opts)
+	opts.SetProjection(bson.M{"_id": 1})
+	exist, err := d.find(ctx, bson.M{"_id": doc["_id"]}, opts)
 	if err != nil {
-		d.logger.Warnf("[initCollections] find user: %s", err.Error())
-		return errors.InternalError
+		d.logger.WithContext(ctx).Warnf("[initDocument] find %s: %s", doc["_id"], err.Error())
+		return StorageError(ctx, err)
 	}
 
 	if !exist {
-		err = d.insert(bson.M{
-			"_id": "json/users",
-			"users": bson.M{
-				"nocalender_user_init": bson.M{
-					"id": 1,
-				},
-			},
-		})
+		err = d.insert(ctx, doc)
 		if err != nil {
-			d.logger.Warnf("[initCollections] insert user: %s", err.Error())
-			return errors.InternalError
+			d.logger.WithContext(ctx).Warnf("[initDocument] insert %s: %s", doc["_id"], err.Error())
+			return StorageError(ctx, err)
 		}
 	}
+	return nil
+}
+
+// initOrgs creates registry of organizations with default one. It does not belong to any organization
+func (d *Database) initOrgs(ctx context.Context) error {
+	return d.initDocument(ctx, bson.M{
+		"_id": "json/orgs",
+		"orgs": bson.M{
+			model.DEFAULT_ORG: bson.M{
+				"id":                model.DEFAULT_ORG,
+				"name":              model.DEFAULT_ORG,
+				"open_registration": true,
+				"created_at":        time.Now().Unix(),
+			},
+		},
+	})
+}
+
+// initIndexes creates indexes shared by all organizations. Changes of event feeds
+// are separate documents, they are read by feed and number
+func (d *Database) initIndexes(ctx context.Context) error {
+	_, err := d.Conn.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "feed", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		d.logger.WithContext(ctx).Warnf("[initIndexes] CreateOne: %s", err.Error())
+		return StorageError(ctx, err)
+	}
+	return nil
+}
 
-	opts = options.FindOne()
-	opts.SetProjection(bson.M{"tokens.nocalender_token_init": 1})
-	exist, err = d.find(bson.M{"_id": "json/tokens"}, opts)
+// InitDocuments creates documents of organization of database if they do not exist yet
+func (d *Database) InitDocuments(ctx context.Context) error {
+	ctx, end := d.Call(ctx, "db", "InitDocuments")
+	defer end()
+
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{"users.nocalender_user_init.id": 1})
+	exist, err := d.find(ctx, bson.M{"_id": d.Doc("json/users")}, opts)
 	if err != nil {
-		d.logger.Warnf("[initCollections] find token: %s", err.Error())
-		return errors.InternalError
+		d.logger.WithContext(ctx).Warnf("[InitDocuments] find user: %s", err.Error())
+		return StorageError(ctx, err)
 	}
 
 	if !exist {
-		err = d.insert(bson.M{
-			"_id": "json/tokens",
-			"tokens": bson.M{
-				"nocalender_token_init": 1,
+		err = d.insert(ctx, bson.M{
+			"_id": d.Doc("json/users"),
+			"users": bson.M{
+				"nocalender_user_init": bson.M{
+					"id": 1,
+				},
 			},
 		})
 		if err != nil {
-			d.logger.Warnf("[initCollections] insert token: %s", err.Error())
-			return errors.InternalError
+			d.logger.WithContext(ctx).Warnf("[InitDocuments] insert user: %s", err.Error())
+			return StorageError(ctx, err)
 		}
 	}
 
 	opts = options.FindOne()
 	opts.SetProjection(bson.M{"events.nocalender_event_init.id": 1})
-	exist, err = d.find(bson.M{"_id": "json/events"}, opts)
+	exist, err = d.find(ctx, bson.M{"_id": d.Doc("json/events")}, opts)
 	if err != nil {
-		d.logger.Warnf("[initCollections] find event: %s", err.Error())
-		return errors.InternalError
+		d.logger.WithContext(ctx).Warnf("[InitDocuments] find event: %s", err.Error())
+		return StorageError(ctx, err)
 	}
 
 	if !exist {
-		err = d.insert(bson.M{
-			"_id": "json/events",
+		err = d.insert(ctx, bson.M{
+			"_id": d.Doc("json/events"),
 			"regular": bson.M{
 				"nocalender_regular_event_init": bson.M{
 					"id": "1",
@@ -108,64 +205,112 @@ func (d *Database) initCollections() error {
 			},
 		})
 		if err != nil {
-			d.logger.Warnf("[initCollections] insert event: %s", err.Error())
-			return errors.InternalError
+			d.logger.WithContext(ctx).Warnf("[InitDocuments] insert event: %s", err.Error())
+			return StorageError(ctx, err)
 		}
 	}
 
 	opts = options.FindOne()
 	opts.SetProjection(bson.M{"members.nocalender_member_init": 1})
-	exist, err = d.find(bson.M{"_id": "json/members"}, opts)
+	exist, err = d.find(ctx, bson.M{"_id": d.Doc("json/members")}, opts)
 	if err != nil {
-		d.logger.Warnf("[initCollections] find member: %s", err.Error())
-		return errors.InternalError
+		d.logger.WithContext(ctx).Warnf("[InitDocuments] find member: %s", err.Error())
+		return StorageError(ctx, err)
 	}
 
 	if !exist {
-		err = d.insert(bson.M{
-			"_id": "json/members",
+		err = d.insert(ctx, bson.M{
+			"_id": d.Doc("json/members"),
 			"members": bson.M{
 				"nocalender_member_init": bson.A{"nocalender_regular_event_init"},
 			},
 		})
 		if err != nil {
-			d.logger.Warnf("[initCollections] insert member: %s", err.Error())
-			return errors.InternalError
+			d.logger.WithContext(ctx).Warnf("[InitDocuments] insert member: %s", err.Error())
+			return StorageError(ctx, err)
 		}
 	}
 
 	opts = options.FindOne()
 	opts.SetProjection(bson.M{"invites": 1})
-	exist, err = d.find(bson.M{"_id": "json/invites"}, opts)
+	exist, err = d.find(ctx, bson.M{"_id": d.Doc("json/invites")}, opts)
 	if err != nil {
-		d.logger.Warnf("[initCollections] find member: %s", err.Error())
-		return errors.InternalError
+		d.logger.WithContext(ctx).Warnf("[InitDocuments] find member: %s", err.Error())
+		return StorageError(ctx, err)
 	}
 
 	if !exist {
-		err = d.insert(bson.M{
-			"_id": "json/invites",
+		err = d.insert(ctx, bson.M{
+			"_id": d.Doc("json/invites"),
 			"invites": bson.M{
 				"nocalender_user_init": bson.A{"nocalender_single_event_init"},
 			},
 		})
 		if err != nil {
-			d.logger.Warnf("[initCollections] insert member: %s", err.Error())
-			return errors.InternalError
+			d.logger.WithContext(ctx).Warnf("[InitDocuments] insert member: %s", err.Error())
+			return StorageError(ctx, err)
+		}
+	}
+
+	documents := []bson.M{
+		{
+			"_id": d.Doc("json/changes"),
+			"seq": int64(0),
+		},
+		{
+			"_id":       d.Doc("json/calendars"),
+			"calendars": bson.M{},
+		},
+		{
+			"_id":             d.Doc("json/calendar_events"),
+			"calendar_events": bson.M{},
+		},
+		{
+			"_id":           d.Doc("json/subscriptions"),
+			"subscriptions": bson.M{},
+		},
+		{
+			"_id":      d.Doc("json/sessions"),
+			"sessions": bson.M{},
+		},
+		{
+			"_id":      d.Doc("json/api_keys"),
+			"api_keys": bson.M{},
+		},
+		{
+			"_id":         d.Doc("json/user_tokens"),
+			"user_tokens": bson.M{},
+		},
+		{
+			"_id":         d.Doc("json/oidc_states"),
+			"oidc_states": bson.M{},
+		},
+		{
+			"_id":        d.Doc("json/identities"),
+			"identities": bson.M{},
+		},
+		{
+			"_id":    d.Doc("json/groups"),
+			"groups": bson.M{},
+		},
+		{
+			"_id":          d.Doc("json/group_events"),
+			"group_events": bson.M{},
+		},
+	}
+	for _, doc := range documents {
+		err = d.initDocument(ctx, doc)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func NewDatabase(logger *logrus.Logger) *Database {
-	mongo_url := os.Getenv("MONGO_URL")
-	mongo_db := os.Getenv("MONGO_DB")
-	mongo_collection := os.Getenv("MONGO_COLLECTION")
-	if mongo_url == "" || mongo_db == "" || mongo_collection == "" {
-		logger.Fatalln("[NewDatabase] cannot get env MONGO_URL")
-	}
-	ctx := context.TODO()
-	clientOptions := options.Client().ApplyURI(mongo_url)
+func NewDatabase(cfg config.MongoConfig, logger *logrus.Logger) *Database {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	clientOptions := options.Client().ApplyURI(cfg.Url)
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		logger.Fatalf("[NewDatabase] cannot connect to mongo: %s", err.Error())
@@ -176,14 +321,20 @@ func NewDatabase(logger *logrus.Logger) *Database {
 		logger.Fatalf("[NewDatabase] cannot ping to mongo: %s", err.Error())
 	}
 
-	collection := client.Database(mongo_db).Collection(mongo_collection)
+	collection := client.Database(cfg.Database).Collection(cfg.Collection)
 	db := &Database{
-		Conn:   collection,
-		Ctx:    ctx,
-		logger: logger,
+		Conn:         collection,
+		queryTimeout: cfg.QueryTimeout,
+		logger:       logger,
 	}
 
-	err = db.initCollections()
+	err = db.initOrgs(ctx)
+	if err == nil {
+		err = db.initIndexes(ctx)
+	}
+	if err == nil {
+		err = db.InitDocuments(ctx)
+	}
 	if err != nil {
 		logger.Fatalln("[NewDatabase] cannot init collections")
 	}
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Request keeps fields of http request which are added to every line logged with its
+// context. Middlewares which learn organization and user fill them in place, so lines
+// of access log get them too
+type Request struct {
+	Id      string
+	Route   string
+	Org     string
+	Login   string
+	Started time.Time
+}
+
+type contextKey string
+
+const contextRequestKey contextKey = "log_request"
+
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, contextRequestKey, req)
+}
+
+// RequestFromContext returns nil outside of http request
+func RequestFromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(contextRequestKey).(*Request)
+	return req
+}
+
+// contextHook adds request and trace to lines logged with logger.WithContext(ctx)
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	if req := RequestFromContext(entry.Context); req != nil {
+		entry.Data["request_id"] = req.Id
+		entry.Data["route"] = req.Route
+		entry.Data["latency_ms"] = time.Since(req.Started).Milliseconds()
+		if req.Org != "" {
+			entry.Data["org"] = req.Org
+		}
+		if req.Login != "" {
+			entry.Data["login"] = req.Login
+		}
+	}
+	if span := trace.SpanContextFromContext(entry.Context); span.IsValid() {
+		entry.Data["trace_id"] = span.TraceID().String()
+	}
+	return nil
+}
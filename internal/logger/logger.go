@@ -1,19 +1,41 @@
 package logger
 
 import (
+	"nocalendar/internal/config"
 	"os"
 
 	"github.com/sirupsen/logrus"
-	easy "github.com/t-tomalak/logrus-easy-formatter"
 )
 
-func NewLogger() *logrus.Logger {
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+
+	TIMESTAMP_FORMAT = "2006-01-02 15:04:05"
+)
+
+// NewLogger expects level and format checked by config.Validate, unknown level falls back
+// to info and unknown format to text
+func NewLogger(cfg config.LogConfig) *logrus.Logger {
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+
 	logger := logrus.New()
 	logger.Out = os.Stdout
-	logger.Level = logrus.InfoLevel
-	logger.Formatter = &easy.Formatter{
-		TimestampFormat: "2006-01-02 15:04:05",
-		LogFormat:       "[%lvl%]: %time% - %msg%\n",
+	logger.Level = level
+	switch cfg.Format {
+	case FORMAT_JSON:
+		logger.Formatter = &logrus.JSONFormatter{
+			TimestampFormat: TIMESTAMP_FORMAT,
+		}
+	default:
+		logger.Formatter = &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: TIMESTAMP_FORMAT,
+		}
 	}
+	logger.AddHook(contextHook{})
 	return logger
 }
@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"nocalendar/internal/config"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer only writes letters to log, it is used when smtp is not configured
+type LogMailer struct {
+	logger *logrus.Logger
+}
+
+func (lm *LogMailer) Send(to, subject, body string) error {
+	lm.logger.Infof("[LogMailer] letter to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+type SmtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func (sm *SmtpMailer) Send(to, subject, body string) error {
+	msg := strings.Join([]string{
+		fmt.Sprintf("From: %s", sm.from),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	return smtp.SendMail(sm.addr, sm.auth, sm.from, []string{to}, []byte(msg))
+}
+
+// NewMailer sends letters through smtp server if its address is set, otherwise letters are logged
+func NewMailer(cfg config.SmtpConfig, logger *logrus.Logger) Mailer {
+	if cfg.Addr == "" {
+		logger.Warnln("[NewMailer] smtp address is not set, letters will be logged")
+		return &LogMailer{logger: logger}
+	}
+
+	var auth smtp.Auth
+	if cfg.User != "" {
+		host := strings.Split(cfg.Addr, ":")[0]
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, host)
+	}
+	return &SmtpMailer{
+		addr: cfg.Addr,
+		auth: auth,
+		from: cfg.From,
+	}
+}
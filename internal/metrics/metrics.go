@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "nocalendar"
+
+// Registry keeps all metrics of service. It is separate from default registry of
+// prometheus, so libraries cannot add their metrics to /metrics unnoticed
+var Registry = prometheus.NewRegistry()
+
+var (
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_requests_total",
+		Help:      "Handled http requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	HttpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	RepositoryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "repository_duration_seconds",
+		Help:      "Latency of repository calls by repository and method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"repository", "method"})
+	RepositoryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "repository_errors_total",
+		Help:      "Failed repository calls by repository, method and kind of error.",
+	}, []string{"repository", "method", "error"})
+
+	Invites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "invites_total",
+		Help:      "Invites to events by action: sent, accepted, rejected.",
+	}, []string{"action"})
+
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "job_runs_total",
+		Help:      "Runs of maintenance jobs by outcome: success, partial, failure.",
+	}, []string{"job", "outcome"})
+	JobEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "job_events_total",
+		Help:      "Events handled by maintenance jobs by result: processed, failed.",
+	}, []string{"job", "result"})
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of maintenance jobs.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 8),
+	}, []string{"job"})
+	JobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "job_last_success_timestamp_seconds",
+		Help:      "Time of the last run of maintenance job without failures.",
+	}, []string{"job"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HttpRequests, HttpDuration,
+		RepositoryDuration, RepositoryErrors,
+		Invites,
+		JobRuns, JobEvents, JobDuration, JobLastSuccess,
+	)
+}
+
+// Handler serves all metrics of Registry in text format of prometheus to those who send
+// token in Authorization: Bearer header. Metrics are labeled with organizations, so
+// nobody else may see them
+func Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(got, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
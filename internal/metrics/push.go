@@ -0,0 +1,15 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus/push"
+
+// PushJobs sends metrics of maintenance jobs to pushgateway. Tools from cmd/regular
+// exit before prometheus could scrape them
+func PushJobs(url, job string) error {
+	return push.New(url, job).
+		Collector(JobRuns).
+		Collector(JobEvents).
+		Collector(JobDuration).
+		Collector(JobLastSuccess).
+		Collector(RepositoryErrors).
+		Push()
+}
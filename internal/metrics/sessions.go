@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const SESSIONS_COUNT_TIMEOUT = 10 * time.Second
+
+// SessionsCounter returns number of active sessions by organization
+type SessionsCounter func(ctx context.Context) (map[string]int, error)
+
+// sessionsCollector counts sessions on every scrape. Sessions expire without any event,
+// so gauge updated on login and logout would drift
+type sessionsCollector struct {
+	count  SessionsCounter
+	desc   *prometheus.Desc
+	logger *logrus.Logger
+}
+
+func NewSessionsCollector(count SessionsCounter, logger *logrus.Logger) prometheus.Collector {
+	return &sessionsCollector{
+		count: count,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(NAMESPACE, "", "active_sessions"),
+			"Sessions which are not expired yet by organization.",
+			[]string{"org"}, nil,
+		),
+		logger: logger,
+	}
+}
+
+func (sc *sessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.desc
+}
+
+func (sc *sessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), SESSIONS_COUNT_TIMEOUT)
+	defer cancel()
+
+	counts, err := sc.count(ctx)
+	if err != nil {
+		sc.logger.Warnf("[Collect] sessions not counted: %s", err.Error())
+		ch <- prometheus.NewInvalidMetric(sc.desc, err)
+		return
+	}
+	for org, count := range counts {
+		ch <- prometheus.MustNewConstMetric(sc.desc, prometheus.GaugeValue, float64(count), org)
+	}
+}
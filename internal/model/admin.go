@@ -0,0 +1,30 @@
+package model
+
+// maintenance jobs which administrators may run, the same jobs are run by cmd/regular
+const (
+	JOB_CLEAN_REMOVED_EVENTS string = "clean_removed_events"
+	JOB_UPDATE_TIMESTAMP     string = "update_timestamp"
+)
+
+type RoleUpdate struct {
+	Role string `json:"role"`
+}
+
+// ReassignRequest gives events and calendars of user to TransferTo
+type ReassignRequest struct {
+	TransferTo string `json:"transfer_to"`
+}
+
+// JobResult counts processed items, Failed lists ids which were not processed
+type JobResult struct {
+	Job       string   `json:"job"`
+	Processed int      `json:"processed"`
+	Failed    []string `json:"failed"`
+}
+
+func (jr *JobResult) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["result"] = jr
+	return hm
+}
@@ -0,0 +1,84 @@
+package model
+
+// scopes of api keys, session tokens have all of them
+const (
+	SCOPE_EVENTS_READ     string = "events:read"
+	SCOPE_EVENTS_WRITE    string = "events:write"
+	SCOPE_INVITES_WRITE   string = "invites:write"
+	SCOPE_CALENDARS_READ  string = "calendars:read"
+	SCOPE_CALENDARS_WRITE string = "calendars:write"
+	SCOPE_USERS_READ      string = "users:read"
+	SCOPE_GROUPS_READ     string = "groups:read"
+	SCOPE_GROUPS_WRITE    string = "groups:write"
+)
+
+var validScopes = map[string]bool{
+	SCOPE_EVENTS_READ:     true,
+	SCOPE_EVENTS_WRITE:    true,
+	SCOPE_INVITES_WRITE:   true,
+	SCOPE_CALENDARS_READ:  true,
+	SCOPE_CALENDARS_WRITE: true,
+	SCOPE_USERS_READ:      true,
+	SCOPE_GROUPS_READ:     true,
+	SCOPE_GROUPS_WRITE:    true,
+}
+
+func IsValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+// ApiKey lets scripts act on behalf of user, key is shown only once as ncl_<id>_<secret>
+type ApiKey struct {
+	Id        string   `json:"id" bson:"id"`
+	Login     string   `json:"-" bson:"login"`
+	Name      string   `json:"name" bson:"name"`
+	Scopes    []string `json:"scopes" bson:"scopes"`
+	KeyHash   string   `json:"-" bson:"key_hash"` // hash of secret part of key
+	CreatedAt int64    `json:"created_at" bson:"created_at"`
+	ExpiresAt int64    `json:"expires_at" bson:"expires_at"` // 0 means that key never expires
+	LastUsed  int64    `json:"last_used" bson:"last_used"`
+}
+
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type BsonApiKeys struct {
+	Id      string             `bson:"_id"`
+	ApiKeys map[string]*ApiKey `bson:"api_keys"`
+}
+
+type JsonApiKeys struct {
+	ApiKeys []*ApiKey `json:"api_keys"`
+}
+
+func (jk *JsonApiKeys) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["api_keys"] = jk.ApiKeys
+	return hm
+}
+
+type CreatedApiKey struct {
+	ApiKey *ApiKey
+	Key    string
+}
+
+func (ck *CreatedApiKey) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["api_key"] = ck.ApiKey
+	hm["key"] = ck.Key
+	return hm
+}
+
+type ApiKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt int64    `json:"expires_at"`
+}
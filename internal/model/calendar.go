@@ -0,0 +1,98 @@
+package model
+
+// roles granted on shared calendars, each next role includes previous ones
+const (
+	ROLE_NONE     string = ""
+	ROLE_FREEBUSY string = "freebusy" // only time of events
+	ROLE_READ     string = "read"     // full events
+	ROLE_WRITE    string = "write"    // create and edit events
+	ROLE_MANAGE   string = "manage"   // remove events and share calendar
+)
+
+var roleLevels = map[string]int{
+	ROLE_NONE:     0,
+	ROLE_FREEBUSY: 1,
+	ROLE_READ:     2,
+	ROLE_WRITE:    3,
+	ROLE_MANAGE:   4,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok && role != ROLE_NONE
+}
+
+// HasRole reports whether role grants at least required rights
+func HasRole(role, required string) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+// MaxRole returns the most powerful of two roles
+func MaxRole(a, b string) string {
+	if roleLevels[a] >= roleLevels[b] {
+		return a
+	}
+	return b
+}
+
+type Calendar struct {
+	Id              string            `json:"id" bson:"id"`
+	Title           string            `json:"title" bson:"title"`
+	Color           string            `json:"color" bson:"color"`
+	DefaultReminder int64             `json:"default_reminder" bson:"default_reminder"` // minutes before event
+	Owner           string            `json:"owner" bson:"owner"`
+	Acl             map[string]string `json:"acl,omitempty" bson:"acl"` // login or "group:<id>" -> role
+	Role            string            `json:"role,omitempty" bson:"-"`  // role of user requested calendar
+}
+
+// RoleOf returns rights of login on the calendar. Groups are ids of groups of login,
+// members of group get role granted to the group
+func (c *Calendar) RoleOf(login string, groups []string) string {
+	if c.Owner == login {
+		return ROLE_MANAGE
+	}
+	role := c.Acl[login]
+	for _, groupId := range groups {
+		role = MaxRole(role, c.Acl[GROUP_MEMBER_PREFIX+groupId])
+	}
+	return role
+}
+
+func (c *Calendar) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["calendar"] = c
+	return hm
+}
+
+type JsonCalendars struct {
+	Calendars []*Calendar `json:"calendars"`
+}
+
+func (jc *JsonCalendars) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["calendars"] = jc.Calendars
+	return hm
+}
+
+type BsonCalendars struct {
+	Id        string               `bson:"_id"`
+	Calendars map[string]*Calendar `bson:"calendars"`
+}
+
+type Share struct {
+	CalendarId string `json:"calendar_id"`
+	Login      string `json:"login"` // login or "group:<id>"
+	Role       string `json:"role"`  // empty role revokes access
+}
+
+type BsonSubscriptions struct {
+	Id            string              `bson:"_id"`
+	Subscriptions map[string][]string `bson:"subscriptions"`
+}
+
+type BsonCalendarEvents struct {
+	Id     string              `bson:"_id"`
+	Events map[string][]string `bson:"calendar_events"`
+}
@@ -0,0 +1,48 @@
+package model
+
+// operations recorded in change feed
+const (
+	CHANGE_CREATED string = "created"
+	CHANGE_UPDATED string = "updated"
+	CHANGE_DELETED string = "deleted"
+)
+
+type Change struct {
+	Seq       int64    `bson:"seq"` // number of change in feed of organization, assigned on insert
+	EventId   string   `bson:"event_id"`
+	Op        string   `bson:"op"`
+	Members   []string `bson:"members"`
+	Removed   []string `bson:"removed"`
+	Timestamp int64    `bson:"timestamp"`
+}
+
+// BsonChanges is a counter of change feed. Seq is a number of the last change
+type BsonChanges struct {
+	Id  string `bson:"_id"`
+	Seq int64  `bson:"seq"`
+}
+
+// BsonChange is a stored change. Every change is a separate document, so feed is not
+// limited by size of one document. Feed is _id of counter, it separates organizations
+type BsonChange struct {
+	Id     string `bson:"_id"`
+	Feed   string `bson:"feed"`
+	Change `bson:",inline"`
+}
+
+type SyncAnswer struct {
+	Token   string   `json:"token"`
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+func (sa *SyncAnswer) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["token"] = sa.Token
+	hm["created"] = sa.Created
+	hm["updated"] = sa.Updated
+	hm["deleted"] = sa.Deleted
+	return hm
+}
@@ -2,10 +2,17 @@ package model
 
 // all possible cgies
 const (
-	EventCgi string = "event_id"
-	NilCgi   string = "nil" // plug
-	FromCgi  string = "from"
-	ToCgi    string = "to"
+	EventCgi     string = "event_id"
+	NilCgi       string = "nil" // plug
+	FromCgi      string = "from"
+	ToCgi        string = "to"
+	SinceCgi     string = "since"
+	CalendarCgi  string = "calendar"
+	QueryCgi     string = "q"
+	LimitCgi     string = "limit"
+	OffsetCgi    string = "offset"
+	OrgCgi       string = "org"
+	TargetOrgCgi string = "target_org"
 )
 
 // consts for access to mongo document
@@ -16,6 +23,64 @@ const (
 
 // handy constants
 const (
-	DAYS_IN_SECONDS    int64 = 24 * 60 * 60
-	LENGTH_OF_EVENT_ID int   = 32
+	DAYS_IN_SECONDS        int64  = 24 * 60 * 60
+	LENGTH_OF_EVENT_ID     int    = 32
+	LENGTH_OF_CALENDAR_ID  int    = 16
+	LENGTH_OF_GROUP_ID     int    = 16
+	CHANGES_RETENTION      int64  = 10000
+	CHANGE_GAP_TIMEOUT     int64  = 60 // seconds to wait for change, which number is taken but which is not stored yet
+	DEFAULT_CALENDAR_COLOR string = "#4285f4"
+)
+
+// sessions
+const (
+	LENGTH_OF_SESSION_ID     int   = 16
+	LENGTH_OF_SESSION_SECRET int   = 32
+	SESSION_IDLE_TIMEOUT     int64 = 30 * DAYS_IN_SECONDS
+	SESSION_ABSOLUTE_TIMEOUT int64 = 90 * DAYS_IN_SECONDS
+	ACCESS_TOKEN_TTL         int64 = 15 * 60
+)
+
+// api keys
+const (
+	API_KEY_PREFIX          string = "ncl_"
+	LENGTH_OF_API_KEY_ID    int    = 12
+	LENGTH_OF_API_KEY       int    = 32
+	API_KEY_LAST_USED_DELAY int64  = 60 // last usage is stored not more often
+)
+
+// tokens sent by email
+const (
+	LENGTH_OF_USER_TOKEN   int   = 32
+	VERIFY_EMAIL_TOKEN_TTL int64 = 2 * DAYS_IN_SECONDS
+	RESET_PASSWORD_TTL     int64 = 60 * 60
+	MIN_PASSWORD_LENGTH    int   = 8
+	MAX_PASSWORD_LENGTH    int   = 72 // bcrypt ignores bytes beyond it
+)
+
+// single sign-on
+const (
+	LENGTH_OF_OIDC_STATE    int   = 32
+	LENGTH_OF_OIDC_VERIFIER int   = 64
+	OIDC_STATE_TTL          int64 = 10 * 60
+)
+
+// user directory
+const (
+	DEFAULT_SEARCH_LIMIT    int = 20
+	MAX_SEARCH_LIMIT        int = 100
+	MAX_SEARCH_QUERY_LENGTH int = 64
+)
+
+// limits of request fields
+const (
+	MAX_TITLE_LENGTH       int   = 256
+	MAX_NAME_LENGTH        int   = 64
+	MAX_EMAIL_LENGTH       int   = 254
+	MAX_DESCRIPTION_LENGTH int   = 4096
+	MAX_MEMBERS            int   = 200
+	MIN_TIMESTAMP          int64 = 1
+	MAX_TIMESTAMP          int64 = 4102444800 // 2100-01-01
+	MAX_DELTA_DAYS         int64 = 366
+	MAX_REMINDER_MINUTES   int64 = 4 * 7 * 24 * 60
 )
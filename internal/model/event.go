@@ -6,6 +6,21 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// visibility of event details for users who are not participants
+const (
+	VISIBILITY_PUBLIC  string = "public"  // everyone sees details
+	VISIBILITY_BUSY    string = "busy"    // others see only time of event
+	VISIBILITY_PRIVATE string = "private" // event is hidden from those who cannot edit calendar
+)
+
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VISIBILITY_PUBLIC, VISIBILITY_BUSY, VISIBILITY_PRIVATE:
+		return true
+	}
+	return false
+}
+
 type Event struct {
 	Id            string   `json:"id"`
 	Title         string   `json:"title" bson:"title"`
@@ -16,6 +31,10 @@ type Event struct {
 	Author        string   `json:"author" bson:"author"`
 	IsRegular     bool     `json:"is_regular" bson:"is_regular"`
 	Delta         int64    `json:"delta" bson:"delta"`
+	Calendar      string   `json:"calendar" bson:"calendar"`
+	Visibility    string   `json:"visibility" bson:"visibility"`
+	Groups        []string `json:"groups" bson:"groups"`           // groups which members were invited from
+	SyncGroups    bool     `json:"sync_groups" bson:"sync_groups"` // members follow later changes of groups
 }
 
 func (e *Event) Copy() *Event {
@@ -29,6 +48,44 @@ func (e *Event) Copy() *Event {
 		Author:        e.Author,
 		IsRegular:     e.IsRegular,
 		Delta:         e.Delta,
+		Calendar:      e.Calendar,
+		Visibility:    e.Visibility,
+		Groups:        e.Groups,
+		SyncGroups:    e.SyncGroups,
+	}
+}
+
+// BusyOnly hides everything except time of event
+func (e *Event) BusyOnly() *Event {
+	return &Event{
+		Id:         e.Id,
+		Timestamp:  e.Timestamp,
+		IsRegular:  e.IsRegular,
+		Delta:      e.Delta,
+		Calendar:   e.Calendar,
+		Visibility: e.Visibility,
+	}
+}
+
+// ViewFor redacts event for user with given role according to visibility of event.
+// Participants have at least write role and always see whole event. Returns nil if event is hidden
+func (e *Event) ViewFor(role string) *Event {
+	switch e.Visibility {
+	case VISIBILITY_PUBLIC:
+		return e
+	case VISIBILITY_PRIVATE:
+		if HasRole(role, ROLE_WRITE) {
+			return e
+		}
+		if HasRole(role, ROLE_FREEBUSY) {
+			return e.BusyOnly()
+		}
+		return nil
+	default:
+		if HasRole(role, ROLE_READ) {
+			return e
+		}
+		return e.BusyOnly()
 	}
 }
 
@@ -50,6 +107,10 @@ func (e *Event) ToRegular(single_event_id string) *RegularEvent {
 		Author:        e.Author,
 		Delta:         e.Delta,
 		SingleEventId: single_event_id,
+		Calendar:      e.Calendar,
+		Visibility:    e.Visibility,
+		Groups:        e.Groups,
+		SyncGroups:    e.SyncGroups,
 	}
 }
 
@@ -63,6 +124,10 @@ func (e *Event) ToSingle(regular_event_id string) *SingleEvent {
 		ActiveMembers:  e.ActiveMembers,
 		Author:         e.Author,
 		RegularEventId: regular_event_id,
+		Calendar:       e.Calendar,
+		Visibility:     e.Visibility,
+		Groups:         e.Groups,
+		SyncGroups:     e.SyncGroups,
 	}
 }
 
@@ -76,6 +141,10 @@ type RegularEvent struct {
 	Author        string   `bson:"author"`
 	Delta         int64    `bson:"delta"`
 	SingleEventId string   `bson:"single_event_id"`
+	Calendar      string   `bson:"calendar"`
+	Visibility    string   `bson:"visibility"`
+	Groups        []string `bson:"groups"`
+	SyncGroups    bool     `bson:"sync_groups"`
 }
 
 func (re *RegularEvent) ToEvent() *Event {
@@ -89,6 +158,10 @@ func (re *RegularEvent) ToEvent() *Event {
 		Author:        re.Author,
 		Delta:         re.Delta,
 		IsRegular:     true,
+		Calendar:      re.Calendar,
+		Visibility:    re.Visibility,
+		Groups:        re.Groups,
+		SyncGroups:    re.SyncGroups,
 	}
 }
 
@@ -101,6 +174,10 @@ type SingleEvent struct {
 	ActiveMembers  []string `bson:"active_members"`
 	Author         string   `bson:"author"`
 	RegularEventId string   `bson:"regular_event_id"`
+	Calendar       string   `bson:"calendar"`
+	Visibility     string   `bson:"visibility"`
+	Groups         []string `bson:"groups"`
+	SyncGroups     bool     `bson:"sync_groups"`
 }
 
 func (re *SingleEvent) ToEvent() *Event {
@@ -114,6 +191,10 @@ func (re *SingleEvent) ToEvent() *Event {
 		Author:        re.Author,
 		Delta:         0,
 		IsRegular:     false,
+		Calendar:      re.Calendar,
+		Visibility:    re.Visibility,
+		Groups:        re.Groups,
+		SyncGroups:    re.SyncGroups,
 	}
 }
 
@@ -127,6 +208,16 @@ type BsonSingleEvent struct {
 	Events map[string]interface{} `bson:"single"`
 }
 
+// SupportEventId returns single_event_id of regular event or regular_event_id of single event
+func SupportEventId(event interface{}, mode string) string {
+	key := "regular_event_id"
+	if mode == REGULAR_EVENT {
+		key = "single_event_id"
+	}
+	id, _ := event.(map[string]interface{})[key].(string)
+	return id
+}
+
 func ConvertInterfaceToEvent(event interface{}, mode string) *Event {
 	ievent := event.(map[string]interface{})
 	e := &Event{
@@ -136,6 +227,14 @@ func ConvertInterfaceToEvent(event interface{}, mode string) *Event {
 		Timestamp:   ievent["timestamp"].(int64),
 		Author:      ievent["author"].(string),
 	}
+	// events created before calendars appeared have no calendar field
+	if calendar, ok := ievent["calendar"].(string); ok {
+		e.Calendar = calendar
+	}
+	e.Visibility = VISIBILITY_BUSY
+	if visibility, ok := ievent["visibility"].(string); ok && visibility != "" {
+		e.Visibility = visibility
+	}
 	e.Members = make([]string, 0)
 	for _, val := range ievent["members"].(primitive.A) {
 		e.Members = append(e.Members, val.(string))
@@ -144,6 +243,16 @@ func ConvertInterfaceToEvent(event interface{}, mode string) *Event {
 	for _, val := range ievent["active_members"].(primitive.A) {
 		e.ActiveMembers = append(e.ActiveMembers, val.(string))
 	}
+	// events created before groups appeared have no groups
+	e.Groups = make([]string, 0)
+	if groups, ok := ievent["groups"].(primitive.A); ok {
+		for _, val := range groups {
+			e.Groups = append(e.Groups, val.(string))
+		}
+	}
+	if syncGroups, ok := ievent["sync_groups"].(bool); ok {
+		e.SyncGroups = syncGroups
+	}
 	switch mode {
 	case REGULAR_EVENT:
 		e.Delta = ievent["delta"].(int64)
@@ -0,0 +1,76 @@
+package model
+
+import "strings"
+
+// events reference groups in members as "group:<id of group>"
+const GROUP_MEMBER_PREFIX string = "group:"
+
+// GroupIdOf returns id of group if member of event references group
+func GroupIdOf(member string) (string, bool) {
+	if !strings.HasPrefix(member, GROUP_MEMBER_PREFIX) {
+		return "", false
+	}
+	return strings.TrimPrefix(member, GROUP_MEMBER_PREFIX), true
+}
+
+// Group is a team of users of organization which can be invited to event at once.
+// Only owner manages group, all users of organization see it
+type Group struct {
+	Id      string   `json:"id" bson:"id"`
+	Name    string   `json:"name" bson:"name"`
+	Owner   string   `json:"owner" bson:"owner"`
+	Members []string `json:"members" bson:"members"`
+}
+
+func (g *Group) HasMember(login string) bool {
+	for _, member := range g.Members {
+		if member == login {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupIdsOf returns ids of groups which login is member of
+func GroupIdsOf(groups []*Group, login string) []string {
+	ids := make([]string, 0)
+	for _, group := range groups {
+		if group.HasMember(login) {
+			ids = append(ids, group.Id)
+		}
+	}
+	return ids
+}
+
+func (g *Group) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["group"] = g
+	return hm
+}
+
+type JsonGroups struct {
+	Groups []*Group `json:"groups"`
+}
+
+func (jg *JsonGroups) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["groups"] = jg.Groups
+	return hm
+}
+
+type GroupMembers struct {
+	Members []string `json:"members"`
+}
+
+type BsonGroups struct {
+	Id     string            `bson:"_id"`
+	Groups map[string]*Group `bson:"groups"`
+}
+
+// BsonGroupEvents lists events which follow membership of group
+type BsonGroupEvents struct {
+	Id     string              `bson:"_id"`
+	Events map[string][]string `bson:"group_events"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// types of notifications pushed to connected clients
+const (
+	NotificationInvite       string = "invite"
+	NotificationEventChanged string = "event_changed"
+	NotificationEventRemoved string = "event_removed"
+)
+
+type Notification struct {
+	Type      string `json:"type"`
+	EventId   string `json:"event_id"`
+	Timestamp int64  `json:"timestamp"`
+}
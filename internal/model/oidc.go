@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OidcProvider is configuration of one external identity provider
+type OidcProvider struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectUrl  string   `json:"redirect_url"` // must point to /api/oidc/{name}/callback
+	Scopes       []string `json:"scopes"`
+}
+
+// OidcState is remembered between redirect to provider and callback
+type OidcState struct {
+	Provider  string `bson:"provider"`
+	Nonce     string `bson:"nonce"`
+	Verifier  string `bson:"verifier"` // PKCE code verifier
+	CreatedAt int64  `bson:"created_at"`
+}
+
+type BsonOidcStates struct {
+	Id     string                `bson:"_id"`
+	States map[string]*OidcState `bson:"oidc_states"`
+}
+
+// Identity links account of external provider to local login
+type Identity struct {
+	Provider string `bson:"provider"`
+	Subject  string `bson:"subject"`
+	Login    string `bson:"login"`
+	LinkedAt int64  `bson:"linked_at"`
+}
+
+type BsonIdentities struct {
+	Id         string               `bson:"_id"`
+	Identities map[string]*Identity `bson:"identities"`
+}
+
+// OidcClaims are claims of ID token used for provisioning of users
+type OidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type JsonOidcProviders struct {
+	Providers []string `json:"providers"`
+}
+
+func (jp *JsonOidcProviders) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["providers"] = jp.Providers
+	return hm
+}
+
+// OrgState prefixes state sent to provider with organization, because callback
+// of provider is the same for all organizations
+func OrgState(orgId, state string) string {
+	return fmt.Sprintf("%s.%s", orgId, state)
+}
+
+// SplitOrgState returns organization and stored state, state without organization belongs to default one
+func SplitOrgState(state string) (string, string) {
+	parts := strings.SplitN(state, ".", 2)
+	if len(parts) != 2 {
+		return DEFAULT_ORG, state
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,36 @@
+package model
+
+import "regexp"
+
+// DEFAULT_ORG keeps documents of installation without organizations, requests without
+// organization header go to it
+const (
+	DEFAULT_ORG string = "default"
+	ORG_HEADER  string = "Organization"
+)
+
+var orgIdRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,31}$`)
+
+// IsValidOrgId allows ids which are safe inside document ids, tokens and links
+func IsValidOrgId(id string) bool {
+	return orgIdRegexp.MatchString(id)
+}
+
+type Org struct {
+	Id               string `json:"id" bson:"id"`
+	Name             string `json:"name" bson:"name"`
+	Require2fa       bool   `json:"require_2fa" bson:"require_2fa"`             // users without second factor get restricted sessions
+	OpenRegistration bool   `json:"open_registration" bson:"open_registration"` // anyone may register, otherwise users are created by admins
+	CreatedAt        int64  `json:"created_at" bson:"created_at"`
+}
+
+// OrgSettings are settings which administrators of organization change through api,
+// settings which are not passed stay the same
+type OrgSettings struct {
+	Require2fa *bool `json:"require_2fa"`
+}
+
+type BsonOrgs struct {
+	Id   string         `bson:"_id"`
+	Orgs map[string]Org `bson:"orgs"`
+}
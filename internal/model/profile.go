@@ -0,0 +1,27 @@
+package model
+
+// ProfileUpdate changes only fields which are present in request
+type ProfileUpdate struct {
+	Name    *string `json:"name"`
+	Surname *string `json:"surname"`
+	Email   *string `json:"email"`
+
+	Hidden *bool `json:"hidden_from_directory"`
+}
+
+// DeleteAccountRequest confirms deletion with password and, if second factor is enabled,
+// with one-time or recovery code. Events authored by user are given to TransferTo or
+// cancelled if it is empty
+type DeleteAccountRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	TransferTo   string `json:"transfer_to"`
+}
+
+func (u *UserProfile) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["user"] = u
+	return hm
+}
@@ -0,0 +1,29 @@
+package model
+
+type Session struct {
+	Id         string `json:"id" bson:"id"`
+	Login      string `json:"-" bson:"login"`
+	TokenHash  string `json:"-" bson:"token_hash"` // hash of current refresh token secret
+	Generation int64  `json:"-" bson:"generation"` // number of refresh token rotations
+	Device     string `json:"device" bson:"device"`
+	CreatedAt  int64  `json:"created_at" bson:"created_at"`
+	LastUsed   int64  `json:"last_used" bson:"last_used"`
+	Restricted bool   `json:"restricted" bson:"restricted"` // second factor must be enrolled first
+	Current    bool   `json:"current" bson:"-"`
+}
+
+type BsonSessions struct {
+	Id       string              `bson:"_id"`
+	Sessions map[string]*Session `bson:"sessions"`
+}
+
+type JsonSessions struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+func (js *JsonSessions) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["sessions"] = js.Sessions
+	return hm
+}
@@ -0,0 +1,30 @@
+package model
+
+import "github.com/golang-jwt/jwt/v4"
+
+// AccessClaims are carried by short-lived access token and checked without storage lookup
+type AccessClaims struct {
+	SessionId  string `json:"sid"`
+	Org        string `json:"org"`
+	Restricted bool   `json:"rst,omitempty"` // only enrollment of second factor is allowed
+	jwt.RegisteredClaims
+}
+
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (t *Tokens) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["access_token"] = t.AccessToken
+	hm["refresh_token"] = t.RefreshToken
+	hm["expires_in"] = t.ExpiresIn
+	return hm
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,56 @@
+package model
+
+const (
+	TOTP_ISSUER              string = "NeCalendar"
+	MFA_AUDIENCE             string = "mfa"
+	MFA_TOKEN_TTL            int64  = 5 * 60
+	NUMBER_OF_RECOVERY_CODES int    = 10
+	LENGTH_OF_RECOVERY_CODE  int    = 10
+)
+
+// MfaChallenge is returned after correct password when second factor is enabled
+type MfaChallenge struct {
+	MfaToken string
+}
+
+func (mc *MfaChallenge) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "second factor required"
+	hm["mfa_token"] = mc.MfaToken
+	return hm
+}
+
+type SecondFactorRequest struct {
+	MfaToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TotpEnrollment struct {
+	Secret string
+	Uri    string
+}
+
+func (te *TotpEnrollment) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["secret"] = te.Secret
+	hm["uri"] = te.Uri
+	return hm
+}
+
+type TotpRequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+type RecoveryCodes struct {
+	Codes []string
+}
+
+func (rc *RecoveryCodes) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["recovery_codes"] = rc.Codes
+	return hm
+}
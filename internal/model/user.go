@@ -1,14 +1,57 @@
 package model
 
+// roles of users, each next role has all rights of previous ones
+const (
+	USER_ROLE_USER        string = "user"
+	USER_ROLE_ORG_ADMIN   string = "org-admin"   // manages users and events of own organization
+	USER_ROLE_SUPER_ADMIN string = "super-admin" // manages all organizations
+)
+
+var userRoleLevels = map[string]int{
+	USER_ROLE_USER:        0,
+	USER_ROLE_ORG_ADMIN:   1,
+	USER_ROLE_SUPER_ADMIN: 2,
+}
+
+func IsValidUserRole(role string) bool {
+	_, ok := userRoleLevels[role]
+	return ok
+}
+
+// HasUserRole reports whether role gives rights of required one, empty role is a plain user
+func HasUserRole(role, required string) bool {
+	return userRoleLevels[role] >= userRoleLevels[required]
+}
+
 type User struct {
 	Login    string `json:"login"`
 	Name     string `json:"name" bson:"name"`
 	Surname  string `json:"surname" bson:"surname"`
 	Email    string `json:"email" bson:"email"`
 	Password string `json:"password" bson:"password"`
-	Token    string `bson:"token"`
+
+	EmailVerified bool `json:"-" bson:"email_verified"`
+
+	TotpSecret    string   `json:"-" bson:"totp_secret"`
+	TotpEnabled   bool     `json:"-" bson:"totp_enabled"`
+	TotpLastStep  int64    `json:"-" bson:"totp_last_step"` // protects from reuse of the same code
+	RecoveryCodes []string `json:"-" bson:"recovery_codes"` // hashes of unused recovery codes
+
+	Hidden bool `json:"-" bson:"hidden"` // user is not shown in directory search
+
+	Role      string `json:"-" bson:"role"`
+	Suspended bool   `json:"-" bson:"suspended"` // suspended user cannot log in
+}
+
+// UserRole returns role of user, users created before roles are plain users
+func (u *User) UserRole() string {
+	if u.Role == "" {
+		return USER_ROLE_USER
+	}
+	return u.Role
 }
 
+// UserWithoutPassword is how users see each other, e.g. in directory search
 type UserWithoutPassword struct {
 	Login   string `json:"login"`
 	Name    string `json:"name"`
@@ -16,6 +59,23 @@ type UserWithoutPassword struct {
 	Email   string `json:"email"`
 }
 
+// UserProfile is how user sees own account
+type UserProfile struct {
+	UserWithoutPassword
+
+	EmailVerified bool   `json:"email_verified"`
+	TotpEnabled   bool   `json:"totp_enabled"`
+	Hidden        bool   `json:"hidden_from_directory"`
+	Role          string `json:"role"`
+}
+
+// AdminUser is how administrators see users of organization
+type AdminUser struct {
+	UserProfile
+
+	Suspended bool `json:"suspended"`
+}
+
 type JsonUser struct {
 	Id    string          `json:"_id" bson:"_id"`
 	Users map[string]User `json:"users" bson:"users"`
@@ -30,7 +90,48 @@ func (u *User) WithoutPassword() *UserWithoutPassword {
 	}
 }
 
-type JsonTokens struct {
-	Id     string            `json:"_id" bson:"_id"`
-	Tokens map[string]string `json:"tokens" bson:"tokens"`
+func (u *User) Profile() *UserProfile {
+	return &UserProfile{
+		UserWithoutPassword: *u.WithoutPassword(),
+
+		EmailVerified: u.EmailVerified,
+		TotpEnabled:   u.TotpEnabled,
+		Hidden:        u.Hidden,
+		Role:          u.UserRole(),
+	}
+}
+
+func (u *User) ForAdmin() *AdminUser {
+	return &AdminUser{
+		UserProfile: *u.Profile(),
+		Suspended:   u.Suspended,
+	}
+}
+
+// JsonUsers is a page of directory search, Total counts all matched users
+type JsonUsers struct {
+	Users []*UserWithoutPassword `json:"users"`
+	Total int                    `json:"total"`
+}
+
+func (ju *JsonUsers) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["users"] = ju.Users
+	hm["total"] = ju.Total
+	return hm
+}
+
+// JsonAdminUsers is a page of users of organization for administrators
+type JsonAdminUsers struct {
+	Users []*AdminUser `json:"users"`
+	Total int          `json:"total"`
+}
+
+func (ju *JsonAdminUsers) ToAnswer() interface{} {
+	hm := make(map[string]interface{})
+	hm["message"] = "ok"
+	hm["users"] = ju.Users
+	hm["total"] = ju.Total
+	return hm
 }
@@ -0,0 +1,38 @@
+package model
+
+// purposes of one-time tokens sent by email
+const (
+	PURPOSE_VERIFY_EMAIL   string = "verify_email"
+	PURPOSE_RESET_PASSWORD string = "reset_password"
+)
+
+// UserToken is one-time token sent to user by email, only its hash is stored
+type UserToken struct {
+	Purpose   string `bson:"purpose"`
+	Login     string `bson:"login"`
+	Email     string `bson:"email"` // token is valid only while user has this email
+	ExpiresAt int64  `bson:"expires_at"`
+}
+
+type BsonUserTokens struct {
+	Id     string                `bson:"_id"`
+	Tokens map[string]*UserToken `bson:"user_tokens"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// TokenBucket limits rate of requests per key, every key has its own bucket
+type TokenBucket struct {
+	rate  float64 // tokens added per second
+	burst float64 // size of bucket
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	tb := &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		stop:    make(chan struct{}),
+	}
+	go tb.cleanup()
+	return tb
+}
+
+// Allow takes token from bucket of key, if bucket is empty it returns time until next token
+func (tb *TokenBucket) Allow(key string) (bool, time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: tb.burst, updated: now}
+		tb.buckets[key] = b
+	}
+
+	b.tokens = math.Min(tb.burst, b.tokens+now.Sub(b.updated).Seconds()*tb.rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / tb.rate * float64(time.Second))
+}
+
+// cleanup forgets buckets which are full again, they are equal to new ones
+func (tb *TokenBucket) cleanup() {
+	refill := time.Duration(tb.burst / tb.rate * float64(time.Second))
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case <-ticker.C:
+		}
+
+		tb.mu.Lock()
+		now := time.Now()
+		for key, b := range tb.buckets {
+			if now.Sub(b.updated) > refill {
+				delete(tb.buckets, key)
+			}
+		}
+		tb.mu.Unlock()
+	}
+}
+
+// Stop ends cleanup of buckets, limiting itself keeps working
+func (tb *TokenBucket) Stop() {
+	tb.once.Do(func() {
+		close(tb.stop)
+	})
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+)
+
+// LoginGuard locks out clients and logins after failed login attempts
+type LoginGuard struct {
+	byIp     *Lockout
+	byLogin  *Lockout
+	ipHeader string
+}
+
+func NewLoginGuard(byIp, byLogin *Lockout, ipHeader string) *LoginGuard {
+	return &LoginGuard{
+		byIp:     byIp,
+		byLogin:  byLogin,
+		ipHeader: ipHeader,
+	}
+}
+
+// Locked returns how long attempts to log in as login from client of r are rejected
+func (lg *LoginGuard) Locked(r *http.Request, login string) time.Duration {
+	byIp := lg.byIp.Locked(ClientIp(r, lg.ipHeader))
+	byLogin := lg.byLogin.Locked(login)
+	if byIp > byLogin {
+		return byIp
+	}
+	return byLogin
+}
+
+func (lg *LoginGuard) Fail(r *http.Request, login string) {
+	lg.byIp.Fail(ClientIp(r, lg.ipHeader))
+	lg.byLogin.Fail(login)
+}
+
+// Success resets only failures of login, otherwise one valid account would let to
+// guess passwords of other users from the same address without limits
+func (lg *LoginGuard) Success(login string) {
+	lg.byLogin.Reset(login)
+}
+
+func (lg *LoginGuard) Stop() {
+	lg.byIp.Stop()
+	lg.byLogin.Stop()
+}
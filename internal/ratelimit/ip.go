@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIp returns address of client. Header is trusted only when it is set by our proxy,
+// empty header means that clients connect directly. Proxy appends address to the end of
+// the list, previous values could be sent by client
+func ClientIp(r *http.Request, header string) string {
+	if header != "" {
+		if value := r.Header.Get(header); value != "" {
+			values := strings.Split(value, ",")
+			return strings.TrimSpace(values[len(values)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
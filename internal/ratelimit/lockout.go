@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Lockout blocks key after too many failures, every next failure doubles the lock
+type Lockout struct {
+	maxFailures int           // failures allowed before the first lock
+	baseLock    time.Duration // duration of the first lock
+	maxLock     time.Duration
+	window      time.Duration // failures are forgotten after this time without new ones
+
+	mu   sync.Mutex
+	keys map[string]*attempts
+	stop chan struct{}
+	once sync.Once
+}
+
+func NewLockout(maxFailures int, baseLock, maxLock, window time.Duration) *Lockout {
+	l := &Lockout{
+		maxFailures: maxFailures,
+		baseLock:    baseLock,
+		maxLock:     maxLock,
+		window:      window,
+		keys:        make(map[string]*attempts),
+		stop:        make(chan struct{}),
+	}
+	go l.cleanup()
+	return l
+}
+
+// Locked returns how long key stays locked, zero means that attempt is allowed
+func (l *Lockout) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.keys[key]
+	if !ok {
+		return 0
+	}
+	left := time.Until(a.lockedUntil)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+func (l *Lockout) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	a, ok := l.keys[key]
+	if !ok || now.Sub(a.lastFailure) > l.window {
+		a = &attempts{}
+		l.keys[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+	if a.failures < l.maxFailures {
+		return
+	}
+
+	lock := l.baseLock
+	for i := l.maxFailures; i < a.failures && lock < l.maxLock; i++ {
+		lock *= 2
+	}
+	if lock > l.maxLock {
+		lock = l.maxLock
+	}
+	a.lockedUntil = now.Add(lock)
+}
+
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
+
+func (l *Lockout) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		now := time.Now()
+		for key, a := range l.keys {
+			if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > l.window {
+				delete(l.keys, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Stop ends cleanup of forgotten keys, lockout itself keeps working
+func (l *Lockout) Stop() {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"nocalendar/internal/config"
+	"time"
+)
+
+type contextKey string
+
+const contextConnKey contextKey = "conn"
+
+// NewServer returns http server with timeouts from config. Connection of every request
+// is kept in its context, so long-lived responses may extend their write deadline
+func NewServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, contextConnKey, conn)
+		},
+	}
+}
+
+// ExtendWriteDeadline lets handler of r write for d more. Write timeout of server limits
+// whole response, streams would be cut by it otherwise
+func ExtendWriteDeadline(r *http.Request, d time.Duration) error {
+	conn, ok := r.Context().Value(contextConnKey).(net.Conn)
+	if !ok {
+		return nil
+	}
+	return conn.SetWriteDeadline(time.Now().Add(d))
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// scores of MatchScore, lower is better
+const (
+	MatchExact     int = 0
+	MatchPrefix    int = 1
+	MatchWord      int = 2 // prefix of one of words
+	MatchSubstring int = 3
+	MatchTypo      int = 4 // plus number of typos
+	NoMatch        int = -1
+)
+
+// MatchScore compares query with value case-insensitively. Short queries must match
+// exactly, longer ones may contain one typo and queries of 6 and more letters - two
+func MatchScore(query, value string) int {
+	query = strings.ToLower(strings.TrimSpace(query))
+	value = strings.ToLower(value)
+	if query == "" || value == "" {
+		return NoMatch
+	}
+
+	switch {
+	case value == query:
+		return MatchExact
+	case strings.HasPrefix(value, query):
+		return MatchPrefix
+	}
+
+	words := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '@' || r == '.' || r == '_' || r == '-'
+	})
+	for _, word := range words {
+		if strings.HasPrefix(word, query) {
+			return MatchWord
+		}
+	}
+	if strings.Contains(value, query) {
+		return MatchSubstring
+	}
+
+	allowed := 0
+	switch length := utf8.RuneCountInString(query); {
+	case length >= 6:
+		allowed = 2
+	case length >= 3:
+		allowed = 1
+	}
+	if allowed == 0 {
+		return NoMatch
+	}
+
+	best := NoMatch
+	for _, word := range append(words, value) {
+		distance := prefixDistance(query, word)
+		if distance <= allowed && (best == NoMatch || distance < best) {
+			best = distance
+		}
+	}
+	if best == NoMatch {
+		return NoMatch
+	}
+	return MatchTypo + best
+}
+
+// prefixDistance returns Levenshtein distance between query and the closest prefix of word
+func prefixDistance(query, word string) int {
+	q := []rune(query)
+	w := []rune(word)
+
+	prev := make([]int, len(w)+1)
+	cur := make([]int, len(w)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(q); i++ {
+		cur[0] = i
+		for j := 1; j <= len(w); j++ {
+			cost := 1
+			if q[i-1] == w[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	best := prev[0]
+	for _, d := range prev {
+		if d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
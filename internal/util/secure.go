@@ -0,0 +1,29 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+)
+
+var maxLetterIdx = big.NewInt(int64(len(letterBytes)))
+
+// GenerateSecureString returns random string suitable for secrets and tokens
+func GenerateSecureString(n int) string {
+	buf := make([]byte, n)
+	for i := range buf {
+		idx, err := rand.Int(rand.Reader, maxLetterIdx)
+		if err != nil {
+			panic(err)
+		}
+		buf[i] = letterBytes[idx.Int64()]
+	}
+	return string(buf)
+}
+
+// HashToken returns hex encoded sha256 of token, tokens are stored only in this form
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
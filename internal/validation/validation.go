@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"fmt"
+	"nocalendar/internal/app/errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error lists all problems of a request at once, it is answered with 422
+type Error struct {
+	Fields        map[string]string // field name to problem description
+	UnknownLogins []string
+}
+
+func (e *Error) Error() string {
+	problems := make([]string, 0, len(e.Fields)+1)
+	for field, message := range e.Fields {
+		problems = append(problems, fmt.Sprintf("%s: %s", field, message))
+	}
+	sort.Strings(problems)
+	if len(e.UnknownLogins) > 0 {
+		problems = append(problems, fmt.Sprintf("unknown logins: %s", strings.Join(e.UnknownLogins, ", ")))
+	}
+	return fmt.Sprintf("validation failed: %s", strings.Join(problems, "; "))
+}
+
+// Problem lists problems of fields sorted by field name
+func (e *Error) Problem() *errors.Problem {
+	problem := errors.NewProblem(errors.ValidationFailed)
+	problem.Detail = e.Error()
+	for field, message := range e.Fields {
+		problem.Fields = append(problem.Fields, errors.FieldProblem{Field: field, Message: message})
+	}
+	sort.Slice(problem.Fields, func(i, j int) bool {
+		return problem.Fields[i].Field < problem.Fields[j].Field
+	})
+	problem.UnknownLogins = e.UnknownLogins
+	return problem
+}
+
+// Validator collects problems of request, Err returns them all together
+type Validator struct {
+	fields  map[string]string
+	unknown []string
+}
+
+func NewValidator() *Validator {
+	return &Validator{
+		fields: make(map[string]string),
+	}
+}
+
+// Check marks field invalid if ok is false. Only the first problem of field is kept
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok {
+		return
+	}
+	if _, exist := v.fields[field]; !exist {
+		v.fields[field] = message
+	}
+}
+
+// Length checks number of characters in value
+func (v *Validator) Length(field, value string, min, max int) {
+	length := utf8.RuneCountInString(value)
+	v.Check(length >= min, field, fmt.Sprintf("must be at least %d characters", min))
+	v.Check(length <= max, field, fmt.Sprintf("must be at most %d characters", max))
+}
+
+func (v *Validator) Range(field string, value, min, max int64) {
+	v.Check(value >= min && value <= max, field, fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+func (v *Validator) MaxItems(field string, count, max int) {
+	v.Check(count <= max, field, fmt.Sprintf("must contain at most %d items", max))
+}
+
+func (v *Validator) UnknownLogin(login string) {
+	v.unknown = append(v.unknown, login)
+}
+
+// Err returns *Error with all collected problems or nil if request is valid
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 && len(v.unknown) == 0 {
+		return nil
+	}
+	return &Error{
+		Fields:        v.fields,
+		UnknownLogins: v.unknown,
+	}
+}
+
+// Unique drops empty strings and repeats keeping order of first occurrences
+func Unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}